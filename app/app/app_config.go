@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-contrib/cors"
+	"github.com/ooqls/getset/crypto/ca"
 	"github.com/ooqls/getset/crypto/jwt"
 	"gopkg.in/yaml.v2"
 )
@@ -23,18 +24,50 @@ type ServerConfig struct {
 }
 
 type TLSConfig struct {
-	Enabled  bool   `yaml:"enabled"`
-	CaPath   string `yaml:"ca_path"`
-	CertFile string `yaml:"cert_file"`
-	KeyFile  string `yaml:"key_file"`
+	Enabled            bool   `yaml:"enabled"`
+	CaPath             string `yaml:"ca_path"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	RevocationCheck    string `yaml:"revocation_check"`
+	RevocationSoftFail bool   `yaml:"revocation_soft_fail"`
+	// ReloadIntervalSeconds defaults to 30, a negative value disables
+	// reloading.
+	ReloadIntervalSeconds int `yaml:"reload_interval_seconds"`
+	// ClientAuth is one of request, require or verify-if-given.
+	ClientAuth        string   `yaml:"client_auth"`
+	AllowedClientSANs []string `yaml:"allowed_client_sans"`
+	// DevCertDir bootstraps a development CA and localhost certificate
+	// when no cert and key files are given.
+	DevCertDir string `yaml:"dev_cert_dir"`
 }
 
 type JWTConfig struct {
 	Enabled                 bool                     `yaml:"enabled"`
 	RSAKeyPath              string                   `yaml:"rsa_key_path"`
 	RSAPubKeyPath           string                   `yaml:"rsa_pub_key_path"`
+	KeyAlgorithm            string                   `yaml:"key_algorithm"`
 	TokenConfigurationPaths []string                 `yaml:"token_configuration_paths"`
 	TokenConfigurations     []jwt.TokenConfiguration `yaml:"token_configurations"`
+	RotationIntervalSeconds int                      `yaml:"rotation_interval_seconds"`
+	KeyRetentionSeconds     int                      `yaml:"key_retention_seconds"`
+	JWKSPath                string                   `yaml:"jwks_path"`
+}
+
+type AuthzConfig struct {
+	Enabled               bool   `yaml:"enabled"`
+	PolicyPath            string `yaml:"policy_path"`
+	ReloadIntervalSeconds int    `yaml:"reload_interval_seconds"`
+}
+
+type CAConfig struct {
+	Enabled            bool            `yaml:"enabled"`
+	CertFile           string          `yaml:"cert_file"`
+	KeyFile            string          `yaml:"key_file"`
+	DatabasePath       string          `yaml:"db_path"`
+	Path               string          `yaml:"path"`
+	CRLValiditySeconds int             `yaml:"crl_validity_seconds"`
+	BaseURL            string          `yaml:"base_url"`
+	Policy             ca.PolicyConfig `yaml:"policy"`
 }
 
 type SQLFilesConfig struct {
@@ -144,6 +177,8 @@ type AppConfig struct {
 	ServerConfig ServerConfig     `yaml:"server"`
 	TLS          TLSConfig        `yaml:"tls"`
 	JWT          JWTConfig        `yaml:"jwt"`
+	Authz        AuthzConfig      `yaml:"authz"`
+	CA           CAConfig         `yaml:"ca"`
 	SQLFiles     SQLFilesConfig   `yaml:"sql"`
 	Registry     RegistryConfig   `yaml:"registry"`
 	Health       HealthConfig     `yaml:"health"`
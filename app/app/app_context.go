@@ -2,9 +2,14 @@ package app
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/ooqls/getset/cache/factory"
+	"github.com/ooqls/getset/crypto/authz"
+	"github.com/ooqls/getset/crypto/ca"
 	"github.com/ooqls/getset/crypto/jwt"
+	"github.com/ooqls/getset/crypto/keys"
 	"github.com/ooqls/getset/email"
 	"go.uber.org/zap"
 )
@@ -12,6 +17,9 @@ import (
 const (
 	AuthIssuer    = "auth"
 	RefreshIssuer = "refresh"
+
+	tokenStoreKey  = "tokens"
+	grantsStoreKey = "grants"
 )
 
 func NewAppContext(ctx context.Context, l *zap.Logger) *AppContext {
@@ -28,6 +36,9 @@ type AppContext struct {
 	issuerToTokenConfigs map[string]jwt.TokenConfiguration
 	cacheFactory         factory.CacheFactory
 	emailClient          email.EmailClient
+	authorizer           *authz.Authorizer
+	grants               *authz.StoreResolver
+	authority            *ca.Authority
 }
 
 func (ctx *AppContext) L() *zap.Logger {
@@ -57,7 +68,42 @@ func (ctx *AppContext) EmailClient() (email.EmailClient, bool) {
 	return ctx.emailClient, ctx.emailClient != nil
 }
 
+// Authorizer returns the authorizer built from the authz policy, if the authz
+// feature is enabled.
+func (ctx *AppContext) Authorizer() (*authz.Authorizer, bool) {
+	return ctx.authorizer, ctx.authorizer != nil
+}
+
+// Grants returns the store the authorizer resolves per subject grants from.
+func (ctx *AppContext) Grants() (*authz.StoreResolver, bool) {
+	return ctx.grants, ctx.grants != nil
+}
+
+// CA returns the certificate authority, if the CA feature is enabled.
+func (ctx *AppContext) CA() (*ca.Authority, bool) {
+	return ctx.authority, ctx.authority != nil
+}
+
 func (ctx *AppContext) WithCacheFactory(factory factory.CacheFactory) *AppContext {
 	ctx.cacheFactory = factory
 	return ctx
 }
+
+// NewTokenService builds a refresh-token service from the auth and refresh
+// issuer configurations, signing with the JWT key and keeping token state in
+// the app's cache.
+func NewTokenService[C any](ctx *AppContext) (*jwt.TokenService[C], error) {
+	authCfg, ok := ctx.AuthIssuerConfig()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrIssuerNotConfigured, AuthIssuer)
+	}
+
+	refreshCfg, ok := ctx.RefreshIssuerConfig()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrIssuerNotConfigured, RefreshIssuer)
+	}
+
+	ttl := time.Duration(refreshCfg.ValidityDurationSeconds) * time.Second
+	s := ctx.CacheFactory().NewStore(tokenStoreKey, ttl)
+	return jwt.NewTokenService[C](authCfg, refreshCfg, keys.JWT(), s), nil
+}
@@ -2,9 +2,12 @@ package app
 
 import (
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"google.golang.org/grpc"
+	"github.com/ooqls/getset/crypto/ca"
+	"github.com/ooqls/getset/crypto/mtls"
 )
 
 type featureOpt struct {
@@ -45,6 +48,21 @@ func WithConfig(cfg *AppConfig) Features {
 			ServerCertFile: cfg.TLS.CertFile,
 			ServerKeyFile:  cfg.TLS.KeyFile,
 			CAFile:         cfg.TLS.CaPath,
+
+			RevocationCheck:    ca.RevocationMode(cfg.TLS.RevocationCheck),
+			RevocationSoftFail: cfg.TLS.RevocationSoftFail,
+			ReloadInterval: func() time.Duration {
+				switch {
+				case cfg.TLS.ReloadIntervalSeconds < 0:
+					return 0
+				case cfg.TLS.ReloadIntervalSeconds == 0:
+					return defaultTLSReloadInterval
+				}
+				return time.Duration(cfg.TLS.ReloadIntervalSeconds) * time.Second
+			}(),
+			ClientAuth:        mtls.ClientAuthMode(cfg.TLS.ClientAuth),
+			AllowedClientSANs: cfg.TLS.AllowedClientSANs,
+			DevCertDir:        cfg.TLS.DevCertDir,
 		},
 		RSA: RSAFeature{
 			Enabled:        cfg.RSA.Enabled,
@@ -56,8 +74,40 @@ func WithConfig(cfg *AppConfig) Features {
 			tokenConfigurationPaths: cfg.JWT.TokenConfigurationPaths,
 			PrivateKeyPath:          cfg.JWT.RSAKeyPath,
 			PubKeyPath:              cfg.JWT.RSAPubKeyPath,
+			KeyAlgorithm:            cfg.JWT.KeyAlgorithm,
 			tokenConfiguration:      cfg.JWT.TokenConfigurations,
+			RotationInterval:        time.Duration(cfg.JWT.RotationIntervalSeconds) * time.Second,
+			KeyRetention:            time.Duration(cfg.JWT.KeyRetentionSeconds) * time.Second,
+			JWKSPath: func() string {
+				if cfg.JWT.JWKSPath == "" {
+					return defaultJWKSPath
+				}
+				return cfg.JWT.JWKSPath
+			}(),
+		},
+		Authz: AuthzFeature{
+			Enabled:        cfg.Authz.Enabled,
+			PolicyPath:     cfg.Authz.PolicyPath,
+			ReloadInterval: time.Duration(cfg.Authz.ReloadIntervalSeconds) * time.Second,
 		},
+		CA: func() CAFeature {
+			f := CA()
+			f.Enabled = cfg.CA.Enabled
+			f.CertFile = cfg.CA.CertFile
+			f.KeyFile = cfg.CA.KeyFile
+			f.policyConfig = &cfg.CA.Policy
+			if cfg.CA.DatabasePath != "" {
+				f.DatabasePath = cfg.CA.DatabasePath
+			}
+			if cfg.CA.Path != "" {
+				f.Path = cfg.CA.Path
+			}
+			f.BaseURL = strings.TrimSuffix(cfg.CA.BaseURL, "/")
+			if cfg.CA.CRLValiditySeconds > 0 {
+				f.CRLValidity = time.Duration(cfg.CA.CRLValiditySeconds) * time.Second
+			}
+			return f
+		}(),
 		Health: HealthFeature{
 			Enabled:  cfg.Health.Enabled,
 			Path:     cfg.Health.Path,
@@ -75,11 +125,11 @@ func WithConfig(cfg *AppConfig) Features {
 			enabled:      cfg.Registry.Enabled,
 			registryPath: &cfg.Registry.Path,
 		},
-		Grpc: GrpcFeature{
-			Enabled: cfg.Grpc.Enabled,
-			Port:    cfg.Grpc.Port,
-			Server:  grpc.NewServer(),
-		},
+		Grpc: func() GrpcFeature {
+			f := GRPC(WithGrpcPort(cfg.Grpc.Port))
+			f.Enabled = cfg.Grpc.Enabled
+			return f
+		}(),
 		SQLite: func() SQLiteFeature {
 			f := SQLiteFeature{Enabled: cfg.SQLite.Enabled}
 			for _, db := range cfg.SQLite.Databases {
@@ -99,6 +149,8 @@ type Features struct {
 	Cache      CacheFeature
 	RSA        RSAFeature
 	JWT        JWTFeature
+	Authz      AuthzFeature
+	CA         CAFeature
 	SQL        SQLFeature
 	HTTP       HTTPFeature
 	TLS        TLSFeature
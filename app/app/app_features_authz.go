@@ -0,0 +1,46 @@
+package app
+
+import "time"
+
+const (
+	authz_policyPathOpt     string = "opt-authz-policy-path"
+	authz_reloadIntervalOpt string = "opt-authz-reload-interval"
+)
+
+type authzOpt struct{ featureOpt }
+
+func WithAuthzPolicyPath(path string) authzOpt {
+	return authzOpt{featureOpt{key: authz_policyPathOpt, value: path}}
+}
+
+// WithAuthzReloadInterval sets how often the policy file is checked for
+// changes. Zero disables hot reloading.
+func WithAuthzReloadInterval(interval time.Duration) authzOpt {
+	return authzOpt{featureOpt{key: authz_reloadIntervalOpt, value: interval}}
+}
+
+type AuthzFeature struct {
+	Enabled        bool
+	PolicyPath     string
+	ReloadInterval time.Duration
+}
+
+func (f *AuthzFeature) apply(opt authzOpt) {
+	switch opt.key {
+	case authz_policyPathOpt:
+		f.PolicyPath = opt.value.(string)
+	case authz_reloadIntervalOpt:
+		f.ReloadInterval = opt.value.(time.Duration)
+	}
+}
+
+func Authz(opts ...authzOpt) AuthzFeature {
+	f := AuthzFeature{
+		Enabled:        true,
+		ReloadInterval: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		f.apply(opt)
+	}
+	return f
+}
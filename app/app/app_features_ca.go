@@ -0,0 +1,110 @@
+package app
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ooqls/getset/crypto/ca"
+)
+
+const (
+	ca_certFileOpt     string = "opt-ca-cert-file"
+	ca_keyFileOpt      string = "opt-ca-key-file"
+	ca_databasePathOpt string = "opt-ca-database-path"
+	ca_pathOpt         string = "opt-ca-path"
+	ca_policyOpt       string = "opt-ca-policy"
+	ca_crlValidityOpt  string = "opt-ca-crl-validity"
+	ca_baseURLOpt      string = "opt-ca-base-url"
+
+	caDatabaseName  string = "ca"
+	defaultCAPath   string = "/ca"
+	defaultCADbPath string = "ca.db"
+)
+
+type caOpt struct{ featureOpt }
+
+// WithCACertFile sets the PEM CA certificate to issue with. Without a cert
+// and key file an ephemeral CA is generated on startup, and issued
+// certificates are kept in memory unless a database path is set.
+func WithCACertFile(path string) caOpt {
+	return caOpt{featureOpt{key: ca_certFileOpt, value: path}}
+}
+
+// WithCAKeyFile sets the PEM private key of the CA certificate, an RSA, EC or
+// Ed25519 key in PKCS #1, SEC 1 or PKCS #8 form.
+func WithCAKeyFile(path string) caOpt {
+	return caOpt{featureOpt{key: ca_keyFileOpt, value: path}}
+}
+
+// WithCADatabasePath sets the SQLite file issued certificates are recorded
+// in, ca.db by default, or memory for an ephemeral CA.
+func WithCADatabasePath(path string) caOpt {
+	return caOpt{featureOpt{key: ca_databasePathOpt, value: path}}
+}
+
+// WithCAPath sets the HTTP path the CA is served under.
+func WithCAPath(path string) caOpt {
+	return caOpt{featureOpt{key: ca_pathOpt, value: path}}
+}
+
+// WithCAPolicy sets who may sign and what is issued. Nobody may sign unless
+// the policy lists allowed callers or sets AllowAnyCaller.
+func WithCAPolicy(p ca.Policy) caOpt {
+	return caOpt{featureOpt{key: ca_policyOpt, value: p}}
+}
+
+func WithCACRLValidity(d time.Duration) caOpt {
+	return caOpt{featureOpt{key: ca_crlValidityOpt, value: d}}
+}
+
+// WithCABaseURL sets the external URL the CA is reachable under, e.g.
+// "http://ca.svc.local/ca". Issued certificates then list its CRL and OCSP
+// responder for revocation checks.
+func WithCABaseURL(url string) caOpt {
+	return caOpt{featureOpt{key: ca_baseURLOpt, value: url}}
+}
+
+// CAFeature runs a certificate authority that signs CSRs passing its policy
+// over HTTP, Gin and gRPC, whichever are enabled, and publishes a CRL.
+type CAFeature struct {
+	Enabled      bool
+	CertFile     string
+	KeyFile      string
+	DatabasePath string
+	Path         string
+	Policy       ca.Policy
+	CRLValidity  time.Duration
+	BaseURL      string
+	policyConfig *ca.PolicyConfig
+}
+
+func (f *CAFeature) apply(opt caOpt) {
+	switch opt.key {
+	case ca_certFileOpt:
+		f.CertFile = opt.value.(string)
+	case ca_keyFileOpt:
+		f.KeyFile = opt.value.(string)
+	case ca_databasePathOpt:
+		f.DatabasePath = opt.value.(string)
+	case ca_pathOpt:
+		f.Path = opt.value.(string)
+	case ca_policyOpt:
+		f.Policy = opt.value.(ca.Policy)
+	case ca_crlValidityOpt:
+		f.CRLValidity = opt.value.(time.Duration)
+	case ca_baseURLOpt:
+		f.BaseURL = strings.TrimSuffix(opt.value.(string), "/")
+	}
+}
+
+func CA(opts ...caOpt) CAFeature {
+	f := CAFeature{
+		Enabled:     true,
+		Path:        defaultCAPath,
+		CRLValidity: ca.DefaultCRLValidity,
+	}
+	for _, opt := range opts {
+		f.apply(opt)
+	}
+	return f
+}
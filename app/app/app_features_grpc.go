@@ -1,6 +1,15 @@
 package app
 
-import "google.golang.org/grpc"
+import (
+	"context"
+	"net"
+	"sync/atomic"
+
+	"github.com/ooqls/getset/crypto/mtls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
 
 const (
 	grpc_portOpt   string = "opt-grpc-port"
@@ -17,10 +26,16 @@ func WithGrpcServer(s *grpc.Server) grpcOpt {
 	return grpcOpt{featureOpt{key: grpc_serverOpt, value: s}}
 }
 
+// GrpcFeature serves Server on Port. The default server uses the TLS
+// feature's credentials when it is enabled and stores the identity of client
+// certificates in the context, see mtls.IdentityFromContext. Servers given
+// with WithGrpcServer must configure their own, e.g. with
+// TLSFeature.GrpcCredentials.
 type GrpcFeature struct {
-	Enabled bool
-	Port    int
-	Server  *grpc.Server
+	Enabled     bool
+	Port        int
+	Server      *grpc.Server
+	credentials *grpcCredentials
 }
 
 func (f *GrpcFeature) apply(opt grpcOpt) {
@@ -33,13 +48,57 @@ func (f *GrpcFeature) apply(opt grpcOpt) {
 }
 
 func GRPC(opts ...grpcOpt) GrpcFeature {
+	creds := &grpcCredentials{}
 	f := GrpcFeature{
 		Enabled: true,
 		Port:    9090,
-		Server:  grpc.NewServer(),
+		Server: grpc.NewServer(
+			grpc.Creds(creds),
+			grpc.ChainUnaryInterceptor(mtls.UnaryServerInterceptor(nil)),
+			grpc.ChainStreamInterceptor(mtls.StreamServerInterceptor(nil)),
+		),
+		credentials: creds,
 	}
 	for _, opt := range opts {
 		f.apply(opt)
 	}
 	return f
 }
+
+// grpcCredentials lets the server be created before the TLS feature is
+// started. It serves plaintext until the TLS credentials are set.
+type grpcCredentials struct {
+	creds atomic.Pointer[credentials.TransportCredentials]
+}
+
+func (c *grpcCredentials) set(creds credentials.TransportCredentials) {
+	c.creds.Store(&creds)
+}
+
+func (c *grpcCredentials) current() credentials.TransportCredentials {
+	if creds := c.creds.Load(); creds != nil {
+		return *creds
+	}
+
+	return insecure.NewCredentials()
+}
+
+func (c *grpcCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.current().ClientHandshake(ctx, authority, conn)
+}
+
+func (c *grpcCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.current().ServerHandshake(conn)
+}
+
+func (c *grpcCredentials) Info() credentials.ProtocolInfo {
+	return c.current().Info()
+}
+
+func (c *grpcCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (c *grpcCredentials) OverrideServerName(name string) error {
+	return nil
+}
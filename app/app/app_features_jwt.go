@@ -1,6 +1,10 @@
 package app
 
-import "github.com/ooqls/getset/crypto/jwt"
+import (
+	"time"
+
+	"github.com/ooqls/getset/crypto/jwt"
+)
 
 var jwtPrivKeyPathFlag string
 var jwtPubKeyPathFlag string
@@ -14,6 +18,12 @@ const (
 	jwt_tokenConfigurationOpt     string = "jwt_tokenConfiguration"
 	jwt_privateKeyPathOpt         string = "jwt_privateKeyPath"
 	jwt_publicKeyPathOpt          string = "jwt_publicKeyPath"
+	jwt_rotationIntervalOpt       string = "jwt_rotationInterval"
+	jwt_keyRetentionOpt           string = "jwt_keyRetention"
+	jwt_jwksPathOpt               string = "jwt_jwksPath"
+	jwt_keyAlgorithmOpt           string = "jwt_keyAlgorithm"
+
+	defaultJWKSPath string = "/.well-known/jwks.json"
 )
 
 func WithTokenConfigurationPaths(p []string) jwtOpt {
@@ -52,11 +62,53 @@ func WithJWTPublicKeyPath(p string) jwtOpt {
 	}
 }
 
+// WithJWTKeyRotation rotates the signing key every interval.
+func WithJWTKeyRotation(interval time.Duration) jwtOpt {
+	return jwtOpt{
+		featureOpt: featureOpt{
+			key:   jwt_rotationIntervalOpt,
+			value: interval,
+		},
+	}
+}
+
+// WithJWTKeyRetention sets how long a rotated key is still accepted for
+// verification. Defaults to the longest token validity.
+func WithJWTKeyRetention(retention time.Duration) jwtOpt {
+	return jwtOpt{
+		featureOpt: featureOpt{
+			key:   jwt_keyRetentionOpt,
+			value: retention,
+		},
+	}
+}
+
+// WithJWTKeyAlgorithm sets the algorithm of the signing key generated when no
+// key paths are given and on rotation, e.g. ES256 or EdDSA. Defaults to RS256.
+func WithJWTKeyAlgorithm(alg string) jwtOpt {
+	return jwtOpt{
+		featureOpt: featureOpt{
+			key:   jwt_keyAlgorithmOpt,
+			value: alg,
+		},
+	}
+}
+
+func WithJWKSPath(p string) jwtOpt {
+	return jwtOpt{
+		featureOpt: featureOpt{
+			key:   jwt_jwksPathOpt,
+			value: p,
+		},
+	}
+}
+
 func JWT(opts ...jwtOpt) JWTFeature {
 	f := JWTFeature{
 		Enabled:        true,
 		PrivateKeyPath: jwtPrivKeyPathFlag,
 		PubKeyPath:     jwtPubKeyPathFlag,
+		JWKSPath:       defaultJWKSPath,
 	}
 
 	for _, opt := range opts {
@@ -70,6 +122,10 @@ type JWTFeature struct {
 	Enabled                 bool
 	PrivateKeyPath          string
 	PubKeyPath              string
+	KeyAlgorithm            string
+	RotationInterval        time.Duration
+	KeyRetention            time.Duration
+	JWKSPath                string
 	tokenConfigurationPaths []string
 	tokenConfiguration      []jwt.TokenConfiguration
 }
@@ -84,5 +140,13 @@ func (f *JWTFeature) apply(opt jwtOpt) {
 		f.tokenConfigurationPaths = opt.value.([]string)
 	case jwt_tokenConfigurationOpt:
 		f.tokenConfiguration = opt.value.([]jwt.TokenConfiguration)
+	case jwt_rotationIntervalOpt:
+		f.RotationInterval = opt.value.(time.Duration)
+	case jwt_keyRetentionOpt:
+		f.KeyRetention = opt.value.(time.Duration)
+	case jwt_jwksPathOpt:
+		f.JWKSPath = opt.value.(string)
+	case jwt_keyAlgorithmOpt:
+		f.KeyAlgorithm = opt.value.(string)
 	}
 }
@@ -2,9 +2,14 @@ package app
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
-	"os"
+	"time"
+
+	"github.com/ooqls/getset/crypto/ca"
+	"github.com/ooqls/getset/crypto/mtls"
+	"github.com/ooqls/getset/log"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/credentials"
 )
 
 var (
@@ -20,6 +25,12 @@ const (
 	tls_caBytesOpt  string = "opt-server-ca-bytes"
 	tls_keyFile     string = "opt-server-key-file"
 	tls_keyBytes    string = "opt-server-key-bytes"
+	tls_revocation  string = "opt-revocation-check"
+	tls_softFail    string = "opt-revocation-soft-fail"
+	tls_reload      string = "opt-tls-reload-interval"
+	tls_clientAuth  string = "opt-client-auth"
+	tls_allowedSANs string = "opt-allowed-client-sans"
+	tls_devCertDir  string = "opt-dev-cert-dir"
 )
 
 type tlsOpt struct {
@@ -98,6 +109,78 @@ func WithKeyBytes(b []byte) tlsOpt {
 	}
 }
 
+// WithRevocationCheck checks peer certificates against their CRLs or OCSP
+// responders, both client certificates of the servers and the certificates
+// of servers the app's http client connects to.
+func WithRevocationCheck(mode ca.RevocationMode) tlsOpt {
+	return tlsOpt{
+		featureOpt: featureOpt{
+			key:   tls_revocation,
+			value: mode,
+		},
+	}
+}
+
+// WithRevocationSoftFail accepts peers whose revocation status can not be
+// fetched.
+func WithRevocationSoftFail(softFail bool) tlsOpt {
+	return tlsOpt{
+		featureOpt: featureOpt{
+			key:   tls_softFail,
+			value: softFail,
+		},
+	}
+}
+
+// WithTLSReloadInterval sets how often the cert, key and CA files are checked
+// for rotated certificates, zero disables reloading.
+func WithTLSReloadInterval(d time.Duration) tlsOpt {
+	return tlsOpt{
+		featureOpt: featureOpt{
+			key:   tls_reload,
+			value: d,
+		},
+	}
+}
+
+// WithClientAuth sets whether the servers ask clients for certificates.
+// Verifying modes need a CA, client certificates are only trusted if the CA
+// signed them.
+func WithClientAuth(mode mtls.ClientAuthMode) tlsOpt {
+	return tlsOpt{
+		featureOpt: featureOpt{
+			key:   tls_clientAuth,
+			value: mode,
+		},
+	}
+}
+
+// WithAllowedClientSANs rejects the handshake of clients whose certificate
+// has none of the SANs, see mtls.AllowList for the patterns. It needs the
+// require or verify-if-given client auth mode, with the latter clients
+// without certificate are rejected as well.
+func WithAllowedClientSANs(sans ...string) tlsOpt {
+	return tlsOpt{
+		featureOpt: featureOpt{
+			key:   tls_allowedSANs,
+			value: mtls.AllowList(sans),
+		},
+	}
+}
+
+// WithDevCertificates serves a localhost certificate of a development CA
+// when no server cert and key are given. Both are created in dir on first
+// use and reused across runs, the app's http client trusts the CA. Not meant
+// for production.
+func WithDevCertificates(dir string) tlsOpt {
+	return tlsOpt{
+		featureOpt: featureOpt{
+			key:   tls_devCertDir,
+			value: dir,
+		},
+	}
+}
+
 type TLSFeature struct {
 	Enabled         bool
 	CAFile          string
@@ -106,49 +189,170 @@ type TLSFeature struct {
 	ServerCertBytes []byte
 	ServerKeyBytes  []byte
 	ServerKeyFile   string
+
+	RevocationCheck    ca.RevocationMode
+	RevocationSoftFail bool
+	revocationChecker  *ca.RevocationChecker
+
+	ClientAuth        mtls.ClientAuthMode
+	AllowedClientSANs mtls.AllowList
+
+	// DevCertDir holds the development CA and certificate, see
+	// WithDevCertificates.
+	DevCertDir string
+
+	// ReloadInterval is how often the cert, key and CA files are checked for
+	// changes, zero disables reloading.
+	ReloadInterval time.Duration
+	certReloader   *certReloader
 }
 
-func (f *TLSFeature) TLSConfig() (*tls.Config, error) {
-	pool, err := x509.SystemCertPool()
+// verifyConnection returns the revocation check of the feature, nil if it is
+// disabled.
+func (f *TLSFeature) verifyConnection() (func(tls.ConnectionState) error, error) {
+	mode, err := ca.ParseRevocationMode(string(f.RevocationCheck))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get system cert pool: %v", err)
+		return nil, err
 	}
 
-	cfg := &tls.Config{
-		RootCAs: pool,
+	if mode == ca.RevocationCheckNone {
+		return nil, nil
 	}
 
-	if f.CAFile != "" {
-		b, err := os.ReadFile(f.CAFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read ca file %s: %v", f.CAFile, err)
-		}
+	if f.revocationChecker == nil {
+		f.revocationChecker = ca.NewRevocationChecker(mode, ca.WithSoftFail(f.RevocationSoftFail))
+	}
 
-		ok := pool.AppendCertsFromPEM(b)
-		if !ok {
-			return nil, fmt.Errorf("failed to add pem bytes from ca file %s", f.CAFile)
-		}
+	return f.revocationChecker.VerifyConnection, nil
+}
+
+// serverConfig returns the client auth settings of the servers.
+func (f *TLSFeature) serverConfig() (*tls.Config, error) {
+	auth, err := f.ClientAuth.TLSClientAuth()
+	if err != nil {
+		return nil, err
 	}
 
-	if len(f.ServerCertFile) > 0 && len(f.ServerKeyFile) > 0 {
-		cert, err := tls.LoadX509KeyPair(f.ServerCertFile, f.ServerKeyFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load x509 key pair: %v", err)
-		}
-		cfg.Certificates = append(cfg.Certificates, cert)
-	} else if len(f.ServerCertBytes) > 0 && len(f.ServerKeyBytes) > 0 {
-		cert, err := tls.X509KeyPair(f.ServerCertBytes, f.ServerKeyBytes)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load x509 key pair: %v", err)
+	if f.ClientAuth.Verifies() && len(f.CABytes) == 0 && f.CAFile == "" {
+		return nil, fmt.Errorf("client auth %s needs a CA to verify client certificates", f.ClientAuth)
+	}
+
+	if len(f.AllowedClientSANs) > 0 && !f.ClientAuth.Verifies() {
+		return nil, fmt.Errorf("allowed client SANs need client auth %s or %s", mtls.ClientAuthRequire, mtls.ClientAuthVerifyIfGiven)
+	}
+
+	verify, err := f.verifyConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{ClientAuth: auth, VerifyConnection: verify}
+	if allow := f.AllowedClientSANs; len(allow) > 0 {
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if err := allow.VerifyConnection(cs); err != nil {
+				return err
+			}
+
+			if verify != nil {
+				return verify(cs)
+			}
+			return nil
 		}
-		cfg.Certificates = append(cfg.Certificates, cert)
 	}
 
 	return cfg, nil
 }
+
+// useDevCertificates fills in the development certificates when a dev cert
+// dir is set and no server cert and key are given.
+func (f *TLSFeature) useDevCertificates(l *zap.Logger) error {
+	noCert := len(f.ServerCertBytes) == 0 && f.ServerCertFile == ""
+	noKey := len(f.ServerKeyBytes) == 0 && f.ServerKeyFile == ""
+	if f.DevCertDir == "" || !noCert || !noKey {
+		return nil
+	}
+
+	l.Warn("[TLS] no server cert given, using development certificates", zap.String("dir", f.DevCertDir))
+	dev, err := bootstrapDevCertificates(f.DevCertDir, l)
+	if err != nil {
+		return fmt.Errorf("failed to bootstrap dev certificates: %v", err)
+	}
+
+	f.ServerCertFile, f.ServerKeyFile = dev.CertFile, dev.KeyFile
+	if len(f.CABytes) == 0 && f.CAFile == "" {
+		f.CAFile = dev.CAFile
+	}
+
+	return nil
+}
+
+// reloader loads the key pair and CA of the feature on first use, after
+// bootstrapping the development certificates if needed. All servers share
+// it, so they swap to rotated certificates together.
+func (f *TLSFeature) reloader() (*certReloader, error) {
+	if f.certReloader != nil {
+		return f.certReloader, nil
+	}
+
+	l := log.NewLogger("tls")
+	if err := f.useDevCertificates(l); err != nil {
+		return nil, err
+	}
+
+	server, err := f.serverConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cert := certSource{file: f.ServerCertFile, bytes: f.ServerCertBytes}
+	key := certSource{file: f.ServerKeyFile, bytes: f.ServerKeyBytes}
+	ca := certSource{file: f.CAFile, bytes: f.CABytes}
+	f.certReloader, err = newCertReloader(cert, key, ca, server, l)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.certReloader, nil
+}
+
+// TLSConfig returns a config that serves the current key pair and CA pool
+// for every handshake, see WithTLSReloadInterval. Used by clients it trusts
+// the CA pool at the time of the call, the app's HTTP client follows CA
+// rotations.
+func (f *TLSFeature) TLSConfig() (*tls.Config, error) {
+	r, err := f.reloader()
+	if err != nil {
+		return nil, err
+	}
+
+	verify, err := f.verifyConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		RootCAs:              r.rootCAs(),
+		GetConfigForClient:   r.getConfigForClient,
+		GetClientCertificate: r.getClientCertificate,
+		VerifyConnection:     verify,
+	}, nil
+}
+
+// GrpcCredentials returns the credentials of TLSConfig for gRPC servers
+// given with WithGrpcServer, the default server uses them already.
+func (f *TLSFeature) GrpcCredentials() (credentials.TransportCredentials, error) {
+	cfg, err := f.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials.NewTLS(cfg), nil
+}
+
 func TLS(opts ...tlsOpt) TLSFeature {
 	f := TLSFeature{
-		Enabled: true,
+		Enabled:        true,
+		ReloadInterval: defaultTLSReloadInterval,
 	}
 
 	for _, opt := range opts {
@@ -165,6 +369,18 @@ func TLS(opts ...tlsOpt) TLSFeature {
 			f.ServerKeyFile = opt.value.(string)
 		case tls_keyBytes:
 			f.ServerKeyBytes = opt.value.([]byte)
+		case tls_revocation:
+			f.RevocationCheck = opt.value.(ca.RevocationMode)
+		case tls_softFail:
+			f.RevocationSoftFail = opt.value.(bool)
+		case tls_reload:
+			f.ReloadInterval = opt.value.(time.Duration)
+		case tls_clientAuth:
+			f.ClientAuth = opt.value.(mtls.ClientAuthMode)
+		case tls_allowedSANs:
+			f.AllowedClientSANs = opt.value.(mtls.AllowList)
+		case tls_devCertDir:
+			f.DevCertDir = opt.value.(string)
 		}
 	}
 
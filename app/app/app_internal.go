@@ -2,8 +2,7 @@ package app
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
@@ -13,8 +12,11 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/ooqls/getset/cache/factory"
+	"github.com/ooqls/getset/crypto/authz"
+	"github.com/ooqls/getset/crypto/ca"
 	"github.com/ooqls/getset/crypto/jwt"
 	"github.com/ooqls/getset/crypto/keys"
+	"github.com/ooqls/getset/crypto/mtls"
 	"github.com/ooqls/getset/db/redis"
 	dbsqlite "github.com/ooqls/getset/db/sqlite"
 	"github.com/ooqls/getset/db/valkey"
@@ -36,6 +38,7 @@ func (a *App) _start_http_server(ctx *AppContext, handler http.Handler, port int
 			return err
 		}
 		srv.TLSConfig = tlsConfig
+		srv.Handler = mtls.HTTPIdentity(nil, handler)
 	}
 
 	a.threadWg.Add(1)
@@ -101,80 +104,62 @@ func (a *App) _startup_docs(ctx *AppContext) error {
 }
 
 func (a *App) _startup_tls(ctx *AppContext) error {
-	f := a.features.TLS
+	f := &a.features.TLS
 	l := ctx.L()
-	cfg := &tls.Config{}
 
-	pool, err := x509.SystemCertPool()
+	// servers started before this step may have loaded the key pair already,
+	// the reloader bootstraps dev certificates on first use
+	l.Info("[Startup TLS] Loading key pair...")
+	r, err := f.reloader()
 	if err != nil {
-		return fmt.Errorf("failed to get system cert pool: %v", err)
+		return fmt.Errorf("failed to load key pair: %v", err)
 	}
 
 	if len(f.CABytes) > 0 {
 		l.Info("[Startup TLS] using CA bytes in tls config")
-		ok := pool.AppendCertsFromPEM(f.CABytes)
-		if !ok {
-			return fmt.Errorf("failed to append all ca bytes")
-		}
 	} else if f.CAFile != "" {
 		l.Info("[Startup TLS] Using CA file for tls config", zap.String("ca", f.CAFile))
-		b, err := os.ReadFile(f.CAFile)
-		if err != nil {
-			return fmt.Errorf("failed to read ca file %s: %v", f.CAFile, err)
-		}
-
-		ok := pool.AppendCertsFromPEM(b)
-		if !ok {
-			return fmt.Errorf("failed to add pem bytes from ca file %s", f.CAFile)
-		}
 	} else {
 		l.Info("[Startup TLS] No CA given")
 	}
-	cfg.ClientCAs = pool
-	cfg.RootCAs = pool
-
-	var tlsCert tls.Certificate
-	var keyBytes []byte
-	var certBytes []byte
 
 	if len(f.ServerCertBytes) > 0 {
 		l.Info("[Startup TLS] server cert bytes given")
-		certBytes = f.ServerCertBytes
 	} else if f.ServerCertFile != "" {
 		l.Info("[Startup TLS] server cert file given", zap.String("cert_file", f.ServerCertFile))
-		certBytes, err = os.ReadFile(f.ServerCertFile)
-		if err != nil {
-			return fmt.Errorf("failed to read cert file %s: %v", f.ServerCertFile, err)
-		}
-	} else {
-		return fmt.Errorf("no server cert given for TLS")
 	}
 
 	if len(f.ServerKeyBytes) > 0 {
 		l.Info("[Startup TLS] server key bytes given")
-		keyBytes = f.ServerKeyBytes
 	} else if f.ServerKeyFile != "" {
 		l.Info("[Startup TLS] server key file given", zap.String("key_file", f.ServerKeyFile))
-		keyBytes, err = os.ReadFile(f.ServerKeyFile)
-		if err != nil {
-			return fmt.Errorf("failed to read key file %s: %v", f.ServerKeyFile, err)
-		}
-	} else {
-		return fmt.Errorf("no server key gven for tls")
 	}
 
-	if len(keyBytes) > 0 && len(certBytes) > 0 {
-		l.Info("[Startup TLS] Loading key pair...")
-		tlsCert, err = tls.X509KeyPair(certBytes, keyBytes)
-		if err != nil {
-			return fmt.Errorf("failed to load key pair: %v", err)
-		}
-		cfg.Certificates = append(cfg.Certificates, tlsCert)
+	verify, err := f.verifyConnection()
+	if err != nil {
+		return err
+	}
+	if verify != nil {
+		l.Info("[Startup TLS] checking peer certificate revocation",
+			zap.String("mode", string(f.RevocationCheck)), zap.Bool("soft_fail", f.RevocationSoftFail))
+	}
+	if f.ClientAuth != mtls.ClientAuthNone {
+		l.Info("[Startup TLS] requesting client certificates",
+			zap.String("client_auth", string(f.ClientAuth)), zap.Strings("allowed_sans", f.AllowedClientSANs))
+	}
+
+	if f.ReloadInterval > 0 && (f.ServerCertFile != "" || f.CAFile != "") {
+		l.Info("[Startup TLS] watching certificate files for changes", zap.Duration("interval", f.ReloadInterval))
+		a.threadWg.Add(1)
+		go func() {
+			defer a.threadWg.Done()
+			r.watch(ctx, f.ReloadInterval)
+		}()
 	}
 
 	a.httpClient = &http.Client{
 		Transport: &http.Transport{
-			TLSClientConfig: cfg,
+			DialTLSContext: r.dialTLSContext(verify),
 		},
 	}
 
@@ -276,6 +261,24 @@ func (a *App) _startup_jwt(ctx *AppContext) error {
 	privKeyPath := a.features.JWT.PrivateKeyPath
 	pubKeyPath := a.features.JWT.PubKeyPath
 
+	for _, configPath := range configPaths {
+		if !fileExists(configPath) {
+			l.Error("[Startup JWT] JWT token config file not found", zap.String("path", configPath))
+			return fmt.Errorf("JWT token config file not found: %s", configPath)
+		}
+
+		config, err := jwt.ParseTokenConfigFile(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to parse token config file %s: %v", configPath, err)
+		}
+		ctx.issuerToTokenConfigs[config.Issuer] = *config
+	}
+
+	for _, cfg := range configs {
+		ctx.issuerToTokenConfigs[cfg.Issuer] = cfg
+	}
+
+	var jwtKey *keys.JwtKey
 	if privKeyPath != "" && pubKeyPath != "" {
 
 		if !fileExists(privKeyPath) {
@@ -293,40 +296,206 @@ func (a *App) _startup_jwt(ctx *AppContext) error {
 		)
 		jwtPrivKey := mustReadFile(privKeyPath)
 		jwtPubKey := mustReadFile(pubKeyPath)
-		if err := keys.InitJwt(jwtPrivKey, jwtPubKey); err != nil {
+		var err error
+		jwtKey, err = keys.ParseJwtKey(jwtPrivKey, jwtPubKey)
+		if err != nil {
 			return err
 		}
 
-		a.state.JWTInitialized = true
 		l.Debug("[Startup JWT] JWT keys initialized successfully")
 	} else {
-		l.Debug("[Startup JWT] no JWT key paths provided, creating a key...")
-		rsaKey, err := keys.NewRSA()
+		l.Debug("[Startup JWT] no JWT key paths provided, creating a key...",
+			zap.String("algorithm", a.features.JWT.KeyAlgorithm))
+		var err error
+		jwtKey, err = keys.GenerateJWTKey(a.features.JWT.KeyAlgorithm)
 		if err != nil {
 			return err
 		}
-		jwtKey := keys.NewJWTKey(*rsaKey)
+	}
+
+	if interval := a.features.JWT.RotationInterval; interval > 0 {
+		retention := a.features.JWT.KeyRetention
+		if retention == 0 {
+			for _, cfg := range ctx.issuerToTokenConfigs {
+				validity := time.Duration(cfg.ValidityDurationSeconds) * time.Second
+				if validity > retention {
+					retention = validity
+				}
+			}
+		}
+
+		l.Info("[Startup JWT] rotating JWT keys",
+			zap.Duration("interval", interval), zap.Duration("retention", retention))
+		ring := keys.NewKeyRing(jwtKey, retention)
+		keys.SetJwtSigningKey(ring)
+
+		a.threadWg.Add(1)
+		go func() {
+			defer a.threadWg.Done()
+			ring.RunRotation(ctx, interval)
+		}()
+	} else {
 		keys.SetJwt(jwtKey)
 	}
 
-	for _, configPath := range configPaths {
-		if !fileExists(configPath) {
-			l.Error("[Startup JWT] JWT token config file not found", zap.String("path", configPath))
-			return fmt.Errorf("JWT token config file not found: %s", configPath)
+	if a.features.JWT.JWKSPath != "" {
+		a._startup_jwks(ctx)
+	}
+
+	a.state.JWTInitialized = true
+	return nil
+}
+
+// _startup_jwks serves the public JWT keys so other services can verify the
+// tokens we issue. The key set is read on every request to reflect rotation.
+func (a *App) _startup_jwks(ctx *AppContext) {
+	l := ctx.L()
+	path := a.features.JWT.JWKSPath
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		if err := json.NewEncoder(w).Encode(keys.JWT().JWKS()); err != nil {
+			l.Error("[JWKS] failed to encode key set", zap.Error(err))
 		}
+	}
 
-		config, err := jwt.ParseTokenConfigFile(configPath)
+	if a.features.HTTP.Enabled {
+		l.Info("[Startup JWT] serving JWKS on http", zap.String("path", path))
+		a.features.HTTP.Mux.HandleFunc(path, handler)
+	}
+
+	if a.features.Gin.Enabled {
+		l.Info("[Startup JWT] serving JWKS on gin", zap.String("path", path))
+		a.features.Gin.Engine.GET(path, gin.WrapF(handler))
+	}
+}
+
+func (a *App) _startup_authz(ctx *AppContext) error {
+	l := ctx.L()
+
+	policy := &authz.Policy{}
+	path := a.features.Authz.PolicyPath
+	if path != "" {
+		if !fileExists(path) {
+			l.Error("[Startup Authz] policy file not found", zap.String("path", path))
+			return fmt.Errorf("authz policy file not found: %s", path)
+		}
+
+		p, err := authz.ParsePolicyFile(path)
 		if err != nil {
-			return fmt.Errorf("failed to parse token config file %s: %v", configPath, err)
+			return err
 		}
-		ctx.issuerToTokenConfigs[config.Issuer] = *config
+		policy = p
 	}
 
-	for _, cfg := range configs {
-		ctx.issuerToTokenConfigs[cfg.Issuer] = cfg
+	// grants do not expire, they are removed with StoreResolver.Revoke
+	grants := authz.NewStoreResolver(ctx.CacheFactory().NewStore(grantsStoreKey, 0))
+	ctx.authorizer = authz.NewAuthorizer(policy, authz.WithResolver(grants))
+	ctx.grants = grants
+
+	if path != "" && a.features.Authz.ReloadInterval > 0 {
+		l.Debug("[Startup Authz] watching policy file", zap.String("path", path), zap.Duration("interval", a.features.Authz.ReloadInterval))
+		a.threadWg.Add(1)
+		go func() {
+			defer a.threadWg.Done()
+			ctx.authorizer.WatchPolicyFile(ctx, path, a.features.Authz.ReloadInterval)
+		}()
 	}
 
-	a.state.JWTInitialized = true
+	a.state.AuthzInitialized = true
+	return nil
+}
+
+// _startup_ca loads or generates the CA, opens its certificate database and
+// serves it on the enabled servers. It runs after Gin so CORS applies.
+func (a *App) _startup_ca(ctx *AppContext) error {
+	l := ctx.L()
+	f := a.features.CA
+
+	var caKey *keys.X509
+	if f.CertFile != "" && f.KeyFile != "" {
+		l.Info("[Startup CA] loading CA key pair",
+			zap.String("cert_file", f.CertFile), zap.String("key_file", f.KeyFile))
+		certB, err := os.ReadFile(f.CertFile)
+		if err != nil {
+			return fmt.Errorf("failed to read ca cert file %s: %v", f.CertFile, err)
+		}
+
+		keyB, err := os.ReadFile(f.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read ca key file %s: %v", f.KeyFile, err)
+		}
+
+		if err := keys.InitCA(keyB, certB); err != nil {
+			return fmt.Errorf("failed to load ca key pair: %v", err)
+		}
+		caKey = keys.CA()
+	} else {
+		l.Warn("[Startup CA] no CA key pair given, generating an ephemeral CA")
+		var err error
+		caKey, err = keys.CreateX509CA(keys.WithCommonName(a.appName + " CA"))
+		if err != nil {
+			return fmt.Errorf("failed to create ca: %v", err)
+		}
+		keys.SetCA(caKey)
+	}
+
+	policy := f.Policy
+	if f.policyConfig != nil {
+		p, err := f.policyConfig.Policy()
+		if err != nil {
+			return fmt.Errorf("failed to parse ca policy: %v", err)
+		}
+		policy = *p
+	}
+	if !policy.AllowAnyCaller && len(policy.AllowedCallers) == 0 {
+		l.Warn("[Startup CA] no callers are allowed to sign, set the policy's allowed callers to issue certificates")
+	}
+
+	dbPath := f.DatabasePath
+	if dbPath == "" {
+		// certificates of an ephemeral CA are useless after a restart
+		dbPath = defaultCADbPath
+		if f.CertFile == "" || f.KeyFile == "" {
+			dbPath = dbsqlite.MemoryPath
+		}
+	}
+
+	l.Debug("[Startup CA] opening certificate database", zap.String("path", dbPath))
+	if err := dbsqlite.Init(caDatabaseName, dbPath, ca.Schema); err != nil {
+		return err
+	}
+
+	var crlURLs, ocspURLs []string
+	if f.BaseURL != "" {
+		l.Info("[Startup CA] publishing revocation endpoints", zap.String("base_url", f.BaseURL))
+		crlURLs = []string{f.BaseURL + "/crl"}
+		ocspURLs = []string{f.BaseURL + "/ocsp"}
+	}
+
+	authority := ca.NewAuthority(caKey, ca.NewSQLStore(dbsqlite.MustGet(caDatabaseName)), policy,
+		ca.WithCRLValidity(f.CRLValidity),
+		ca.WithCRLDistributionPoints(crlURLs...),
+		ca.WithOCSPServers(ocspURLs...))
+	ctx.authority = authority
+
+	handler := http.StripPrefix(f.Path, ca.Handler(authority))
+	if a.features.HTTP.Enabled {
+		l.Info("[Startup CA] serving CA on http", zap.String("path", f.Path))
+		a.features.HTTP.Mux.Handle(f.Path+"/", handler)
+	}
+
+	if a.features.Gin.Enabled {
+		l.Info("[Startup CA] serving CA on gin", zap.String("path", f.Path))
+		a.features.Gin.Engine.Any(f.Path+"/*any", gin.WrapH(handler))
+	}
+
+	if a.features.Grpc.Enabled {
+		l.Info("[Startup CA] serving CA on grpc", zap.String("service", ca.GrpcServiceName))
+		ca.RegisterGrpc(a.features.Grpc.Server, authority)
+	}
+
+	a.state.CAInitialized = true
 	return nil
 }
 
@@ -434,6 +603,9 @@ func (a *App) _startup_gin(ctx *AppContext) error {
 	if a.features.Gin.Cors != nil {
 		a.features.Gin.Engine.Use(cors.New(*a.features.Gin.Cors))
 	}
+	if a.features.TLS.Enabled {
+		a.features.Gin.Engine.Use(mtls.GinIdentity(nil))
+	}
 	a.state.GinInitialized = true
 	return nil
 }
@@ -518,6 +690,15 @@ func (a *App) _run_grpc(ctx *AppContext) error {
 	l := a.l
 	srv := a.features.Grpc.Server
 
+	if a.features.TLS.Enabled && a.features.Grpc.credentials != nil {
+		creds, err := a.features.TLS.GrpcCredentials()
+		if err != nil {
+			l.Error("[Running gRPC] Failed to get TLS credentials", zap.Error(err))
+			return err
+		}
+		a.features.Grpc.credentials.set(creds)
+	}
+
 	lis, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", a.features.Grpc.Port))
 	if err != nil {
 		l.Error("[Running gRPC] failed to listen", zap.Int("port", a.features.Grpc.Port), zap.Error(err))
@@ -636,6 +817,16 @@ func (a *App) _startup(ctx context.Context) error {
 		startup_funcs = append(startup_funcs, a._startup_cache)
 	}
 
+	if a.features.Authz.Enabled {
+		l.Info("[Startup] Authz enabled")
+		startup_funcs = append(startup_funcs, a._startup_authz)
+	}
+
+	if a.features.CA.Enabled {
+		l.Info("[Startup] CA enabled")
+		startup_funcs = append(startup_funcs, a._startup_ca)
+	}
+
 	if a.features.Docs.Enabled {
 		l.Info("[Startup] Docs enabled")
 		startup_funcs = append(startup_funcs, a._startup_docs)
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/ooqls/getset/crypto/keys"
 	"github.com/ooqls/getset/db/pgx"
 	"github.com/ooqls/getset/db/postgres"
 	gosqlx "github.com/ooqls/getset/db/sqlx"
@@ -75,7 +76,7 @@ func (a *App) _startup_sql(ctx *AppContext) error {
 				return pwErr
 			}
 			opts := postgres.GetRegistryOptions()
-			opts.Pw = string(b)
+			opts.Pw = keys.NewSecret(b)
 			sqlOpts = &opts
 		}
 
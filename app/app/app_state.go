@@ -3,6 +3,8 @@ package app
 type AppState struct {
 	RegistryInitialized   bool
 	JWTInitialized        bool
+	AuthzInitialized      bool
+	CAInitialized         bool
 	RSAInitialized        bool
 	LoggingAPIInitialized bool
 	CacheInitialized      bool
@@ -1,21 +1,38 @@
 package app
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/ooqls/getset/crypto/authz"
+	"github.com/ooqls/getset/crypto/ca"
 	"github.com/ooqls/getset/crypto/jwt"
 	"github.com/ooqls/getset/crypto/keys"
+	"github.com/ooqls/getset/crypto/mtls"
 	"github.com/ooqls/getset/db/pgx"
 	"github.com/ooqls/getset/db/redis"
 	"github.com/ooqls/getset/registry"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"gopkg.in/yaml.v2"
 )
 
@@ -85,6 +102,300 @@ func TestAppWithRegistry(t *testing.T) {
 
 }
 
+func TestAppJWKS(t *testing.T) {
+	app := New("test", Features{
+		JWT:  JWT(WithJWTKeyRotation(time.Hour)),
+		HTTP: HTTP(WithHttpPort(8083)),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		err := app.Run(ctx)
+		assert.Nilf(t, err, "expected no error, got %v", err)
+		wg.Done()
+	}()
+	assert.Eventually(t, app.IsRunning, 5*time.Second, 100*time.Millisecond, "expected app to be running")
+
+	var jwks keys.JWKSet
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get("http://localhost:8083/.well-known/jwks.json")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		return json.NewDecoder(resp.Body).Decode(&jwks) == nil
+	}, 5*time.Second, 100*time.Millisecond, "expected to get the jwks document")
+
+	assert.Len(t, jwks.Keys, 1)
+	_, token, err := keys.JWT().Sign(jwt.ClaimsWrapper[string]{})
+	assert.Nil(t, err)
+	assert.Equal(t, jwks.Keys[0].Kid, token.Header["kid"])
+
+	cancel()
+	wg.Wait()
+}
+
+func TestAppAuthz(t *testing.T) {
+	policyPath := filepath.Join(t.TempDir(), "policy.yaml")
+	err := os.WriteFile(policyPath, []byte("roles:\n  viewer:\n    permissions: [\"orders:read\"]\n"), 0600)
+	assert.Nil(t, err)
+
+	app := New("test", Features{
+		Authz: Authz(WithAuthzPolicyPath(policyPath), WithAuthzReloadInterval(0)),
+	})
+
+	var authorizer *authz.Authorizer
+	var grants *authz.StoreResolver
+	app.OnStartup(func(ctx *AppContext) error {
+		authorizer, _ = ctx.Authorizer()
+		grants, _ = ctx.Grants()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		err := app.Run(ctx)
+		assert.Nilf(t, err, "expected no error, got %v", err)
+		wg.Done()
+	}()
+	assert.Eventually(t, app.IsRunning, 5*time.Second, 100*time.Millisecond, "expected app to be running")
+
+	assert.NotNil(t, authorizer)
+	viewer := &authz.Principal{Subject: "1", Roles: []string{"viewer"}}
+	assert.Nil(t, authorizer.Authorize(ctx, viewer, "orders:read"))
+	assert.ErrorIs(t, authorizer.Authorize(ctx, viewer, "orders:write"), authz.ErrPermissionDenied)
+
+	assert.Nil(t, grants.Grant(ctx, "1", authz.Grants{Permissions: []string{"orders:write"}}))
+	assert.Nil(t, authorizer.Authorize(ctx, viewer, "orders:write"))
+
+	cancel()
+	wg.Wait()
+}
+
+func TestAppCA(t *testing.T) {
+	app := New("test", Features{
+		CA: CA(
+			WithCAPolicy(ca.Policy{AllowAnyCaller: true, AllowedDNSNames: []string{"*.svc.local"}}),
+			WithCABaseURL("http://localhost:8084/ca/"),
+		),
+		HTTP: HTTP(WithHttpPort(8084)),
+	})
+
+	authorities := make(chan *ca.Authority, 1)
+	app.OnStartup(func(ctx *AppContext) error {
+		authority, _ := ctx.CA()
+		authorities <- authority
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		err := app.Run(ctx)
+		assert.Nilf(t, err, "expected no error, got %v", err)
+		wg.Done()
+	}()
+	assert.Eventually(t, app.IsRunning, 5*time.Second, 100*time.Millisecond, "expected app to be running")
+	authority := <-authorities
+	assert.NotNil(t, authority)
+	_, err := os.Stat(defaultCADbPath)
+	assert.Truef(t, os.IsNotExist(err), "an ephemeral CA should keep its certificates in memory")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"orders.svc.local"}}, key)
+	assert.Nil(t, err)
+
+	var crtPem []byte
+	assert.Eventually(t, func() bool {
+		resp, err := http.Post("http://localhost:8084/ca/sign", "application/pkcs10",
+			bytes.NewReader(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})))
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+
+		buf := bytes.Buffer{}
+		buf.ReadFrom(resp.Body)
+		crtPem = buf.Bytes()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 100*time.Millisecond, "expected the CA to sign the csr")
+
+	block, _ := pem.Decode(crtPem)
+	if assert.NotNil(t, block) {
+		crt, err := x509.ParseCertificate(block.Bytes)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"orders.svc.local"}, crt.DNSNames)
+		caCrt := authority.Certificate()
+		assert.Nil(t, crt.CheckSignatureFrom(&caCrt))
+		assert.Equal(t, []string{"http://localhost:8084/ca/ocsp"}, crt.OCSPServer)
+		assert.Equal(t, []string{"http://localhost:8084/ca/crl"}, crt.CRLDistributionPoints)
+
+		checker := ca.NewRevocationChecker(ca.RevocationCheckOCSP)
+		assert.Nilf(t, checker.Check(ctx, crt, &caCrt), "should check revocation against the served responder")
+		assert.Nil(t, authority.Revoke(ctx, crt.SerialNumber, 1))
+		assert.ErrorIs(t, ca.NewRevocationChecker(ca.RevocationCheckCRL).Check(ctx, crt, &caCrt), ca.ErrCertificateRevoked)
+	}
+
+	cancel()
+	wg.Wait()
+}
+
+func TestAppMTLS(t *testing.T) {
+	caKey, err := keys.CreateX509CA()
+	assert.Nil(t, err)
+	_, caPem := caKey.Pem()
+	srvPair, err := keys.CreateX509(*caKey, keys.WithDNSNames([]string{"localhost"}))
+	assert.Nil(t, err)
+	srvKey, srvCrt := srvPair.Pem()
+
+	clientCert := func(dnsName string) tls.Certificate {
+		pair, err := keys.CreateX509(*caKey, keys.WithDNSNames([]string{dnsName}),
+			keys.WithExtKeyUsage([]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}))
+		assert.Nil(t, err)
+		key, crt := pair.Pem()
+		cert, err := tls.X509KeyPair(crt, key)
+		assert.Nil(t, err)
+		return cert
+	}
+
+	app := New("test", Features{
+		TLS: TLS(WithCaBytes(caPem), WithServerCertBytes(srvCrt), WithServerKeyBytes(srvKey),
+			WithClientAuth(mtls.ClientAuthRequire), WithAllowedClientSANs("*.svc.local")),
+		HTTP: HTTP(WithHttpPort(8085)),
+		Grpc: GRPC(WithGrpcPort(9095)),
+	})
+	healthpb.RegisterHealthServer(app.Features().Grpc.Server, health.NewServer())
+	app.Features().HTTP.Mux.HandleFunc("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := mtls.IdentityFromContext(r.Context()); ok {
+			w.Write([]byte(id.DNSNames[0]))
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		err := app.Run(ctx)
+		assert.Nilf(t, err, "expected no error, got %v", err)
+		wg.Done()
+	}()
+	assert.Eventually(t, app.IsRunning, 5*time.Second, 100*time.Millisecond, "expected app to be running")
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caPem)
+	whoami := func(certs ...tls.Certificate) (string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs}}}
+		resp, err := client.Get("https://localhost:8085/whoami")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		buf := bytes.Buffer{}
+		buf.ReadFrom(resp.Body)
+		return buf.String(), nil
+	}
+
+	var name string
+	assert.Eventually(t, func() bool {
+		name, err = whoami(clientCert("orders.svc.local"))
+		return err == nil
+	}, 5*time.Second, 100*time.Millisecond, "expected the server to accept the client certificate")
+	assert.Equal(t, "orders.svc.local", name)
+
+	_, err = whoami()
+	assert.NotNilf(t, err, "should require a client certificate")
+	_, err = whoami(clientCert("orders.example.com"))
+	assert.NotNilf(t, err, "should reject clients not on the allow list")
+
+	check := func(certs ...tls.Certificate) error {
+		conn, err := grpc.NewClient("localhost:9095",
+			grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool, Certificates: certs})))
+		assert.Nil(t, err)
+		defer conn.Close()
+		_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		return err
+	}
+	assert.Nilf(t, check(clientCert("orders.svc.local")), "should serve gRPC with the TLS credentials")
+	assert.NotNilf(t, check(), "should require a client certificate for gRPC")
+
+	cancel()
+	wg.Wait()
+}
+
+func TestAppDevTLS(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tls")
+	// the logging API starts its server before the TLS step runs
+	app := New("test", Features{
+		TLS:        TLS(WithDevCertificates(dir)),
+		HTTP:       HTTP(WithHttpPort(8086)),
+		LoggingAPI: LoggingApi(WithLoggingApiPort(8087)),
+	})
+	app.Features().HTTP.Mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		err := app.Run(ctx)
+		assert.Nilf(t, err, "expected no error, got %v", err)
+		wg.Done()
+	}()
+	assert.Eventually(t, app.IsRunning, 5*time.Second, 100*time.Millisecond, "expected app to be running")
+
+	assert.Eventuallyf(t, func() bool {
+		resp, err := app.httpClient.Get("https://localhost:8086/ping")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 100*time.Millisecond, "the app's http client should trust the dev CA")
+
+	for _, url := range []string{"https://127.0.0.1:8086/ping", "https://localhost:8087/"} {
+		assert.Eventuallyf(t, func() bool {
+			resp, err := app.httpClient.Get(url)
+			if err != nil {
+				return false
+			}
+			resp.Body.Close()
+			return true
+		}, 5*time.Second, 100*time.Millisecond, "should serve %s with the dev certificate", url)
+	}
+
+	cancel()
+	wg.Wait()
+
+	first, err := tls.LoadX509KeyPair(filepath.Join(dir, devCertFile), filepath.Join(dir, devKeyFile))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"localhost"}, first.Leaf.DNSNames)
+
+	dev, err := bootstrapDevCertificates(dir, zap.NewNop())
+	assert.Nil(t, err)
+	second, err := tls.LoadX509KeyPair(dev.CertFile, dev.KeyFile)
+	assert.Nil(t, err)
+	assert.Equalf(t, first.Leaf.SerialNumber, second.Leaf.SerialNumber, "should reuse the certificate across runs")
+
+	caB, err := os.ReadFile(dev.CAFile)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Remove(dev.CertFile))
+	_, err = bootstrapDevCertificates(dir, zap.NewNop())
+	assert.Nil(t, err)
+	third, err := tls.LoadX509KeyPair(dev.CertFile, dev.KeyFile)
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.Leaf.SerialNumber, third.Leaf.SerialNumber)
+	caAfter, err := os.ReadFile(dev.CAFile)
+	assert.Nil(t, err)
+	assert.Equalf(t, caB, caAfter, "should keep the CA when reissuing the certificate")
+}
+
 func TestAppWithTestEnvironment(t *testing.T) {
 	app := New("test", Features{})
 	app.OnRunning(func(ctx *AppContext) error {
@@ -194,3 +505,142 @@ func writeToken(t *testing.T) string {
 	assert.Nilf(t, err, "should be able to marshal token")
 	return writeFile(t, string(b))
 }
+
+func TestTLSReload(t *testing.T) {
+	caKey, err := keys.CreateX509CA()
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	rotate := func(mtime time.Time) *x509.Certificate {
+		pair, err := keys.CreateX509(*caKey, keys.WithCommonName("localhost"))
+		assert.Nil(t, err)
+		key, crt := pair.Pem()
+		assert.Nil(t, os.WriteFile(certPath, crt, 0600))
+		assert.Nil(t, os.WriteFile(keyPath, key, 0600))
+		assert.Nil(t, os.Chtimes(certPath, mtime, mtime))
+		assert.Nil(t, os.Chtimes(keyPath, mtime, mtime))
+		c := pair.GetCertificate()
+		return &c
+	}
+	first := rotate(time.Now().Add(-time.Hour))
+
+	f := TLS(WithServerCert(certPath), WithServerKey(keyPath))
+	cfg, err := f.TLSConfig()
+	assert.Nil(t, err)
+
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	assert.Nil(t, err)
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	served := func() *x509.Certificate {
+		conn, err := tls.Dial("tcp", lis.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if !assert.Nil(t, err) {
+			return nil
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0]
+	}
+	assert.Equal(t, first.SerialNumber, served().SerialNumber)
+
+	second := rotate(time.Now())
+	assert.Nil(t, f.certReloader.reload())
+	assert.Equalf(t, second.SerialNumber, served().SerialNumber, "should serve the rotated certificate")
+
+	failures := tlsReloadFailures.Value()
+	assert.Nil(t, os.WriteFile(keyPath, []byte("not a key"), 0600))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go f.certReloader.watch(ctx, 10*time.Millisecond)
+	assert.Eventuallyf(t, func() bool { return tlsReloadFailures.Value() > failures }, time.Second, 10*time.Millisecond,
+		"should count failed reloads")
+	assert.Equalf(t, second.SerialNumber, served().SerialNumber, "should keep the current certificate when the new pair is invalid")
+
+	noPair := TLS()
+	_, err = noPair.TLSConfig()
+	assert.NotNilf(t, err, "should not serve without a key pair")
+	noPair = TLS(WithServerCert(certPath))
+	_, err = noPair.TLSConfig()
+	assert.NotNilf(t, err, "should not serve without a key")
+}
+
+func TestTLSReload_ClientCA(t *testing.T) {
+	dir := t.TempDir()
+	caPath, certPath, keyPath := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	rotate := func(mtime time.Time) *keys.X509 {
+		caKey, err := keys.CreateX509CA()
+		assert.Nil(t, err)
+		pair, err := keys.CreateX509(*caKey, keys.WithDNSNames([]string{"localhost"}),
+			keys.WithIPAddresses([]net.IP{net.IPv4(127, 0, 0, 1)}))
+		assert.Nil(t, err)
+		_, caPem := caKey.Pem()
+		key, crt := pair.Pem()
+		for path, b := range map[string][]byte{caPath: caPem, certPath: crt, keyPath: key} {
+			assert.Nil(t, os.WriteFile(path, b, 0600))
+			assert.Nil(t, os.Chtimes(path, mtime, mtime))
+		}
+		return pair
+	}
+	first := rotate(time.Now().Add(-time.Hour))
+
+	f := TLS(WithServerCAFile(caPath), WithServerCert(certPath), WithServerKey(keyPath))
+	cfg, err := f.TLSConfig()
+	assert.Nil(t, err)
+	assert.False(t, cfg.InsecureSkipVerify)
+
+	// the other server keeps the first certificate, it is no longer trusted
+	// once the CA rotates
+	key, crt := first.Pem()
+	stale, err := tls.X509KeyPair(crt, key)
+	assert.Nil(t, err)
+	serve := func(cfg *tls.Config) string {
+		lis, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+		assert.Nil(t, err)
+		t.Cleanup(func() { lis.Close() })
+		go func() {
+			for {
+				conn, err := lis.Accept()
+				if err != nil {
+					return
+				}
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}
+		}()
+		_, port, _ := net.SplitHostPort(lis.Addr().String())
+		return "localhost:" + port
+	}
+	rotating := serve(cfg)
+	fixed := serve(&tls.Config{Certificates: []tls.Certificate{stale}})
+
+	dialTLS := f.certReloader.dialTLSContext(nil)
+	dial := func(addr string) error {
+		conn, err := dialTLS(context.Background(), "tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+	assert.Nilf(t, dial(rotating), "should trust the current CA")
+	assert.Nil(t, dial(fixed))
+
+	rotate(time.Now())
+	assert.Nil(t, f.certReloader.reload())
+	assert.Nilf(t, dial(rotating), "should trust the rotated CA without a new config")
+	assert.NotNilf(t, dial(fixed), "should no longer trust the replaced CA")
+
+	_, port, _ := net.SplitHostPort(rotating)
+	assert.Nilf(t, dial("127.0.0.1:"+port), "should verify servers dialed by IP against their IP SANs")
+	_, port, _ = net.SplitHostPort(fixed)
+	assert.NotNil(t, dial("127.0.0.1:"+port))
+}
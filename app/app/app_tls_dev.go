@@ -0,0 +1,135 @@
+package app
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ooqls/getset/crypto/keys"
+	"go.uber.org/zap"
+)
+
+const (
+	devCACertFile = "ca.crt"
+	devCAKeyFile  = "ca.key"
+	devCertFile   = "tls.crt"
+	devKeyFile    = "tls.key"
+
+	// devRenewBefore reissues certificates that expire within it.
+	devRenewBefore = 24 * time.Hour
+)
+
+// devCertificates are the files of the development CA and the localhost
+// certificate it issued.
+type devCertificates struct {
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// bootstrapDevCertificates loads the development CA and localhost certificate
+// from dir, creating them on first use and reissuing them when they are
+// invalid or about to expire. Trust ca.crt once to use them across runs.
+func bootstrapDevCertificates(dir string, l *zap.Logger) (*devCertificates, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create dev certificate dir %s: %v", dir, err)
+	}
+
+	certs := &devCertificates{
+		CAFile:   filepath.Join(dir, devCACertFile),
+		CertFile: filepath.Join(dir, devCertFile),
+		KeyFile:  filepath.Join(dir, devKeyFile),
+	}
+	caKeyFile := filepath.Join(dir, devCAKeyFile)
+
+	ca, err := loadDevCA(certs.CAFile, caKeyFile)
+	if err != nil {
+		l.Info("[Startup TLS] creating development CA", zap.String("dir", dir), zap.String("reason", err.Error()))
+		ca, err = keys.CreateX509CA(keys.WithCommonName("getset development CA"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create dev CA: %v", err)
+		}
+
+		key, crt := ca.Pem()
+		if err := writeDevFiles(map[string][]byte{caKeyFile: key, certs.CAFile: crt}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkDevCertificate(*ca, certs.CertFile, certs.KeyFile); err != nil {
+		l.Info("[Startup TLS] issuing development certificate", zap.String("dir", dir), zap.String("reason", err.Error()))
+		pair, err := keys.CreateX509(*ca,
+			keys.WithCommonName("localhost"),
+			keys.WithDNSNames([]string{"localhost"}),
+			keys.WithIPAddresses([]net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}),
+			keys.WithExtKeyUsage([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create dev certificate: %v", err)
+		}
+
+		key, crt := pair.Pem()
+		if err := writeDevFiles(map[string][]byte{certs.KeyFile: key, certs.CertFile: crt}); err != nil {
+			return nil, err
+		}
+	}
+
+	return certs, nil
+}
+
+func loadDevCA(certFile, keyFile string) (*keys.X509, error) {
+	crt, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := keys.ParseX509Bytes(bytes.Join([][]byte{key, crt}, []byte("\n")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dev CA: %v", err)
+	}
+
+	if crt := ca.GetCertificate(); time.Now().Add(devRenewBefore).After(crt.NotAfter) {
+		return nil, fmt.Errorf("dev CA expires at %s", crt.NotAfter)
+	}
+
+	return ca, nil
+}
+
+// checkDevCertificate returns why the key pair can not be reused.
+func checkDevCertificate(ca keys.X509, certFile, keyFile string) error {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	caCrt := ca.GetCertificate()
+	if err := pair.Leaf.CheckSignatureFrom(&caCrt); err != nil {
+		return fmt.Errorf("dev certificate not signed by the dev CA: %v", err)
+	}
+
+	if time.Now().Add(devRenewBefore).After(pair.Leaf.NotAfter) {
+		return fmt.Errorf("dev certificate expires at %s", pair.Leaf.NotAfter)
+	}
+
+	return nil
+}
+
+func writeDevFiles(files map[string][]byte) error {
+	for path, b := range files {
+		if err := os.WriteFile(path, b, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+	}
+
+	return nil
+}
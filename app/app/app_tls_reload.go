@@ -0,0 +1,234 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"expvar"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultTLSReloadInterval = 30 * time.Second
+
+var (
+	tlsReloads        = expvar.NewInt("getset_tls_reloads")
+	tlsReloadFailures = expvar.NewInt("getset_tls_reload_failures")
+)
+
+// certSource is a PEM file or, when the bytes are set, static PEM bytes that
+// are never reloaded.
+type certSource struct {
+	file  string
+	bytes []byte
+}
+
+func (s certSource) isSet() bool {
+	return len(s.bytes) > 0 || s.file != ""
+}
+
+func (s certSource) read() ([]byte, error) {
+	if len(s.bytes) > 0 {
+		return s.bytes, nil
+	}
+
+	b, err := os.ReadFile(s.file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", s.file, err)
+	}
+
+	return b, nil
+}
+
+// stamp identifies a version of the file, rotations replace the file or the
+// symlink pointing to it, which changes its modification time or size.
+func (s certSource) stamp() string {
+	if len(s.bytes) > 0 || s.file == "" {
+		return ""
+	}
+
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size())
+}
+
+// tlsState is one consistent set of key pair and CA pool.
+type tlsState struct {
+	cert   *tls.Certificate
+	pool   *x509.CertPool
+	config *tls.Config
+}
+
+// certReloader serves the server key pair and CA pool of the TLS feature and
+// swaps them atomically when the files change, so rotated certificates are
+// picked up without a restart. An invalid new pair is logged and counted in
+// the getset_tls_reload_failures expvar, the old one stays in use.
+type certReloader struct {
+	cert, key, ca certSource
+	// server holds the client auth settings of the per-client configs.
+	server *tls.Config
+	l      *zap.Logger
+
+	state atomic.Pointer[tlsState]
+
+	m      sync.Mutex
+	stamps [3]string
+}
+
+func newCertReloader(cert, key, ca certSource, server *tls.Config, l *zap.Logger) (*certReloader, error) {
+	r := &certReloader{
+		cert:   cert,
+		key:    key,
+		ca:     ca,
+		server: server,
+		l:      l,
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *certReloader) load() (*tlsState, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get system cert pool: %v", err)
+	}
+
+	// client certificates are only trusted if signed by the CA, not by
+	// the system roots
+	var clientCAs *x509.CertPool
+	if r.ca.isSet() {
+		b, err := r.ca.read()
+		if err != nil {
+			return nil, err
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) || !clientCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("failed to add pem bytes from ca %s", r.ca.file)
+		}
+	}
+
+	if !r.cert.isSet() || !r.key.isSet() {
+		return nil, fmt.Errorf("no server cert and key configured")
+	}
+
+	certB, err := r.cert.read()
+	if err != nil {
+		return nil, err
+	}
+
+	keyB, err := r.key.read()
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(certB, keyB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load x509 key pair: %v", err)
+	}
+
+	s := &tlsState{cert: &cert, pool: pool}
+	s.config = r.server.Clone()
+	s.config.RootCAs = pool
+	s.config.ClientCAs = clientCAs
+	s.config.NextProtos = []string{"h2", "http/1.1"}
+	s.config.Certificates = []tls.Certificate{cert}
+
+	return s, nil
+}
+
+// reload loads the files if they changed since the last attempt. A failed
+// attempt is not retried until the files change again.
+func (r *certReloader) reload() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	stamps := [3]string{r.cert.stamp(), r.key.stamp(), r.ca.stamp()}
+	if r.state.Load() != nil && stamps == r.stamps {
+		return nil
+	}
+	r.stamps = stamps
+
+	s, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	r.state.Store(s)
+	return nil
+}
+
+// watch polls the files every interval until ctx is done.
+func (r *certReloader) watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			old := r.state.Load()
+			if err := r.reload(); err != nil {
+				tlsReloadFailures.Add(1)
+				r.l.Error("[TLS] failed to reload certificates, keeping the current ones", zap.Error(err))
+				continue
+			}
+
+			if s := r.state.Load(); s != old {
+				tlsReloads.Add(1)
+				fields := []zap.Field{zap.String("cert_file", r.cert.file), zap.String("ca_file", r.ca.file)}
+				if s.cert != nil && s.cert.Leaf != nil {
+					fields = append(fields, zap.Time("not_after", s.cert.Leaf.NotAfter))
+				}
+				r.l.Info("[TLS] reloaded certificates", fields...)
+			}
+		}
+	}
+}
+
+func (r *certReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return r.state.Load().config, nil
+}
+
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.state.Load().cert, nil
+}
+
+func (r *certReloader) rootCAs() *x509.CertPool {
+	return r.state.Load().pool
+}
+
+// dialTLSContext returns a dial function for http.Transport.DialTLSContext
+// that verifies servers against the CA pool current at each dial rather than
+// the one at creation, followed by verify if it is set. A config's RootCAs
+// is fixed, so each dial gets a fresh one.
+func (r *certReloader) dialTLSContext(verify func(tls.ConnectionState) error) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		d := &tls.Dialer{Config: &tls.Config{
+			RootCAs:              r.rootCAs(),
+			ServerName:           host,
+			GetClientCertificate: r.getClientCertificate,
+			VerifyConnection:     verify,
+		}}
+		return d.DialContext(ctx, network, addr)
+	}
+}
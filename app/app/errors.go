@@ -6,4 +6,5 @@ var (
 	ErrRegistryFileNotFound error = fmt.Errorf("registry file not found")
 	ErrPrivateKeyNotFound   error = fmt.Errorf("private key not found")
 	ErrPublicKeyNotFound    error = fmt.Errorf("public key not found")
+	ErrIssuerNotConfigured  error = fmt.Errorf("token issuer not configured")
 )
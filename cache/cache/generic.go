@@ -5,8 +5,10 @@ import (
 	"context"
 	"encoding/gob"
 	"fmt"
+	"time"
 
 	"github.com/eko/gocache/lib/v4/cache"
+	"github.com/eko/gocache/lib/v4/store"
 )
 
 func NewGenericCache(cacheKey string, c *cache.Cache[[]byte]) *GenericCache {
@@ -36,6 +38,17 @@ func (c *GenericCache) Set(ctx context.Context, key string, val any) error {
 	return c.c.Set(ctx, k, buff.Bytes())
 }
 
+func (c *GenericCache) SetWithTTL(ctx context.Context, key string, val any, ttl time.Duration) error {
+	var buff bytes.Buffer
+	enc := gob.NewEncoder(&buff)
+	err := enc.Encode(val)
+	if err != nil {
+		return err
+	}
+	k := c.getKey(key)
+	return c.c.Set(ctx, k, buff.Bytes(), store.WithExpiration(ttl))
+}
+
 func (c *GenericCache) Get(ctx context.Context, key string, target any) error {
 	b, err := c.c.Get(ctx, c.getKey(key))
 	if err != nil {
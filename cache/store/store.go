@@ -25,6 +25,7 @@ func Register(types ...any) {
 //go:generate mockgen -source=store.go -destination=store_mock.go -package=store GenericInterface
 type GenericInterface interface {
 	Set(ctx context.Context, key string, value any) error
+	SetWithTTL(ctx context.Context, key string, value any, ttl time.Duration) error
 	Get(ctx context.Context, key string, target any) error
 	Update(ctx context.Context, key string, fn func(func(target any) error) (any, error)) error
 	Delete(ctx context.Context, key string) error
@@ -44,6 +45,10 @@ func (s *MemStore) Set(ctx context.Context, key string, value any) error {
 	return s.c.Set(ctx, key, value)
 }
 
+func (s *MemStore) SetWithTTL(ctx context.Context, key string, value any, ttl time.Duration) error {
+	return s.c.SetWithTTL(ctx, key, value, ttl)
+}
+
 func (s *MemStore) Get(ctx context.Context, key string, target any) error {
 	return s.c.Get(ctx, key, target)
 }
@@ -101,6 +106,15 @@ func (s *RedisStore) Set(ctx context.Context, key string, value any) error {
 	return s.db.Set(ctx, s.getKey(key), buff, s.ttl).Err()
 }
 
+func (s *RedisStore) SetWithTTL(ctx context.Context, key string, value any, ttl time.Duration) error {
+	buff, err := encode(value)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Set(ctx, s.getKey(key), buff, ttl).Err()
+}
+
 func (s *RedisStore) Get(ctx context.Context, key string, target any) error {
 	res, err := s.db.Get(ctx, s.getKey(key)).Result()
 	if err != nil {
@@ -161,6 +175,15 @@ func (s *ValkeyStore) Set(ctx context.Context, key string, value any) error {
 	return s.valkey.Do(ctx, s.valkey.B().Set().Key(s.getKey(key)).Value(string(buff)).Build()).Error()
 }
 
+func (s *ValkeyStore) SetWithTTL(ctx context.Context, key string, value any, ttl time.Duration) error {
+	buff, err := encode(value)
+	if err != nil {
+		return err
+	}
+
+	return s.valkey.Do(ctx, s.valkey.B().Set().Key(s.getKey(key)).Value(string(buff)).Px(ttl).Build()).Error()
+}
+
 func (s *ValkeyStore) Get(ctx context.Context, key string, target any) error {
 	res := s.valkey.Do(ctx, s.valkey.B().Get().Key(s.getKey(key)).Build())
 	if res.Error() != nil {
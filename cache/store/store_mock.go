@@ -7,6 +7,7 @@ package store
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -76,6 +77,20 @@ func (mr *MockGenericInterfaceMockRecorder) Set(ctx, key, value interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockGenericInterface)(nil).Set), ctx, key, value)
 }
 
+// SetWithTTL mocks base method.
+func (m *MockGenericInterface) SetWithTTL(ctx context.Context, key string, value any, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetWithTTL", ctx, key, value, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetWithTTL indicates an expected call of SetWithTTL.
+func (mr *MockGenericInterfaceMockRecorder) SetWithTTL(ctx, key, value, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetWithTTL", reflect.TypeOf((*MockGenericInterface)(nil).SetWithTTL), ctx, key, value, ttl)
+}
+
 // Update mocks base method.
 func (m *MockGenericInterface) Update(ctx context.Context, key string, fn func(func(any) error) (any, error)) error {
 	m.ctrl.T.Helper()
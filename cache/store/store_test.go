@@ -153,3 +153,19 @@ func TestValkeyStore(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "updated value", updatedObj2.V)
 }
+
+func TestMemStore_SetWithTTL(t *testing.T) {
+	store := NewMemStore("test", 10*time.Second)
+
+	err := store.SetWithTTL(context.Background(), "key", Obj{V: "value"}, 50*time.Millisecond)
+	assert.Nil(t, err)
+
+	var obj Obj
+	err = store.Get(context.Background(), "key", &obj)
+	assert.Nil(t, err)
+	assert.Equal(t, "value", obj.V)
+
+	time.Sleep(100 * time.Millisecond)
+	err = store.Get(context.Background(), "key", &obj)
+	assert.True(t, cache.IsCacheMissErr(err))
+}
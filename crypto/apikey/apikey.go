@@ -0,0 +1,329 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ooqls/getset/cache/cache"
+	"github.com/ooqls/getset/cache/store"
+	"github.com/ooqls/getset/crypto/crypto"
+	"github.com/ooqls/getset/log"
+	"go.uber.org/zap"
+)
+
+var l *zap.Logger = log.NewLogger("apikey")
+
+const (
+	idSize     = 6
+	secretSize = 32
+	hashSize   = 32
+)
+
+// Argon2Params are the argon2id parameters a key was hashed with. They are
+// stored with every key so they can be raised without invalidating old keys.
+type Argon2Params struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+var DefaultArgon2Params = Argon2Params{
+	Memory:  64 * 1024,
+	Time:    1,
+	Threads: 2,
+}
+
+// APIKey is the stored form of a key. Only the argon2 hash of the secret is
+// kept. Fields are exported so the key can be gob encoded by the store.
+type APIKey struct {
+	Id         string
+	Name       string
+	Subject    string
+	Scopes     []string
+	Salt       []byte
+	Hash       []byte
+	Params     Argon2Params
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	Revoked    bool
+}
+
+func (k *APIKey) Expired() bool {
+	return !k.ExpiresAt.IsZero() && time.Now().After(k.ExpiresAt)
+}
+
+// HasScopes reports whether the key was granted every scope.
+func (k *APIKey) HasScopes(scopes ...string) bool {
+	for _, s := range scopes {
+		if !slices.Contains(k.Scopes, s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (k *APIKey) matches(secret []byte) bool {
+	algo := crypto.NewArgon2HashingAlgorithm(k.Params.Memory, k.Params.Time, k.Params.Threads, uint32(len(k.Hash)), k.Salt)
+	return subtle.ConstantTimeCompare(algo.Hash(secret), k.Hash) == 1
+}
+
+// Store persists api keys by their id. Touch and Revoke each change one
+// field without rewriting the rest of the key, so a use recorded during a
+// revocation cannot undo it.
+type Store interface {
+	Get(ctx context.Context, id string) (*APIKey, error)
+	Save(ctx context.Context, key *APIKey) error
+	// Touch records the last use of the key.
+	Touch(ctx context.Context, id string, t time.Time) error
+	Revoke(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string) error
+}
+
+type cacheStore struct {
+	s store.GenericInterface
+}
+
+// NewStore keeps api keys in a cache store under apikey/<id>, and their last
+// use under apikey/<id>/last_used. The store should not expire entries,
+// expiry is tracked on the key itself.
+func NewStore(s store.GenericInterface) Store {
+	return &cacheStore{s: s}
+}
+
+func (s *cacheStore) key(id string) string {
+	return fmt.Sprintf("apikey/%s", id)
+}
+
+func (s *cacheStore) lastUsedKey(id string) string {
+	return fmt.Sprintf("apikey/%s/last_used", id)
+}
+
+func (s *cacheStore) Get(ctx context.Context, id string) (*APIKey, error) {
+	var k APIKey
+	if err := s.s.Get(ctx, s.key(id), &k); err != nil {
+		if cache.IsCacheMissErr(err) {
+			return nil, ErrKeyNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get api key %s: %v", id, err)
+	}
+
+	var lastUsed time.Time
+	if err := s.s.Get(ctx, s.lastUsedKey(id), &lastUsed); err == nil {
+		k.LastUsedAt = lastUsed
+	} else if !cache.IsCacheMissErr(err) {
+		return nil, fmt.Errorf("failed to get last use of api key %s: %v", id, err)
+	}
+
+	return &k, nil
+}
+
+func (s *cacheStore) Save(ctx context.Context, key *APIKey) error {
+	return s.s.Set(ctx, s.key(key.Id), *key)
+}
+
+func (s *cacheStore) Touch(ctx context.Context, id string, t time.Time) error {
+	return s.s.Set(ctx, s.lastUsedKey(id), t)
+}
+
+func (s *cacheStore) Revoke(ctx context.Context, id string) error {
+	err := s.s.Update(ctx, s.key(id), func(get func(target any) error) (any, error) {
+		var k APIKey
+		if err := get(&k); err != nil {
+			return nil, err
+		}
+
+		k.Revoked = true
+		return k, nil
+	})
+	if err != nil {
+		if cache.IsCacheMissErr(err) {
+			return ErrKeyNotFound
+		}
+
+		return fmt.Errorf("failed to revoke api key %s: %v", id, err)
+	}
+
+	return nil
+}
+
+func (s *cacheStore) Delete(ctx context.Context, id string) error {
+	if err := s.s.Delete(ctx, s.lastUsedKey(id)); err != nil && !cache.IsCacheMissErr(err) {
+		return err
+	}
+
+	return s.s.Delete(ctx, s.key(id))
+}
+
+type managerOptions struct {
+	prefix           string
+	params           Argon2Params
+	lastUsedInterval time.Duration
+}
+
+type managerOption func(*managerOptions)
+
+// WithPrefix sets the prefix of generated keys, e.g. "live" for keys of the
+// form live_<id>_<secret>. Defaults to "key".
+func WithPrefix(prefix string) managerOption {
+	return func(o *managerOptions) {
+		o.prefix = prefix
+	}
+}
+
+func WithArgon2Params(p Argon2Params) managerOption {
+	return func(o *managerOptions) {
+		o.params = p
+	}
+}
+
+// WithLastUsedInterval limits how often the last used timestamp of a key is
+// written, so busy keys don't cause a write per request. Defaults to a
+// minute.
+func WithLastUsedInterval(d time.Duration) managerOption {
+	return func(o *managerOptions) {
+		o.lastUsedInterval = d
+	}
+}
+
+// Manager creates api keys and authenticates requests that present them.
+type Manager struct {
+	s    Store
+	opts managerOptions
+}
+
+func NewManager(s Store, opts ...managerOption) (*Manager, error) {
+	o := managerOptions{
+		prefix:           "key",
+		params:           DefaultArgon2Params,
+		lastUsedInterval: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.prefix == "" || strings.Contains(o.prefix, "_") {
+		return nil, ErrInvalidPrefix
+	}
+
+	return &Manager{s: s, opts: o}, nil
+}
+
+type CreateRequest struct {
+	Name    string
+	Subject string
+	Scopes  []string
+	// TTL of the key, zero keys never expire.
+	TTL time.Duration
+}
+
+// Create generates a new key and returns its plaintext form, which is the
+// only time the secret is available.
+func (m *Manager) Create(ctx context.Context, req CreateRequest) (string, *APIKey, error) {
+	idB := make([]byte, idSize)
+	secret := make([]byte, secretSize)
+	salt := make([]byte, crypto.SALT_SIZE)
+	for _, b := range [][]byte{idB, secret, salt} {
+		if _, err := rand.Read(b); err != nil {
+			return "", nil, fmt.Errorf("failed to generate api key: %v", err)
+		}
+	}
+
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	p := m.opts.params
+	now := time.Now()
+	key := &APIKey{
+		Id:        hex.EncodeToString(idB),
+		Name:      req.Name,
+		Subject:   req.Subject,
+		Scopes:    req.Scopes,
+		Salt:      salt,
+		Hash:      crypto.NewArgon2HashingAlgorithm(p.Memory, p.Time, p.Threads, hashSize, salt).Hash([]byte(encodedSecret)),
+		Params:    p,
+		CreatedAt: now,
+	}
+	if req.TTL > 0 {
+		key.ExpiresAt = now.Add(req.TTL)
+	}
+
+	if err := m.s.Save(ctx, key); err != nil {
+		return "", nil, fmt.Errorf("failed to save api key: %v", err)
+	}
+
+	return fmt.Sprintf("%s_%s_%s", m.opts.prefix, key.Id, encodedSecret), key, nil
+}
+
+// parse splits a plaintext key into its lookup id and secret.
+func (m *Manager) parse(plaintext string) (string, string, error) {
+	parts := strings.SplitN(plaintext, "_", 3)
+	if len(parts) != 3 || parts[0] != m.opts.prefix || parts[1] == "" || parts[2] == "" {
+		return "", "", ErrInvalidKey
+	}
+
+	return parts[1], parts[2], nil
+}
+
+// Authenticate looks the key up by its id, verifies the secret and returns
+// the stored key.
+func (m *Manager) Authenticate(ctx context.Context, plaintext string) (*APIKey, error) {
+	id, secret, err := m.parse(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := m.s.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, ErrInvalidKey
+		}
+
+		return nil, err
+	}
+
+	if !key.matches([]byte(secret)) {
+		return nil, ErrInvalidKey
+	}
+
+	if key.Revoked {
+		return nil, ErrKeyRevoked
+	}
+
+	if key.Expired() {
+		return nil, ErrKeyExpired
+	}
+
+	if now := time.Now(); now.Sub(key.LastUsedAt) >= m.opts.lastUsedInterval {
+		key.LastUsedAt = now
+		if err := m.s.Touch(ctx, key.Id, now); err != nil {
+			l.Warn("failed to record api key use", zap.String("id", key.Id), zap.Error(err))
+		}
+	}
+
+	return key, nil
+}
+
+// Get returns the stored key with the id.
+func (m *Manager) Get(ctx context.Context, id string) (*APIKey, error) {
+	return m.s.Get(ctx, id)
+}
+
+// Revoke marks the key as revoked. The record is kept so its last use stays
+// visible.
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	return m.s.Revoke(ctx, id)
+}
+
+// Delete removes the key entirely.
+func (m *Manager) Delete(ctx context.Context, id string) error {
+	return m.s.Delete(ctx, id)
+}
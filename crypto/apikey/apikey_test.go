@@ -0,0 +1,203 @@
+package apikey
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ooqls/getset/cache/store"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newTestManager(t *testing.T, opts ...managerOption) *Manager {
+	opts = append([]managerOption{
+		WithPrefix("test"),
+		WithArgon2Params(Argon2Params{Memory: 1024, Time: 1, Threads: 1}),
+	}, opts...)
+	m, err := NewManager(NewStore(store.NewMemStore(t.Name(), 0)), opts...)
+	assert.Nilf(t, err, "should be able to create manager")
+	return m
+}
+
+func TestManager_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t, WithLastUsedInterval(0))
+
+	plaintext, key, err := m.Create(ctx, CreateRequest{Name: "ci", Subject: "svc-1", Scopes: []string{"builds:read"}})
+	assert.Nilf(t, err, "should be able to create key")
+	assert.True(t, strings.HasPrefix(plaintext, "test_"+key.Id+"_"))
+	assert.NotContains(t, string(key.Hash), strings.SplitN(plaintext, "_", 3)[2])
+
+	authed, err := m.Authenticate(ctx, plaintext)
+	assert.Nilf(t, err, "should authenticate a valid key")
+	assert.Equal(t, "svc-1", authed.Subject)
+
+	stored, err := m.Get(ctx, key.Id)
+	assert.Nil(t, err)
+	assert.Falsef(t, stored.LastUsedAt.IsZero(), "should record the last use")
+
+	_, err = m.Authenticate(ctx, plaintext+"x")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = m.Authenticate(ctx, "test_unknown_secret")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = m.Authenticate(ctx, strings.Replace(plaintext, "test_", "live_", 1))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	assert.Nil(t, m.Revoke(ctx, key.Id))
+	_, err = m.Authenticate(ctx, plaintext)
+	assert.ErrorIs(t, err, ErrKeyRevoked)
+}
+
+// pausingStore blocks Touch until released, so a use can be recorded after a
+// concurrent revocation.
+type pausingStore struct {
+	Store
+	touching chan struct{}
+	release  chan struct{}
+}
+
+func (s *pausingStore) Touch(ctx context.Context, id string, t time.Time) error {
+	close(s.touching)
+	<-s.release
+	return s.Store.Touch(ctx, id, t)
+}
+
+func TestManager_RevokeDuringAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	s := &pausingStore{
+		Store:    NewStore(store.NewMemStore(t.Name(), 0)),
+		touching: make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	m, err := NewManager(s, WithPrefix("test"), WithLastUsedInterval(0),
+		WithArgon2Params(Argon2Params{Memory: 1024, Time: 1, Threads: 1}))
+	assert.Nil(t, err)
+
+	plaintext, key, err := m.Create(ctx, CreateRequest{Subject: "svc"})
+	assert.Nil(t, err)
+
+	done := make(chan error)
+	go func() {
+		_, err := m.Authenticate(ctx, plaintext)
+		done <- err
+	}()
+
+	<-s.touching
+	assert.Nil(t, m.Revoke(ctx, key.Id))
+	close(s.release)
+	assert.Nilf(t, <-done, "the key was valid when it was checked")
+
+	stored, err := m.Get(ctx, key.Id)
+	assert.Nil(t, err)
+	assert.Truef(t, stored.Revoked, "recording the use should not undo the revocation")
+	assert.Falsef(t, stored.LastUsedAt.IsZero(), "should record the last use")
+
+	assert.ErrorIs(t, m.Revoke(ctx, "unknown"), ErrKeyNotFound)
+	assert.Nil(t, m.Delete(ctx, key.Id))
+	_, err = m.Get(ctx, key.Id)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestManager_Expiry(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+
+	plaintext, _, err := m.Create(ctx, CreateRequest{Subject: "svc", TTL: time.Millisecond})
+	assert.Nil(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+	_, err = m.Authenticate(ctx, plaintext)
+	assert.ErrorIs(t, err, ErrKeyExpired)
+
+	_, err = NewManager(NewStore(store.NewMemStore(t.Name(), 0)), WithPrefix("bad_prefix"))
+	assert.ErrorIs(t, err, ErrInvalidPrefix)
+}
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	m := newTestManager(t)
+
+	plaintext, _, err := m.Create(ctx, CreateRequest{Subject: "svc", Scopes: []string{"read"}})
+	assert.Nil(t, err)
+
+	e := gin.New()
+	e.GET("/read", GinMiddleware(m, "read"), func(c *gin.Context) {
+		key, _ := FromContext(c.Request.Context())
+		c.String(http.StatusOK, key.Subject)
+	})
+	e.GET("/write", GinMiddleware(m, "write"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(path, header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/read", HeaderName, plaintext)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "svc", w.Body.String())
+
+	w = do("/read", "Authorization", "Bearer "+plaintext)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusForbidden, do("/write", HeaderName, plaintext).Code)
+	assert.Equal(t, http.StatusUnauthorized, do("/read", "", "").Code)
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+
+	plaintext, _, err := m.Create(ctx, CreateRequest{Subject: "svc"})
+	assert.Nil(t, err)
+
+	h := HTTPMiddleware(m, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(HeaderName, plaintext)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+
+	plaintext, _, err := m.Create(ctx, CreateRequest{Subject: "svc", Scopes: []string{"read"}})
+	assert.Nil(t, err)
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		key, _ := FromContext(ctx)
+		return key.Subject, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Test/Get"}
+	md := metadata.NewIncomingContext(ctx, metadata.Pairs("x-api-key", plaintext))
+
+	resp, err := UnaryServerInterceptor(m, "read")(md, nil, info, handler)
+	assert.Nil(t, err)
+	assert.Equal(t, "svc", resp)
+
+	_, err = UnaryServerInterceptor(m, "write")(md, nil, info, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = UnaryServerInterceptor(m)(ctx, nil, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
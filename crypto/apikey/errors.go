@@ -0,0 +1,13 @@
+package apikey
+
+import "errors"
+
+var (
+	ErrNoKey         = errors.New("no api key")
+	ErrInvalidKey    = errors.New("invalid api key")
+	ErrKeyExpired    = errors.New("api key has expired")
+	ErrKeyRevoked    = errors.New("api key has been revoked")
+	ErrMissingScope  = errors.New("api key is missing a required scope")
+	ErrKeyNotFound   = errors.New("api key not found")
+	ErrInvalidPrefix = errors.New("api key prefix must not be empty or contain '_'")
+)
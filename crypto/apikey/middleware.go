@@ -0,0 +1,177 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ooqls/getset/crypto/authz"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const HeaderName = "X-API-Key"
+
+type apiKeyCtxKey struct{}
+
+func WithAPIKey(ctx context.Context, key *APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyCtxKey{}, key)
+}
+
+func FromContext(ctx context.Context) (*APIKey, bool) {
+	k, ok := ctx.Value(apiKeyCtxKey{}).(*APIKey)
+	return k, ok && k != nil
+}
+
+// Authenticator returns an authz.Authenticator for api keys, the key's scopes
+// become the permissions of the principal.
+func (m *Manager) Authenticator() authz.Authenticator {
+	return func(ctx context.Context, token string) (*authz.Principal, error) {
+		key, err := m.Authenticate(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+
+		return &authz.Principal{Subject: key.Subject, Permissions: key.Scopes}, nil
+	}
+}
+
+// extractKey returns the key of the X-API-Key header, or of a bearer
+// authorization header.
+func extractKey(apiKey, authorization string) (string, error) {
+	if apiKey != "" {
+		return apiKey, nil
+	}
+
+	if key, ok := strings.CutPrefix(authorization, "Bearer "); ok && key != "" {
+		return key, nil
+	}
+
+	return "", ErrNoKey
+}
+
+func (m *Manager) authenticate(ctx context.Context, apiKey, authorization string, scopes []string) (*APIKey, error) {
+	plaintext, err := extractKey(apiKey, authorization)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := m.Authenticate(ctx, plaintext)
+	if err != nil {
+		l.Debug("failed to authenticate api key", zap.Error(err))
+		return nil, err
+	}
+
+	if !key.HasScopes(scopes...) {
+		return nil, fmt.Errorf("%w: requires %v", ErrMissingScope, scopes)
+	}
+
+	return key, nil
+}
+
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrMissingScope):
+		return http.StatusForbidden
+	case errors.Is(err, ErrNoKey), errors.Is(err, ErrInvalidKey), errors.Is(err, ErrKeyExpired), errors.Is(err, ErrKeyRevoked):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GinMiddleware authenticates the request's api key and requires it to have
+// every scope.
+func GinMiddleware(m *Manager, scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, err := m.authenticate(c.Request.Context(), c.GetHeader(HeaderName), c.GetHeader("Authorization"), scopes)
+		if err != nil {
+			c.AbortWithStatusJSON(httpStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Request = c.Request.WithContext(WithAPIKey(c.Request.Context(), key))
+		c.Next()
+	}
+}
+
+func HTTPMiddleware(m *Manager, next http.Handler, scopes ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := m.authenticate(r.Context(), r.Header.Get(HeaderName), r.Header.Get("Authorization"), scopes)
+		if err != nil {
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithAPIKey(r.Context(), key)))
+	})
+}
+
+func grpcError(err error) error {
+	switch httpStatus(err) {
+	case http.StatusForbidden:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case http.StatusUnauthorized:
+		return status.Error(codes.Unauthenticated, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func (m *Manager) authenticateGrpc(ctx context.Context, scopes []string) (context.Context, error) {
+	var apiKey, authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(strings.ToLower(HeaderName)); len(v) > 0 {
+			apiKey = v[0]
+		}
+		if v := md.Get("authorization"); len(v) > 0 {
+			authorization = v[0]
+		}
+	}
+
+	key, err := m.authenticate(ctx, apiKey, authorization, scopes)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return WithAPIKey(ctx, key), nil
+}
+
+// UnaryServerInterceptor authenticates the x-api-key or authorization
+// metadata of every call.
+func UnaryServerInterceptor(m *Manager, scopes ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := m.authenticateGrpc(ctx, scopes)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+type apiKeyStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *apiKeyStream) Context() context.Context {
+	return s.ctx
+}
+
+func StreamServerInterceptor(m *Manager, scopes ...string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := m.authenticateGrpc(ss.Context(), scopes)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &apiKeyStream{ServerStream: ss, ctx: ctx})
+	}
+}
@@ -0,0 +1,200 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/ooqls/getset/cache/cache"
+	"github.com/ooqls/getset/cache/store"
+	"github.com/ooqls/getset/log"
+	"go.uber.org/zap"
+)
+
+var l *zap.Logger = log.NewLogger("authz")
+
+// Grants are the roles and permissions assigned to a subject outside of its
+// token.
+type Grants struct {
+	Roles       []string
+	Permissions []string
+}
+
+// Resolver looks up the grants of a subject, e.g. from a database.
+type Resolver interface {
+	Resolve(ctx context.Context, subject string) (*Grants, error)
+}
+
+// StoreResolver keeps grants in a cache store under grants/<subject>.
+type StoreResolver struct {
+	s store.GenericInterface
+}
+
+func NewStoreResolver(s store.GenericInterface) *StoreResolver {
+	return &StoreResolver{s: s}
+}
+
+func (r *StoreResolver) key(subject string) string {
+	return fmt.Sprintf("grants/%s", subject)
+}
+
+func (r *StoreResolver) Grant(ctx context.Context, subject string, g Grants) error {
+	return r.s.Set(ctx, r.key(subject), g)
+}
+
+func (r *StoreResolver) Revoke(ctx context.Context, subject string) error {
+	return r.s.Delete(ctx, r.key(subject))
+}
+
+func (r *StoreResolver) Resolve(ctx context.Context, subject string) (*Grants, error) {
+	var g Grants
+	if err := r.s.Get(ctx, r.key(subject), &g); err != nil {
+		if cache.IsCacheMissErr(err) {
+			return &Grants{}, nil
+		}
+
+		return nil, fmt.Errorf("failed to resolve grants of %s: %v", subject, err)
+	}
+
+	return &g, nil
+}
+
+type authorizerOptions struct {
+	resolver Resolver
+}
+
+type authorizerOption func(*authorizerOptions)
+
+// WithResolver adds the grants resolved for the subject to the roles and
+// permissions carried by the principal.
+func WithResolver(r Resolver) authorizerOption {
+	return func(o *authorizerOptions) {
+		o.resolver = r
+	}
+}
+
+// Authorizer decides whether a principal holds the permissions required by a
+// route or method. The policy can be swapped at any time.
+type Authorizer struct {
+	policy   atomic.Pointer[Policy]
+	resolver Resolver
+}
+
+func NewAuthorizer(p *Policy, opts ...authorizerOption) *Authorizer {
+	var o authorizerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if p == nil {
+		p = &Policy{}
+	}
+
+	a := &Authorizer{resolver: o.resolver}
+	a.policy.Store(p)
+	return a
+}
+
+func (a *Authorizer) Policy() *Policy {
+	return a.policy.Load()
+}
+
+func (a *Authorizer) SetPolicy(p *Policy) {
+	a.policy.Store(p)
+}
+
+// Permissions returns every permission held by the principal: its own, the
+// ones of its roles and the ones resolved for its subject.
+func (a *Authorizer) Permissions(ctx context.Context, p *Principal) ([]string, error) {
+	policy := a.Policy()
+	roles := append([]string{}, p.Roles...)
+	roles = append(roles, policy.SubjectRoles(p.Subject)...)
+	perms := append([]string{}, p.Permissions...)
+
+	if a.resolver != nil && p.Subject != "" {
+		g, err := a.resolver.Resolve(ctx, p.Subject)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, g.Roles...)
+		perms = append(perms, g.Permissions...)
+	}
+
+	return append(perms, policy.Permissions(roles...)...), nil
+}
+
+// Authorize returns ErrPermissionDenied unless the principal holds every
+// required permission.
+func (a *Authorizer) Authorize(ctx context.Context, p *Principal, required ...string) error {
+	if p == nil {
+		return ErrUnauthenticated
+	}
+
+	if len(required) == 0 {
+		return nil
+	}
+
+	granted, err := a.Permissions(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	for _, req := range required {
+		if !hasPermission(granted, req) {
+			return fmt.Errorf("%w: %s requires %s", ErrPermissionDenied, p.Subject, req)
+		}
+	}
+
+	return nil
+}
+
+func hasPermission(granted []string, required string) bool {
+	for _, g := range granted {
+		if Match(g, required) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WatchPolicyFile reloads the policy whenever the file changes, checking
+// every interval until ctx is done. An invalid file keeps the current policy.
+func (a *Authorizer) WatchPolicyFile(ctx context.Context, path string, interval time.Duration) {
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				l.Warn("failed to stat policy file", zap.String("path", path), zap.Error(err))
+				continue
+			}
+
+			if info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+
+			p, err := ParsePolicyFile(path)
+			if err != nil {
+				l.Error("failed to reload policy, keeping the current one", zap.String("path", path), zap.Error(err))
+				continue
+			}
+
+			a.SetPolicy(p)
+			l.Info("reloaded policy", zap.String("path", path))
+		}
+	}
+}
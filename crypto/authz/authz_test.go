@@ -0,0 +1,202 @@
+package authz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ooqls/getset/cache/store"
+	"github.com/ooqls/getset/crypto/jwt"
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/ooqls/getset/crypto/testutils"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testPolicy = `
+roles:
+  viewer:
+    permissions: ["orders:read"]
+  editor:
+    inherits: [viewer]
+    permissions: ["orders:write"]
+  admin:
+    permissions: ["*"]
+subjects:
+  ops:
+    - admin
+`
+
+func TestPolicy(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	assert.Nilf(t, err, "should be able to parse policy")
+	assert.ElementsMatch(t, []string{"orders:read", "orders:write"}, p.Permissions("editor"))
+	assert.Empty(t, p.Permissions("unknown"))
+
+	_, err = ParsePolicy([]byte("roles:\n  a:\n    inherits: [b]\n  b:\n    inherits: [a]\n"))
+	assert.ErrorIs(t, err, ErrRoleCycle)
+
+	_, err = ParsePolicy([]byte("roles:\n  a:\n    inherits: [missing]\n"))
+	assert.ErrorIs(t, err, ErrUnknownRole)
+
+	assert.True(t, Match("orders:*", "orders:read"))
+	assert.True(t, Match("*", "orders:read"))
+	assert.False(t, Match("orders:*", "ordersx:read"))
+	assert.False(t, Match("orders:read", "orders:write"))
+}
+
+func TestAuthorizer(t *testing.T) {
+	ctx := context.Background()
+	p, err := ParsePolicy([]byte(testPolicy))
+	assert.Nil(t, err)
+
+	resolver := NewStoreResolver(store.NewMemStore(t.Name(), time.Minute))
+	a := NewAuthorizer(p, WithResolver(resolver))
+
+	viewer := &Principal{Subject: "1", Roles: []string{"viewer"}}
+	assert.Nil(t, a.Authorize(ctx, viewer, "orders:read"))
+	assert.ErrorIs(t, a.Authorize(ctx, viewer, "orders:write"), ErrPermissionDenied)
+
+	assert.Nil(t, resolver.Grant(ctx, "1", Grants{Permissions: []string{"orders:write"}}))
+	assert.Nilf(t, a.Authorize(ctx, viewer, "orders:read", "orders:write"), "resolved grants should apply")
+
+	assert.Nilf(t, a.Authorize(ctx, &Principal{Subject: "ops"}, "anything"), "policy subject bindings should apply")
+	assert.ErrorIs(t, a.Authorize(ctx, nil, "orders:read"), ErrUnauthenticated)
+}
+
+func TestAuthorizer_WatchPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(testPolicy), 0600))
+
+	p, err := ParsePolicyFile(path)
+	assert.Nil(t, err)
+	a := NewAuthorizer(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.WatchPolicyFile(ctx, path, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	viewer := &Principal{Roles: []string{"viewer"}}
+	assert.ErrorIs(t, a.Authorize(ctx, viewer, "orders:delete"), ErrPermissionDenied)
+
+	updated := []byte("roles:\n  viewer:\n    permissions: [\"orders:*\"]\n")
+	assert.Nil(t, os.WriteFile(path, updated, 0600))
+	future := time.Now().Add(time.Second)
+	assert.Nil(t, os.Chtimes(path, future, future))
+
+	assert.Eventuallyf(t, func() bool {
+		return a.Authorize(ctx, viewer, "orders:delete") == nil
+	}, time.Second, 10*time.Millisecond, "policy should be reloaded")
+
+	assert.Nil(t, os.WriteFile(path, []byte("roles: ["), 0600))
+	later := future.Add(time.Second)
+	assert.Nil(t, os.Chtimes(path, later, later))
+	time.Sleep(50 * time.Millisecond)
+	assert.Nilf(t, a.Authorize(ctx, viewer, "orders:delete"), "invalid policy should keep the current one")
+}
+
+type testClaims struct {
+	Claims
+	Tenant string `json:"tenant"`
+}
+
+func newTestAuthenticator(t *testing.T) (Authenticator, jwt.TokenIssuer[testClaims]) {
+	testutils.InitKeys()
+	issuer := jwt.NewJwtTokenIssuer[testClaims](&jwt.TokenConfiguration{
+		Audience:                []string{"api"},
+		Issuer:                  "auth",
+		ValidityDurationSeconds: 60,
+	}, keys.JWT())
+
+	return NewJWTAuthenticator(issuer), issuer
+}
+
+func TestGinGuards(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auth, issuer := newTestAuthenticator(t)
+	p, err := ParsePolicy([]byte(testPolicy))
+	assert.Nil(t, err)
+	a := NewAuthorizer(p)
+
+	e := gin.New()
+	e.Use(GinAuthenticate(auth))
+	e.GET("/orders", GinRequire(a, "orders:read"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	e.POST("/orders", GinRequire(a, "orders:write"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tokenStr, _, err := issuer.IssueToken("1", testClaims{Claims: Claims{Roles: []string{"viewer"}}})
+	assert.Nil(t, err)
+
+	do := func(method, token string) int {
+		req := httptest.NewRequest(method, "/orders", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, tokenStr))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, tokenStr))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, ""))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "garbage"))
+}
+
+func TestHTTPGuards(t *testing.T) {
+	auth, issuer := newTestAuthenticator(t)
+	a := NewAuthorizer(&Policy{})
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFromContext(r.Context())
+		w.Write([]byte(p.Subject))
+	})
+	h := HTTPAuthenticate(auth, HTTPRequire(a, ok, "reports:read"))
+
+	tokenStr, _, err := issuer.IssueToken("42", testClaims{Claims: Claims{Permissions: []string{"reports:*"}}})
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenStr)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "42", w.Body.String())
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	auth, issuer := newTestAuthenticator(t)
+	p, err := ParsePolicy([]byte(testPolicy))
+	assert.Nil(t, err)
+
+	interceptor := UnaryServerInterceptor(auth, NewAuthorizer(p), MethodPermissions{
+		"/orders.Orders/Delete": {"orders:delete"},
+		"/orders.Orders/Get":    {"orders:read"},
+	})
+	handler := func(ctx context.Context, req any) (any, error) {
+		principal, _ := PrincipalFromContext(ctx)
+		return principal.Subject, nil
+	}
+
+	tokenStr, _, err := issuer.IssueToken("1", testClaims{Claims: Claims{Roles: []string{"editor"}}})
+	assert.Nil(t, err)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+tokenStr))
+
+	resp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/orders.Orders/Get"}, handler)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", resp)
+
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/orders.Orders/Delete"}, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/orders.Orders/Get"}, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
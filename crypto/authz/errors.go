@@ -0,0 +1,11 @@
+package authz
+
+import "errors"
+
+var (
+	ErrUnknownRole      = errors.New("unknown role")
+	ErrRoleCycle        = errors.New("role inheritance cycle")
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrNoToken          = errors.New("no bearer token")
+)
@@ -0,0 +1,203 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ooqls/getset/crypto/jwt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Authenticator turns a bearer token into a principal.
+type Authenticator func(ctx context.Context, token string) (*Principal, error)
+
+// NewJWTAuthenticator authenticates tokens of the issuer, taking the roles and
+// permissions of the principal from the token's custom claims.
+func NewJWTAuthenticator[C PermissionClaims](issuer jwt.TokenIssuer[C]) Authenticator {
+	return func(ctx context.Context, token string) (*Principal, error) {
+		jwtToken, claims, err := issuer.Decrypt(token)
+		if err != nil {
+			return nil, err
+		}
+
+		subject, err := jwtToken.Claims.GetSubject()
+		if err != nil {
+			return nil, err
+		}
+
+		return &Principal{
+			Subject:     subject,
+			Roles:       claims.GetRoles(),
+			Permissions: claims.GetPermissions(),
+		}, nil
+	}
+}
+
+func bearerToken(header string) (string, error) {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return "", ErrNoToken
+	}
+
+	return token, nil
+}
+
+func authenticateHeader(ctx context.Context, auth Authenticator, header string) (*Principal, error) {
+	token, err := bearerToken(header)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := auth(ctx, token)
+	if err != nil {
+		l.Debug("failed to authenticate token", zap.Error(err))
+		return nil, ErrUnauthenticated
+	}
+
+	return p, nil
+}
+
+func httpStatus(err error) int {
+	if errors.Is(err, ErrPermissionDenied) {
+		return http.StatusForbidden
+	}
+
+	if errors.Is(err, ErrUnauthenticated) || errors.Is(err, ErrNoToken) {
+		return http.StatusUnauthorized
+	}
+
+	return http.StatusInternalServerError
+}
+
+// GinAuthenticate stores the principal of the request's bearer token in the
+// request context. Requests without a valid token are rejected.
+func GinAuthenticate(auth Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := authenticateHeader(c.Request.Context(), auth, c.GetHeader("Authorization"))
+		if err != nil {
+			c.AbortWithStatusJSON(httpStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Request = c.Request.WithContext(WithPrincipal(c.Request.Context(), p))
+		c.Next()
+	}
+}
+
+// GinRequire rejects requests whose principal lacks any of the permissions.
+// It must run after GinAuthenticate.
+func GinRequire(a *Authorizer, perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, _ := PrincipalFromContext(c.Request.Context())
+		if err := a.Authorize(c.Request.Context(), p, perms...); err != nil {
+			c.AbortWithStatusJSON(httpStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// HTTPAuthenticate is the net/http counterpart of GinAuthenticate.
+func HTTPAuthenticate(auth Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := authenticateHeader(r.Context(), auth, r.Header.Get("Authorization"))
+		if err != nil {
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// HTTPRequire is the net/http counterpart of GinRequire.
+func HTTPRequire(a *Authorizer, next http.Handler, perms ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFromContext(r.Context())
+		if err := a.Authorize(r.Context(), p, perms...); err != nil {
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MethodPermissions maps full gRPC method names, e.g.
+// "/orders.v1.Orders/Create", to the permissions they require. Methods that
+// are not listed only require authentication.
+type MethodPermissions map[string][]string
+
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, ErrUnauthenticated), errors.Is(err, ErrNoToken):
+		return status.Error(codes.Unauthenticated, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func (m MethodPermissions) authorize(ctx context.Context, auth Authenticator, a *Authorizer, method string) (context.Context, error) {
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			header = v[0]
+		} else if v := md.Get("token"); len(v) > 0 {
+			header = "Bearer " + v[0]
+		}
+	}
+
+	p, err := authenticateHeader(ctx, auth, header)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	if err := a.Authorize(ctx, p, m[method]...); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return WithPrincipal(ctx, p), nil
+}
+
+// UnaryServerInterceptor authenticates every call and checks the permissions
+// required by its method.
+func UnaryServerInterceptor(auth Authenticator, a *Authorizer, methods MethodPermissions) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := methods.authorize(ctx, auth, a, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+type principalStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *principalStream) Context() context.Context {
+	return s.ctx
+}
+
+func StreamServerInterceptor(auth Authenticator, a *Authorizer, methods MethodPermissions) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := methods.authorize(ss.Context(), auth, a, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &principalStream{ServerStream: ss, ctx: ctx})
+	}
+}
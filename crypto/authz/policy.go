@@ -0,0 +1,144 @@
+package authz
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Wildcard grants every permission, or every permission below a prefix when
+// used as the last segment, e.g. "orders:*".
+const Wildcard = "*"
+
+type Role struct {
+	Permissions []string `yaml:"permissions"`
+	// Inherits lists roles whose permissions are included in this role.
+	Inherits []string `yaml:"inherits,omitempty"`
+}
+
+// Policy maps roles to permissions and optionally binds subjects to roles.
+// Permissions are colon separated, e.g. "orders:read".
+type Policy struct {
+	Roles    map[string]Role     `yaml:"roles"`
+	Subjects map[string][]string `yaml:"subjects,omitempty"`
+}
+
+func ParsePolicyFile(f string) (*Policy, error) {
+	b, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := ParsePolicy(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", f, err)
+	}
+
+	return p, nil
+}
+
+func ParsePolicy(b []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Validate checks that inherited and bound roles exist and that inheritance
+// has no cycles.
+func (p *Policy) Validate() error {
+	for name, role := range p.Roles {
+		for _, parent := range role.Inherits {
+			if _, ok := p.Roles[parent]; !ok {
+				return fmt.Errorf("%w: %s inherits %s", ErrUnknownRole, name, parent)
+			}
+		}
+
+		if err := p.checkCycle(name, map[string]bool{}); err != nil {
+			return err
+		}
+	}
+
+	for subject, roles := range p.Subjects {
+		for _, role := range roles {
+			if _, ok := p.Roles[role]; !ok {
+				return fmt.Errorf("%w: %s bound to %s", ErrUnknownRole, role, subject)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *Policy) checkCycle(role string, visiting map[string]bool) error {
+	if visiting[role] {
+		return fmt.Errorf("%w: %s", ErrRoleCycle, role)
+	}
+
+	visiting[role] = true
+	for _, parent := range p.Roles[role].Inherits {
+		if err := p.checkCycle(parent, visiting); err != nil {
+			return err
+		}
+	}
+	delete(visiting, role)
+
+	return nil
+}
+
+// Permissions returns the permissions granted by the roles, including the
+// permissions of inherited roles. Unknown roles grant nothing.
+func (p *Policy) Permissions(roles ...string) []string {
+	seen := map[string]bool{}
+	var perms []string
+	var expand func(role string)
+	expand = func(role string) {
+		if seen[role] {
+			return
+		}
+		seen[role] = true
+
+		r, ok := p.Roles[role]
+		if !ok {
+			return
+		}
+
+		perms = append(perms, r.Permissions...)
+		for _, parent := range r.Inherits {
+			expand(parent)
+		}
+	}
+
+	for _, role := range roles {
+		expand(role)
+	}
+
+	return perms
+}
+
+// SubjectRoles returns the roles bound to the subject by the policy.
+func (p *Policy) SubjectRoles(subject string) []string {
+	return p.Subjects[subject]
+}
+
+// Match reports whether a granted permission covers the required one.
+func Match(granted, required string) bool {
+	if granted == Wildcard || granted == required {
+		return true
+	}
+
+	prefix, ok := strings.CutSuffix(granted, ":"+Wildcard)
+	if !ok {
+		return false
+	}
+
+	return strings.HasPrefix(required, prefix+":")
+}
@@ -0,0 +1,42 @@
+package authz
+
+import "context"
+
+// PermissionClaims is implemented by custom claims that carry roles and
+// permissions. Embed Claims in the custom claims of a ClaimsWrapper to
+// implement it.
+type PermissionClaims interface {
+	GetRoles() []string
+	GetPermissions() []string
+}
+
+type Claims struct {
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+func (c Claims) GetRoles() []string {
+	return c.Roles
+}
+
+func (c Claims) GetPermissions() []string {
+	return c.Permissions
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject     string
+	Roles       []string
+	Permissions []string
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
@@ -0,0 +1,219 @@
+package ca
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/ooqls/getset/log"
+	"go.uber.org/zap"
+)
+
+var l *zap.Logger = log.NewLogger("ca")
+
+const DefaultCRLValidity = 24 * time.Hour
+
+type authorityOptions struct {
+	crlValidity           time.Duration
+	crlDistributionPoints []string
+	ocspServers           []string
+}
+
+type authorityOption func(*authorityOptions)
+
+// WithCRLValidity sets how long a published CRL is valid. It is regenerated
+// once half of that time has passed or a certificate is revoked.
+func WithCRLValidity(d time.Duration) authorityOption {
+	return func(o *authorityOptions) {
+		o.crlValidity = d
+	}
+}
+
+// WithCRLDistributionPoints adds the URLs the CRL is published on to issued
+// certificates.
+func WithCRLDistributionPoints(urls ...string) authorityOption {
+	return func(o *authorityOptions) {
+		o.crlDistributionPoints = urls
+	}
+}
+
+// WithOCSPServers adds the URLs of OCSP responders serving Authority.OCSP to
+// issued certificates.
+func WithOCSPServers(urls ...string) authorityOption {
+	return func(o *authorityOptions) {
+		o.ocspServers = urls
+	}
+}
+
+// Authority issues certificates for CSRs that pass its policy, records them
+// in its store and publishes a CRL of the revoked ones.
+type Authority struct {
+	ca     *keys.X509
+	store  Store
+	policy Policy
+	opts   authorityOptions
+
+	m             sync.Mutex
+	crl           []byte
+	crlNextUpdate time.Time
+}
+
+func NewAuthority(ca *keys.X509, store Store, policy Policy, opts ...authorityOption) *Authority {
+	o := authorityOptions{crlValidity: DefaultCRLValidity}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Authority{
+		ca:     ca,
+		store:  store,
+		policy: policy,
+		opts:   o,
+	}
+}
+
+func (a *Authority) Certificate() x509.Certificate {
+	return a.ca.GetCertificate()
+}
+
+// CertificatePem returns the PEM encoded CA certificate clients should trust.
+func (a *Authority) CertificatePem() []byte {
+	_, crt := a.ca.Pem()
+	return crt
+}
+
+// Sign issues a certificate for the PEM or DER encoded CSR if the policy
+// allows the caller in ctx. A validity of zero issues the longest validity
+// the policy allows.
+func (a *Authority) Sign(ctx context.Context, csrB []byte, validity time.Duration) (*x509.Certificate, error) {
+	if err := a.policy.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	csr, err := keys.ParseCSR(csrB)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.policy.Check(csr); err != nil {
+		return nil, err
+	}
+
+	validity, err = a.policy.validity(validity)
+	if err != nil {
+		return nil, err
+	}
+
+	caCrt := a.ca.GetCertificate()
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(caCrt.NotAfter) {
+		return nil, fmt.Errorf("%w: validity exceeds the CA certificate's", ErrCertificateNotIssuable)
+	}
+
+	ku, eku := a.policy.keyUsage(csr)
+	crt, err := keys.SignCSR(*a.ca, csr,
+		keys.WithNotBefore(now.Add(-time.Minute)),
+		keys.WithNotAfter(notAfter),
+		keys.WithKeyUsage(ku),
+		keys.WithExtKeyUsage(eku),
+		keys.WithCRLDistributionPoints(a.opts.crlDistributionPoints),
+		keys.WithOCSPServers(a.opts.ocspServers))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.store.Put(ctx, crt); err != nil {
+		return nil, err
+	}
+
+	l.Info("issued certificate", zap.String("serial", serialKey(crt.SerialNumber)),
+		zap.String("subject", crt.Subject.String()), zap.Strings("sans", sans(crt)), zap.Time("not_after", notAfter))
+	return crt, nil
+}
+
+// Track records a certificate the CA issued outside of Sign, e.g. with
+// keys.CreateX509, so it can be revoked.
+func (a *Authority) Track(ctx context.Context, crt *x509.Certificate) error {
+	caCrt := a.ca.GetCertificate()
+	if err := crt.CheckSignatureFrom(&caCrt); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnknownIssuer, err)
+	}
+
+	return a.store.Put(ctx, crt)
+}
+
+// SignPem is Sign returning the PEM encoded certificate.
+func (a *Authority) SignPem(ctx context.Context, csrB []byte, validity time.Duration) ([]byte, error) {
+	crt, err := a.Sign(ctx, csrB, validity)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}), nil
+}
+
+// Revoke revokes the certificate with the reason code of RFC 5280 and
+// republishes the CRL on its next request.
+func (a *Authority) Revoke(ctx context.Context, serial *big.Int, reason int) error {
+	if err := a.store.Revoke(ctx, serial, reason, time.Now()); err != nil {
+		return err
+	}
+
+	a.m.Lock()
+	a.crl = nil
+	a.m.Unlock()
+
+	l.Info("revoked certificate", zap.String("serial", serialKey(serial)), zap.Int("reason", reason))
+	return nil
+}
+
+// CRL returns the DER encoded CRL of the revoked certificates.
+func (a *Authority) CRL(ctx context.Context) ([]byte, error) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	now := time.Now()
+	if a.crl != nil && now.Before(a.crlNextUpdate.Add(-a.opts.crlValidity/2)) {
+		return a.crl, nil
+	}
+
+	revoked, err := a.store.Revoked(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]x509.RevocationListEntry, 0, len(revoked))
+	for _, r := range revoked {
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   r.Serial,
+			RevocationTime: r.RevokedAt,
+			ReasonCode:     r.RevocationReason,
+		})
+	}
+
+	template := &x509.RevocationList{
+		// the time keeps CRL numbers increasing across restarts
+		Number:                    big.NewInt(now.UnixNano()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(a.opts.crlValidity),
+		RevokedCertificateEntries: entries,
+	}
+
+	caCrt := a.ca.GetCertificate()
+	priv, _ := a.ca.PrivateKey()
+	crl, err := x509.CreateRevocationList(rand.Reader, template, &caCrt, priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create crl: %v", err)
+	}
+
+	a.crl = crl
+	a.crlNextUpdate = template.NextUpdate
+	return crl, nil
+}
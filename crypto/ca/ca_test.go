@@ -0,0 +1,437 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/ooqls/getset/crypto/mtls"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	_ "modernc.org/sqlite"
+)
+
+func newAuthority(t *testing.T) *Authority {
+	caKey, err := keys.CreateX509CA(keys.WithCommonName("test CA"))
+	assert.Nil(t, err)
+
+	db, err := sql.Open("sqlite", t.TempDir()+"/ca.db")
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range Schema {
+		_, err := db.Exec(stmt)
+		assert.Nil(t, err)
+	}
+
+	_, ipRange, err := net.ParseCIDR("10.0.0.0/8")
+	assert.Nil(t, err)
+
+	return NewAuthority(caKey, NewSQLStore(db), Policy{
+		AllowAnyCaller:  true,
+		AllowedDNSNames: []string{"*.svc.local", "api.example.com"},
+		AllowedIPRanges: []*net.IPNet{ipRange},
+		MaxValidity:     time.Hour,
+	}, WithCRLDistributionPoints("http://ca.svc.local/ca/crl"))
+}
+
+func newCSR(t *testing.T, dnsNames []string, ips ...net.IP) []byte {
+	var cn string
+	if len(dnsNames) > 0 {
+		cn = dnsNames[0]
+	}
+
+	return newCSRWithCommonName(t, cn, dnsNames, ips...)
+}
+
+func newCSRWithCommonName(t *testing.T, cn string, dnsNames []string, ips ...net.IP) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: cn},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+	}, key)
+	assert.Nil(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func TestAuthority_Sign(t *testing.T) {
+	a := newAuthority(t)
+	ctx := context.Background()
+
+	crt, err := a.Sign(ctx, newCSR(t, []string{"orders.svc.local", "api.example.com"}, net.ParseIP("10.1.2.3")), 0)
+	assert.Nilf(t, err, "should sign allowed SANs")
+	assert.Equal(t, "orders.svc.local", crt.Subject.CommonName)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), crt.NotAfter, time.Minute, "should default to the max validity")
+	assert.Equal(t, x509.KeyUsageDigitalSignature, crt.KeyUsage)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, crt.ExtKeyUsage)
+	assert.Equal(t, []string{"http://ca.svc.local/ca/crl"}, crt.CRLDistributionPoints)
+
+	caCrt := a.Certificate()
+	pool := x509.NewCertPool()
+	pool.AddCert(&caCrt)
+	_, err = crt.Verify(x509.VerifyOptions{Roots: pool, DNSName: "orders.svc.local"})
+	assert.Nilf(t, err, "issued certificates should chain to the CA")
+
+	record, err := a.store.Get(ctx, crt.SerialNumber)
+	assert.Nilf(t, err, "should record issued certificates")
+	assert.Equal(t, crt.Raw, record.Certificate)
+	assert.Equal(t, []string{"orders.svc.local", "api.example.com", "10.1.2.3"}, record.SANs)
+
+	crt, err = a.Sign(ctx, newCSR(t, []string{"orders.svc.local"}), 30*time.Minute)
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now().Add(30*time.Minute), crt.NotAfter, time.Minute)
+
+	for name, csr := range map[string][]byte{
+		"other domain":    newCSR(t, []string{"orders.example.com"}),
+		"nested wildcard": newCSR(t, []string{"a.orders.svc.local"}),
+		"wildcard SAN":    newCSR(t, []string{"*.svc.local"}),
+		"other IP":        newCSR(t, nil, net.ParseIP("192.168.0.1")),
+		"no SANs":         newCSRWithCommonName(t, "orders.svc.local", nil),
+		"other CN":        newCSRWithCommonName(t, "admin", []string{"orders.svc.local"}),
+	} {
+		_, err := a.Sign(ctx, csr, 0)
+		assert.ErrorIsf(t, err, ErrPolicyViolation, "should refuse %s", name)
+	}
+
+	_, err = a.Sign(ctx, newCSR(t, []string{"orders.svc.local"}), 2*time.Hour)
+	assert.ErrorIsf(t, err, ErrPolicyViolation, "should refuse validities above the max")
+
+	_, err = a.Sign(ctx, []byte("not a csr"), 0)
+	assert.ErrorIs(t, err, ErrInvalidCSR)
+
+	records, err := a.store.List(ctx)
+	assert.Nil(t, err)
+	assert.Lenf(t, records, 2, "should only record issued certificates")
+}
+
+func TestAuthority_Callers(t *testing.T) {
+	a := newAuthority(t)
+	ctx := context.Background()
+	csr := newCSR(t, []string{"orders.svc.local"})
+
+	a.policy.AllowAnyCaller = false
+	_, err := a.Sign(ctx, csr, 0)
+	assert.ErrorIsf(t, err, ErrCallerNotAllowed, "should refuse every caller without allowed callers")
+
+	a.policy.AllowedCallers = []string{"provisioner.svc.local"}
+	_, err = a.Sign(ctx, csr, 0)
+	assert.ErrorIsf(t, err, ErrCallerNotAllowed, "should refuse callers without a client certificate")
+
+	caller := func(dnsName string, verified bool) context.Context {
+		return mtls.WithIdentity(ctx, mtls.NewIdentity(&x509.Certificate{DNSNames: []string{dnsName}}, verified))
+	}
+	_, err = a.Sign(caller("orders.svc.local", true), csr, 0)
+	assert.ErrorIsf(t, err, ErrCallerNotAllowed, "should refuse callers not on the list")
+
+	_, err = a.Sign(caller("provisioner.svc.local", false), csr, 0)
+	assert.ErrorIsf(t, err, ErrCallerNotAllowed, "should refuse unverified callers")
+
+	_, err = a.Sign(caller("provisioner.svc.local", true), csr, 0)
+	assert.Nilf(t, err, "should sign for allowed callers")
+
+	rec := httptest.NewRecorder()
+	a.policy.AllowedCallers = nil
+	Handler(a).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sign", bytes.NewReader(csr)))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestAuthority_CRL(t *testing.T) {
+	a := newAuthority(t)
+	ctx := context.Background()
+
+	crt, err := a.Sign(ctx, newCSR(t, []string{"orders.svc.local"}), 0)
+	assert.Nil(t, err)
+	_, err = a.Sign(ctx, newCSR(t, []string{"users.svc.local"}), 0)
+	assert.Nil(t, err)
+
+	der, err := a.CRL(ctx)
+	assert.Nil(t, err)
+	crl, err := x509.ParseRevocationList(der)
+	assert.Nil(t, err)
+	assert.Empty(t, crl.RevokedCertificateEntries)
+
+	cached, err := a.CRL(ctx)
+	assert.Nil(t, err)
+	assert.Equalf(t, der, cached, "should cache the crl")
+
+	assert.Nil(t, a.Revoke(ctx, crt.SerialNumber, 1))
+	assert.Nilf(t, a.Revoke(ctx, crt.SerialNumber, 4), "revoking twice should not fail")
+	assert.ErrorIs(t, a.Revoke(ctx, big.NewInt(1), 1), ErrCertificateNotFound)
+
+	der, err = a.CRL(ctx)
+	assert.Nil(t, err)
+	crl, err = x509.ParseRevocationList(der)
+	assert.Nil(t, err)
+
+	caCrt := a.Certificate()
+	assert.Nilf(t, crl.CheckSignatureFrom(&caCrt), "the crl should be signed by the CA")
+	if assert.Len(t, crl.RevokedCertificateEntries, 1) {
+		entry := crl.RevokedCertificateEntries[0]
+		assert.Equal(t, crt.SerialNumber, entry.SerialNumber)
+		assert.Equalf(t, 1, entry.ReasonCode, "should keep the first revocation")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	a := newAuthority(t)
+	srv := httptest.NewServer(http.StripPrefix("/ca", Handler(a)))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/ca/sign?validity=10m", "application/pkcs10", bytes.NewReader(newCSR(t, []string{"orders.svc.local"})))
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	block, _ := pem.Decode(body)
+	if assert.NotNil(t, block) {
+		crt, err := x509.ParseCertificate(block.Bytes)
+		assert.Nil(t, err)
+		assert.WithinDuration(t, time.Now().Add(10*time.Minute), crt.NotAfter, time.Minute)
+	}
+
+	for expected, req := range map[int]string{
+		http.StatusForbidden:  string(newCSR(t, []string{"orders.example.com"})),
+		http.StatusBadRequest: "not a csr",
+	} {
+		resp, err := http.Post(srv.URL+"/ca/sign", "application/pkcs10", bytes.NewReader([]byte(req)))
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, expected, resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/ca/crl")
+	assert.Nil(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	_, err = x509.ParseRevocationList(body)
+	assert.Nilf(t, err, "should serve the crl")
+
+	resp, err = http.Get(srv.URL + "/ca/ca.pem")
+	assert.Nil(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, a.CertificatePem(), body)
+}
+
+func TestGrpc(t *testing.T) {
+	a := newAuthority(t)
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	RegisterGrpc(srv, a)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	client := NewGrpcClient(conn)
+	ctx := context.Background()
+
+	crt, err := client.Sign(ctx, newCSR(t, []string{"orders.svc.local"}))
+	assert.Nil(t, err)
+	assert.Contains(t, string(crt), "CERTIFICATE")
+
+	_, err = client.Sign(ctx, newCSR(t, []string{"orders.example.com"}))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	crl, err := client.CRL(ctx)
+	assert.Nil(t, err)
+	_, err = x509.ParseRevocationList(crl)
+	assert.Nil(t, err)
+
+	caPem, err := client.CACertificate(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, a.CertificatePem(), caPem)
+}
+
+func TestPolicyConfig(t *testing.T) {
+	cfg := PolicyConfig{
+		AllowedDNSNames:    []string{"*.svc.local"},
+		AllowedIPRanges:    []string{"10.0.0.0/8"},
+		MaxValiditySeconds: 3600,
+		KeyUsages:          []string{"digital_signature", "key_encipherment"},
+		ExtKeyUsages:       []string{"server_auth"},
+	}
+
+	p, err := cfg.Policy()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Hour, p.MaxValidity)
+	assert.Equal(t, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment, p.KeyUsage)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, p.ExtKeyUsage)
+	assert.True(t, p.allowsIP(net.ParseIP("10.2.3.4")))
+
+	cfg.KeyUsages = []string{"cert_sign"}
+	_, err = cfg.Policy()
+	assert.ErrorIsf(t, err, ErrUnknownKeyUsage, "should not allow issuing CA certificates")
+}
+
+func TestAuthority_OCSP(t *testing.T) {
+	a := newAuthority(t)
+	ctx := context.Background()
+	srv := httptest.NewServer(http.StripPrefix("/ca", Handler(a)))
+	defer srv.Close()
+
+	crt, err := a.Sign(ctx, newCSR(t, []string{"orders.svc.local"}), 0)
+	assert.Nil(t, err)
+	caCrt := a.Certificate()
+
+	query := func(crt *x509.Certificate) *ocsp.Response {
+		req, err := ocsp.CreateRequest(crt, &caCrt, nil)
+		assert.Nil(t, err)
+		resp, err := http.Post(srv.URL+"/ca/ocsp", "application/ocsp-request", bytes.NewReader(req))
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		r, err := ocsp.ParseResponseForCert(body, crt, &caCrt)
+		assert.Nil(t, err)
+		return r
+	}
+
+	assert.Equal(t, ocsp.Good, query(crt).Status)
+
+	assert.Nil(t, a.Revoke(ctx, crt.SerialNumber, ocsp.KeyCompromise))
+	r := query(crt)
+	assert.Equal(t, ocsp.Revoked, r.Status)
+	assert.Equal(t, ocsp.KeyCompromise, r.RevocationReason)
+
+	untracked, err := keys.CreateX509(*a.ca)
+	assert.Nil(t, err)
+	untrackedCrt := untracked.GetCertificate()
+	assert.Equalf(t, ocsp.Unknown, query(&untrackedCrt).Status, "should not vouch for certificates it does not know")
+
+	assert.Nilf(t, a.Track(ctx, &untrackedCrt), "should track certificates issued by the CA")
+	assert.Equal(t, ocsp.Good, query(&untrackedCrt).Status)
+
+	other, err := keys.CreateX509CA()
+	assert.Nil(t, err)
+	otherCrt := other.GetCertificate()
+	assert.ErrorIsf(t, a.Track(ctx, &otherCrt), ErrUnknownIssuer, "should not track certificates of other CAs")
+
+	_, err = a.OCSP(ctx, []byte("not a request"))
+	assert.ErrorIs(t, err, ErrInvalidOCSPRequest)
+}
+
+func TestRevocationChecker(t *testing.T) {
+	a := newAuthority(t)
+	ctx := context.Background()
+	srv := httptest.NewServer(http.StripPrefix("/ca", Handler(a)))
+	defer srv.Close()
+	a.opts.crlDistributionPoints = []string{srv.URL + "/ca/crl"}
+	a.opts.ocspServers = []string{srv.URL + "/ca/ocsp"}
+
+	good, err := a.Sign(ctx, newCSR(t, []string{"orders.svc.local"}), 0)
+	assert.Nil(t, err)
+	revoked, err := a.Sign(ctx, newCSR(t, []string{"users.svc.local"}), 0)
+	assert.Nil(t, err)
+	assert.Nil(t, a.Revoke(ctx, revoked.SerialNumber, ocsp.Superseded))
+	caCrt := a.Certificate()
+
+	for _, mode := range []RevocationMode{RevocationCheckCRL, RevocationCheckOCSP} {
+		c := NewRevocationChecker(mode)
+		assert.Nilf(t, c.Check(ctx, good, &caCrt), "%s: should accept good certificates", mode)
+		assert.ErrorIsf(t, c.Check(ctx, revoked, &caCrt), ErrCertificateRevoked, "%s: should reject revoked certificates", mode)
+		assert.ErrorIsf(t, c.VerifyConnection(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{revoked, &caCrt}}}),
+			ErrCertificateRevoked, "%s: should reject revoked peers", mode)
+	}
+
+	srv.Close()
+	c := NewRevocationChecker(RevocationCheckOCSP)
+	assert.ErrorIs(t, c.Check(ctx, good, &caCrt), ErrRevocationUnavailable)
+	c = NewRevocationChecker(RevocationCheckOCSP, WithSoftFail(true))
+	assert.Nilf(t, c.Check(ctx, good, &caCrt), "soft fail should accept unavailable responders")
+
+	_, err = ParseRevocationMode("always")
+	assert.ErrorIs(t, err, ErrUnknownRevocationMode)
+}
+
+func TestRevocationChecker_StaleResponses(t *testing.T) {
+	a := newAuthority(t)
+	ctx := context.Background()
+	caCrt := a.Certificate()
+	priv, _ := a.ca.PrivateKey()
+
+	var thisUpdate, nextUpdate time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/crl" {
+			crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+				Number:     big.NewInt(1),
+				ThisUpdate: thisUpdate,
+				NextUpdate: nextUpdate,
+			}, &caCrt, priv)
+			assert.Nil(t, err)
+			w.Write(crl)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		assert.Nil(t, err)
+		resp, err := ocsp.CreateResponse(&caCrt, &caCrt, ocsp.Response{
+			SerialNumber: req.SerialNumber,
+			Status:       ocsp.Good,
+			ThisUpdate:   thisUpdate,
+			NextUpdate:   nextUpdate,
+		}, priv)
+		assert.Nil(t, err)
+		w.Write(resp)
+	}))
+	defer srv.Close()
+	a.opts.crlDistributionPoints = []string{srv.URL + "/crl"}
+	a.opts.ocspServers = []string{srv.URL + "/ocsp"}
+
+	crt, err := a.Sign(ctx, newCSR(t, []string{"orders.svc.local"}), 0)
+	assert.Nil(t, err)
+
+	for _, tc := range []struct {
+		name       string
+		thisUpdate time.Time
+		nextUpdate time.Time
+		modes      []RevocationMode
+	}{
+		{"expired", time.Now().Add(-2 * time.Hour), time.Now().Add(-time.Hour), []RevocationMode{RevocationCheckCRL, RevocationCheckOCSP}},
+		{"too old", time.Now().Add(-DefaultMaxOCSPAge - time.Hour), time.Now().Add(time.Hour), []RevocationMode{RevocationCheckOCSP}},
+	} {
+		thisUpdate, nextUpdate = tc.thisUpdate, tc.nextUpdate
+		for _, mode := range tc.modes {
+			c := NewRevocationChecker(mode)
+			assert.ErrorIsf(t, c.Check(ctx, crt, &caCrt), ErrRevocationUnavailable, "%s: should reject %s responses", mode, tc.name)
+
+			c = NewRevocationChecker(mode, WithSoftFail(true))
+			assert.Nilf(t, c.Check(ctx, crt, &caCrt), "%s: soft fail should accept %s responses", mode, tc.name)
+		}
+	}
+
+	thisUpdate, nextUpdate = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	for _, mode := range []RevocationMode{RevocationCheckCRL, RevocationCheckOCSP} {
+		assert.Nilf(t, NewRevocationChecker(mode).Check(ctx, crt, &caCrt), "%s: should accept fresh responses", mode)
+	}
+	assert.ErrorIsf(t, NewRevocationChecker(RevocationCheckOCSP, WithMaxOCSPAge(time.Minute)).Check(ctx, crt, &caCrt),
+		ErrRevocationUnavailable, "should honour a configured max age")
+}
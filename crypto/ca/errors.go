@@ -0,0 +1,21 @@
+package ca
+
+import (
+	"errors"
+
+	"github.com/ooqls/getset/crypto/keys"
+)
+
+var (
+	ErrInvalidCSR             = keys.ErrInvalidCSR
+	ErrPolicyViolation        = errors.New("request violates the issuance policy")
+	ErrCallerNotAllowed       = errors.New("caller is not allowed to sign certificates")
+	ErrCertificateNotFound    = errors.New("certificate not found")
+	ErrUnknownKeyUsage        = errors.New("unknown key usage")
+	ErrCertificateNotIssuable = errors.New("certificate can not be issued")
+	ErrUnknownIssuer          = errors.New("certificate not issued by this authority")
+	ErrInvalidOCSPRequest     = errors.New("invalid ocsp request")
+	ErrCertificateRevoked     = errors.New("certificate is revoked")
+	ErrRevocationUnavailable  = errors.New("revocation status unavailable")
+	ErrUnknownRevocationMode  = errors.New("unknown revocation check mode")
+)
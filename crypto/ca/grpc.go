@@ -0,0 +1,132 @@
+package ca
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// The gRPC service uses well known types, so clients need no generated code:
+// Sign takes the CSR as BytesValue and returns the PEM certificate with the
+// longest validity the policy allows, GetCRL returns the DER CRL and
+// GetCACertificate the PEM CA certificate.
+const (
+	GrpcServiceName            = "getset.ca.v1.CertificateAuthority"
+	GrpcMethodSign             = "/" + GrpcServiceName + "/Sign"
+	GrpcMethodGetCRL           = "/" + GrpcServiceName + "/GetCRL"
+	GrpcMethodGetCACertificate = "/" + GrpcServiceName + "/GetCACertificate"
+)
+
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidCSR):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrPolicyViolation), errors.Is(err, ErrCertificateNotIssuable), errors.Is(err, ErrCallerNotAllowed):
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+type grpcServer struct {
+	a *Authority
+}
+
+func (s *grpcServer) sign(ctx context.Context, req *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error) {
+	crt, err := s.a.SignPem(ctx, req.GetValue(), 0)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return wrapperspb.Bytes(crt), nil
+}
+
+func (s *grpcServer) getCRL(ctx context.Context, _ *emptypb.Empty) (*wrapperspb.BytesValue, error) {
+	crl, err := s.a.CRL(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return wrapperspb.Bytes(crl), nil
+}
+
+func (s *grpcServer) getCACertificate(ctx context.Context, _ *emptypb.Empty) (*wrapperspb.BytesValue, error) {
+	return wrapperspb.Bytes(s.a.CertificatePem()), nil
+}
+
+func unaryHandler[Req any](method string, call func(*grpcServer, context.Context, *Req) (*wrapperspb.BytesValue, error)) grpc.MethodHandler {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		req := new(Req)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+
+		s := srv.(*grpcServer)
+		if interceptor == nil {
+			return call(s, ctx, req)
+		}
+
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: method}
+		return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+			return call(s, ctx, req.(*Req))
+		})
+	}
+}
+
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: GrpcServiceName,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Sign", Handler: unaryHandler(GrpcMethodSign, (*grpcServer).sign)},
+		{MethodName: "GetCRL", Handler: unaryHandler(GrpcMethodGetCRL, (*grpcServer).getCRL)},
+		{MethodName: "GetCACertificate", Handler: unaryHandler(GrpcMethodGetCACertificate, (*grpcServer).getCACertificate)},
+	},
+}
+
+// RegisterGrpc registers the authority's service with the server. Use the
+// authz interceptors with the GrpcMethod names to restrict issuance.
+func RegisterGrpc(s grpc.ServiceRegistrar, a *Authority) {
+	s.RegisterService(&grpcServiceDesc, &grpcServer{a: a})
+}
+
+// GrpcClient calls the service of an authority.
+type GrpcClient struct {
+	conn grpc.ClientConnInterface
+}
+
+func NewGrpcClient(conn grpc.ClientConnInterface) *GrpcClient {
+	return &GrpcClient{conn: conn}
+}
+
+// Sign sends the PEM or DER CSR and returns the PEM certificate.
+func (c *GrpcClient) Sign(ctx context.Context, csr []byte) ([]byte, error) {
+	var out wrapperspb.BytesValue
+	if err := c.conn.Invoke(ctx, GrpcMethodSign, wrapperspb.Bytes(csr), &out); err != nil {
+		return nil, err
+	}
+
+	return out.GetValue(), nil
+}
+
+func (c *GrpcClient) CRL(ctx context.Context) ([]byte, error) {
+	var out wrapperspb.BytesValue
+	if err := c.conn.Invoke(ctx, GrpcMethodGetCRL, &emptypb.Empty{}, &out); err != nil {
+		return nil, err
+	}
+
+	return out.GetValue(), nil
+}
+
+func (c *GrpcClient) CACertificate(ctx context.Context) ([]byte, error) {
+	var out wrapperspb.BytesValue
+	if err := c.conn.Invoke(ctx, GrpcMethodGetCACertificate, &emptypb.Empty{}, &out); err != nil {
+		return nil, err
+	}
+
+	return out.GetValue(), nil
+}
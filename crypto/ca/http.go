@@ -0,0 +1,130 @@
+package ca
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ocsp"
+)
+
+// maxCSRSize limits request bodies, CSRs are a few KB at most.
+const maxCSRSize = 64 * 1024
+
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidCSR):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrPolicyViolation), errors.Is(err, ErrCertificateNotIssuable), errors.Is(err, ErrCallerNotAllowed):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Handler serves the authority relative to where it is mounted:
+//
+//	POST /sign    PEM or DER CSR, optional "validity" query such as "24h",
+//	              responds with the PEM certificate
+//	GET  /crl     DER encoded CRL
+//	GET  /ca.pem  PEM CA certificate
+//	POST /ocsp    OCSP responder, see OCSPHandler
+//
+// Only the callers the policy allows may sign, identified by the client
+// certificate that mtls.HTTPIdentity stores in the request context.
+func Handler(a *Authority) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sign", func(w http.ResponseWriter, r *http.Request) {
+		var validity time.Duration
+		if v := r.URL.Query().Get("validity"); v != "" {
+			var err error
+			if validity, err = time.ParseDuration(v); err != nil {
+				http.Error(w, fmt.Sprintf("invalid validity %q", v), http.StatusBadRequest)
+				return
+			}
+		}
+
+		csr, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCSRSize))
+		if err != nil {
+			http.Error(w, "failed to read request", http.StatusBadRequest)
+			return
+		}
+
+		crt, err := a.SignPem(r.Context(), csr, validity)
+		if err != nil {
+			l.Debug("refused to sign csr", zap.Error(err))
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Write(crt)
+	})
+	mux.HandleFunc("GET /crl", func(w http.ResponseWriter, r *http.Request) {
+		crl, err := a.CRL(r.Context())
+		if err != nil {
+			l.Error("failed to create crl", zap.Error(err))
+			http.Error(w, "failed to create crl", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/pkix-crl")
+		w.Write(crl)
+	})
+	mux.Handle("POST /ocsp", OCSPHandler(a))
+	mux.Handle("GET /ocsp/", http.StripPrefix("/ocsp", OCSPHandler(a)))
+	mux.HandleFunc("GET /ca.pem", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Write(a.CertificatePem())
+	})
+
+	return mux
+}
+
+// ocspErrorResponse maps errors to the unsigned OCSP error responses, which
+// are sent with status 200 like any other OCSP response.
+func ocspErrorResponse(err error) []byte {
+	switch {
+	case errors.Is(err, ErrInvalidOCSPRequest):
+		return ocsp.MalformedRequestErrorResponse
+	case errors.Is(err, ErrUnknownIssuer):
+		return ocsp.UnauthorizedErrorResponse
+	default:
+		return ocsp.InternalErrorErrorResponse
+	}
+}
+
+// OCSPHandler serves the authority's OCSP responder for DER requests POSTed
+// as the body or, as RFC 6960 allows for GET, base64 encoded in the path.
+func OCSPHandler(a *Authority) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req []byte
+		var err error
+		switch r.Method {
+		case http.MethodPost:
+			req, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxCSRSize))
+		case http.MethodGet:
+			req, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(r.URL.Path, "/"))
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		resp := ocsp.MalformedRequestErrorResponse
+		if err == nil {
+			resp, err = a.OCSP(r.Context(), req)
+			if err != nil {
+				l.Debug("failed to answer ocsp request", zap.Error(err))
+				resp = ocspErrorResponse(err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	})
+}
@@ -0,0 +1,81 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// issuerKeyHash hashes the CA's public key the way OCSP requests identify
+// their issuer.
+func (a *Authority) issuerKeyHash(req *ocsp.Request) ([]byte, error) {
+	caCrt := a.ca.GetCertificate()
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(caCrt.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, fmt.Errorf("failed to parse ca public key: %v", err)
+	}
+
+	if !req.HashAlgorithm.Available() {
+		return nil, fmt.Errorf("%w: unsupported hash algorithm %s", ErrInvalidOCSPRequest, req.HashAlgorithm)
+	}
+
+	h := req.HashAlgorithm.New()
+	h.Write(spki.PublicKey.RightAlign())
+	return h.Sum(nil), nil
+}
+
+// OCSP answers the DER encoded OCSP request with a response signed by the CA.
+// Serials the store does not know are reported as unknown, requests for other
+// issuers return ErrUnknownIssuer.
+func (a *Authority) OCSP(ctx context.Context, reqB []byte) ([]byte, error) {
+	req, err := ocsp.ParseRequest(reqB)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOCSPRequest, err)
+	}
+
+	keyHash, err := a.issuerKeyHash(req)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(keyHash, req.IssuerKeyHash) {
+		return nil, ErrUnknownIssuer
+	}
+
+	now := time.Now()
+	template := ocsp.Response{
+		SerialNumber: req.SerialNumber,
+		Status:       ocsp.Good,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(a.opts.crlValidity),
+	}
+
+	record, err := a.store.Get(ctx, req.SerialNumber)
+	switch {
+	case errors.Is(err, ErrCertificateNotFound):
+		template.Status = ocsp.Unknown
+	case err != nil:
+		return nil, err
+	case record.Revoked():
+		template.Status = ocsp.Revoked
+		template.RevokedAt = record.RevokedAt
+		template.RevocationReason = record.RevocationReason
+	}
+
+	caCrt := a.ca.GetCertificate()
+	priv, _ := a.ca.PrivateKey()
+	resp, err := ocsp.CreateResponse(&caCrt, &caCrt, template, priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ocsp response: %v", err)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,242 @@
+package ca
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ooqls/getset/crypto/mtls"
+)
+
+const DefaultMaxValidity = 30 * 24 * time.Hour
+
+// Policy decides who may have certificate signing requests issued, which
+// ones and with which key usages. The subject common name must be empty or
+// one of the requested SANs.
+type Policy struct {
+	// AllowedCallers are the client certificate SANs of the callers allowed
+	// to sign, see mtls.AllowList. Nobody may sign if it is empty and
+	// AllowAnyCaller is not set.
+	AllowedCallers mtls.AllowList
+	// AllowAnyCaller lets every caller sign, for authorities that are
+	// guarded otherwise, e.g. mounted behind authz.HTTPRequire.
+	AllowAnyCaller bool
+	// AllowedDNSNames are exact names or wildcards such as "*.svc.local",
+	// which match a single label. No DNS SANs are allowed if empty.
+	AllowedDNSNames []string
+	// AllowedIPRanges contain the IP SANs that are allowed. No IP SANs are
+	// allowed if empty.
+	AllowedIPRanges []*net.IPNet
+	// MaxValidity is the longest validity that is issued and the validity of
+	// requests that do not ask for one. Defaults to DefaultMaxValidity.
+	MaxValidity time.Duration
+	// KeyUsage defaults to digital signature, plus key encipherment for RSA
+	// keys.
+	KeyUsage x509.KeyUsage
+	// ExtKeyUsage defaults to server and client authentication.
+	ExtKeyUsage []x509.ExtKeyUsage
+}
+
+func (p *Policy) maxValidity() time.Duration {
+	if p.MaxValidity <= 0 {
+		return DefaultMaxValidity
+	}
+
+	return p.MaxValidity
+}
+
+// validity returns the validity to issue for a request asking for requested,
+// zero asks for the maximum.
+func (p *Policy) validity(requested time.Duration) (time.Duration, error) {
+	if requested <= 0 {
+		return p.maxValidity(), nil
+	}
+
+	if requested > p.maxValidity() {
+		return 0, fmt.Errorf("%w: validity %s exceeds %s", ErrPolicyViolation, requested, p.maxValidity())
+	}
+
+	return requested, nil
+}
+
+func (p *Policy) keyUsage(csr *x509.CertificateRequest) (x509.KeyUsage, []x509.ExtKeyUsage) {
+	ku := p.KeyUsage
+	if ku == 0 {
+		ku = x509.KeyUsageDigitalSignature
+		if _, ok := csr.PublicKey.(*rsa.PublicKey); ok {
+			ku |= x509.KeyUsageKeyEncipherment
+		}
+	}
+
+	eku := p.ExtKeyUsage
+	if len(eku) == 0 {
+		eku = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	}
+
+	return ku, eku
+}
+
+// authorize returns an ErrCallerNotAllowed unless the client certificate
+// identity in ctx, see mtls.IdentityFromContext, is an allowed caller.
+func (p *Policy) authorize(ctx context.Context) error {
+	if p.AllowAnyCaller {
+		return nil
+	}
+
+	if len(p.AllowedCallers) == 0 {
+		return fmt.Errorf("%w: no callers are allowed to sign", ErrCallerNotAllowed)
+	}
+
+	id, _ := mtls.IdentityFromContext(ctx)
+	if err := p.AllowedCallers.Check(id); err != nil {
+		return fmt.Errorf("%w: %v", ErrCallerNotAllowed, err)
+	}
+
+	return nil
+}
+
+// Check returns an ErrPolicyViolation for SANs the policy does not allow, a
+// CSR without DNS or IP SANs and a common name that is not one of them.
+// Email and URI SANs are never allowed.
+func (p *Policy) Check(csr *x509.CertificateRequest) error {
+	if len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
+		return fmt.Errorf("%w: email and URI SANs are not supported", ErrPolicyViolation)
+	}
+
+	if len(csr.DNSNames) == 0 && len(csr.IPAddresses) == 0 {
+		return fmt.Errorf("%w: a DNS or IP SAN is required", ErrPolicyViolation)
+	}
+
+	if cn := csr.Subject.CommonName; cn != "" && !hasSAN(csr, cn) {
+		return fmt.Errorf("%w: common name %s is not one of the SANs", ErrPolicyViolation, cn)
+	}
+
+	for _, name := range csr.DNSNames {
+		if !p.allowsDNSName(name) {
+			return fmt.Errorf("%w: DNS name %s is not allowed", ErrPolicyViolation, name)
+		}
+	}
+
+	for _, ip := range csr.IPAddresses {
+		if !p.allowsIP(ip) {
+			return fmt.Errorf("%w: IP address %s is not allowed", ErrPolicyViolation, ip)
+		}
+	}
+
+	return nil
+}
+
+func hasSAN(csr *x509.CertificateRequest, name string) bool {
+	for _, dnsName := range csr.DNSNames {
+		if strings.EqualFold(dnsName, name) {
+			return true
+		}
+	}
+
+	for _, ip := range csr.IPAddresses {
+		if ip.String() == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) allowsDNSName(name string) bool {
+	name = strings.ToLower(name)
+	for _, allowed := range p.AllowedDNSNames {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			label, rest, found := strings.Cut(name, ".")
+			if found && label != "" && label != "*" && rest == suffix {
+				return true
+			}
+			continue
+		}
+
+		if name == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) allowsIP(ip net.IP) bool {
+	for _, r := range p.AllowedIPRanges {
+		if r.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PolicyConfig is the YAML form of a Policy.
+type PolicyConfig struct {
+	AllowedCallers     []string `yaml:"allowed_callers"`
+	AllowAnyCaller     bool     `yaml:"allow_any_caller"`
+	AllowedDNSNames    []string `yaml:"allowed_dns_names"`
+	AllowedIPRanges    []string `yaml:"allowed_ip_ranges"`
+	MaxValiditySeconds int      `yaml:"max_validity_seconds"`
+	KeyUsages          []string `yaml:"key_usages"`
+	ExtKeyUsages       []string `yaml:"ext_key_usages"`
+}
+
+var keyUsages = map[string]x509.KeyUsage{
+	"digital_signature":  x509.KeyUsageDigitalSignature,
+	"content_commitment": x509.KeyUsageContentCommitment,
+	"key_encipherment":   x509.KeyUsageKeyEncipherment,
+	"data_encipherment":  x509.KeyUsageDataEncipherment,
+	"key_agreement":      x509.KeyUsageKeyAgreement,
+}
+
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"server_auth":      x509.ExtKeyUsageServerAuth,
+	"client_auth":      x509.ExtKeyUsageClientAuth,
+	"code_signing":     x509.ExtKeyUsageCodeSigning,
+	"email_protection": x509.ExtKeyUsageEmailProtection,
+	"time_stamping":    x509.ExtKeyUsageTimeStamping,
+	"ocsp_signing":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// Policy parses the IP ranges as CIDRs and the key usages by their snake
+// case names, e.g. "digital_signature" or "server_auth".
+func (c *PolicyConfig) Policy() (*Policy, error) {
+	p := Policy{
+		AllowedCallers:  c.AllowedCallers,
+		AllowAnyCaller:  c.AllowAnyCaller,
+		AllowedDNSNames: c.AllowedDNSNames,
+		MaxValidity:     time.Duration(c.MaxValiditySeconds) * time.Second,
+	}
+
+	for _, cidr := range c.AllowedIPRanges {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse allowed ip range %s: %v", cidr, err)
+		}
+		p.AllowedIPRanges = append(p.AllowedIPRanges, ipNet)
+	}
+
+	for _, name := range c.KeyUsages {
+		ku, ok := keyUsages[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownKeyUsage, name)
+		}
+		p.KeyUsage |= ku
+	}
+
+	for _, name := range c.ExtKeyUsages {
+		eku, ok := extKeyUsages[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownKeyUsage, name)
+		}
+		p.ExtKeyUsage = append(p.ExtKeyUsage, eku)
+	}
+
+	return &p, nil
+}
@@ -0,0 +1,317 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ocsp"
+)
+
+// RevocationMode selects how peer certificates are checked for revocation.
+type RevocationMode string
+
+const (
+	RevocationCheckNone RevocationMode = ""
+	// RevocationCheckCRL checks the CRLs of the certificates' distribution
+	// points.
+	RevocationCheckCRL RevocationMode = "crl"
+	// RevocationCheckOCSP asks the certificates' OCSP responders and falls
+	// back to their CRLs when they list none.
+	RevocationCheckOCSP RevocationMode = "ocsp"
+)
+
+// maxRevocationResponseSize limits CRL and OCSP response bodies.
+const maxRevocationResponseSize = 10 * 1024 * 1024
+
+// DefaultMaxOCSPAge is how old an OCSP response may be, measured from its
+// this update time, before it is no longer trusted.
+const DefaultMaxOCSPAge = 7 * 24 * time.Hour
+
+func ParseRevocationMode(s string) (RevocationMode, error) {
+	switch m := RevocationMode(s); m {
+	case RevocationCheckNone, RevocationCheckCRL, RevocationCheckOCSP:
+		return m, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownRevocationMode, s)
+	}
+}
+
+type revocationOptions struct {
+	softFail   bool
+	client     *http.Client
+	maxOCSPAge time.Duration
+}
+
+type revocationOption func(*revocationOptions)
+
+// WithSoftFail accepts certificates whose revocation status can not be
+// fetched instead of failing the handshake. Revoked certificates are always
+// rejected.
+func WithSoftFail(softFail bool) revocationOption {
+	return func(o *revocationOptions) {
+		o.softFail = softFail
+	}
+}
+
+// WithMaxOCSPAge sets how old an OCSP response may be, DefaultMaxOCSPAge by
+// default. Older responses are treated as unavailable, as a responder could
+// otherwise replay a good status from before the certificate was revoked.
+func WithMaxOCSPAge(d time.Duration) revocationOption {
+	return func(o *revocationOptions) {
+		o.maxOCSPAge = d
+	}
+}
+
+// WithHTTPClient sets the client CRLs and OCSP responses are fetched with.
+func WithHTTPClient(c *http.Client) revocationOption {
+	return func(o *revocationOptions) {
+		o.client = c
+	}
+}
+
+type cachedCRL struct {
+	crl        *x509.RevocationList
+	nextUpdate time.Time
+}
+
+type cachedOCSP struct {
+	resp       *ocsp.Response
+	nextUpdate time.Time
+}
+
+// RevocationChecker checks certificates against the CRL distribution points
+// and OCSP responders they list, caching responses until their next update.
+// Certificates listing neither are not checked.
+type RevocationChecker struct {
+	mode RevocationMode
+	opts revocationOptions
+
+	m    sync.Mutex
+	crls map[string]cachedCRL
+	ocsp map[string]cachedOCSP
+}
+
+func NewRevocationChecker(mode RevocationMode, opts ...revocationOption) *RevocationChecker {
+	o := revocationOptions{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		maxOCSPAge: DefaultMaxOCSPAge,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &RevocationChecker{
+		mode: mode,
+		opts: o,
+		crls: map[string]cachedCRL{},
+		ocsp: map[string]cachedOCSP{},
+	}
+}
+
+// VerifyConnection checks the verified chains of a TLS connection, set it as
+// tls.Config.VerifyConnection. Servers only verify client certificates when
+// ClientAuth requires verification.
+func (c *RevocationChecker) VerifyConnection(cs tls.ConnectionState) error {
+	for _, chain := range cs.VerifiedChains {
+		for i := 0; i < len(chain)-1; i++ {
+			if err := c.Check(context.Background(), chain[i], chain[i+1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Check returns ErrCertificateRevoked if the certificate issued by issuer is
+// revoked and ErrRevocationUnavailable if its status could not be fetched,
+// unless soft fail is enabled.
+func (c *RevocationChecker) Check(ctx context.Context, crt, issuer *x509.Certificate) error {
+	var err error
+	switch {
+	case c.mode == RevocationCheckNone:
+		return nil
+	case c.mode == RevocationCheckOCSP && len(crt.OCSPServer) > 0:
+		err = c.checkOCSP(ctx, crt, issuer)
+	case len(crt.CRLDistributionPoints) > 0:
+		err = c.checkCRL(ctx, crt, issuer)
+	}
+
+	if err != nil && c.opts.softFail && !errors.Is(err, ErrCertificateRevoked) {
+		l.Warn("failed to check certificate revocation", zap.String("subject", crt.Subject.String()), zap.Error(err))
+		return nil
+	}
+
+	return err
+}
+
+func (c *RevocationChecker) fetch(ctx context.Context, req *http.Request) ([]byte, error) {
+	resp, err := c.opts.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxRevocationResponseSize))
+}
+
+func (c *RevocationChecker) crl(ctx context.Context, url string, issuer *x509.Certificate) (*x509.RevocationList, error) {
+	c.m.Lock()
+	cached, ok := c.crls[url]
+	c.m.Unlock()
+	if ok && time.Now().Before(cached.nextUpdate) {
+		return cached.crl, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.fetch(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch crl %s: %v", url, err)
+	}
+
+	crl, err := x509.ParseRevocationList(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse crl %s: %v", url, err)
+	}
+
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("crl %s is not signed by the issuer: %v", url, err)
+	}
+
+	if !crl.NextUpdate.IsZero() && !time.Now().Before(crl.NextUpdate) {
+		return nil, fmt.Errorf("crl %s expired at %s", url, crl.NextUpdate)
+	}
+
+	c.m.Lock()
+	c.crls[url] = cachedCRL{crl: crl, nextUpdate: crl.NextUpdate}
+	c.m.Unlock()
+	return crl, nil
+}
+
+func (c *RevocationChecker) checkCRL(ctx context.Context, crt, issuer *x509.Certificate) error {
+	var lastErr error
+	for _, url := range crt.CRLDistributionPoints {
+		crl, err := c.crl(ctx, url, issuer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(crt.SerialNumber) == 0 {
+				return fmt.Errorf("%w: %s", ErrCertificateRevoked, serialKey(crt.SerialNumber))
+			}
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: %v", ErrRevocationUnavailable, lastErr)
+}
+
+func (c *RevocationChecker) checkOCSP(ctx context.Context, crt, issuer *x509.Certificate) error {
+	key := string(issuer.RawSubjectPublicKeyInfo) + serialKey(crt.SerialNumber)
+	c.m.Lock()
+	cached, ok := c.ocsp[key]
+	c.m.Unlock()
+
+	resp := cached.resp
+	if !ok || !time.Now().Before(cached.nextUpdate) {
+		var err error
+		if resp, err = c.fetchOCSP(ctx, crt, issuer); err != nil {
+			return fmt.Errorf("%w: %v", ErrRevocationUnavailable, err)
+		}
+
+		if !resp.NextUpdate.IsZero() {
+			// stop using the response once it is too old, even if the
+			// responder claims it is valid for longer
+			nextUpdate := resp.NextUpdate
+			if maxAge := resp.ThisUpdate.Add(c.opts.maxOCSPAge); maxAge.Before(nextUpdate) {
+				nextUpdate = maxAge
+			}
+
+			c.m.Lock()
+			c.ocsp[key] = cachedOCSP{resp: resp, nextUpdate: nextUpdate}
+			c.m.Unlock()
+		}
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return fmt.Errorf("%w: %s", ErrCertificateRevoked, serialKey(crt.SerialNumber))
+	default:
+		return fmt.Errorf("%w: responder does not know %s", ErrRevocationUnavailable, serialKey(crt.SerialNumber))
+	}
+}
+
+func (c *RevocationChecker) fetchOCSP(ctx context.Context, crt, issuer *x509.Certificate) (*ocsp.Response, error) {
+	reqB, err := ocsp.CreateRequest(crt, issuer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ocsp request: %v", err)
+	}
+
+	var lastErr error
+	for _, url := range crt.OCSPServer {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(reqB))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		req.Header.Set("Content-Type", "application/ocsp-request")
+
+		b, err := c.fetch(ctx, req)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to query ocsp responder %s: %v", url, err)
+			continue
+		}
+
+		resp, err := ocsp.ParseResponseForCert(b, crt, issuer)
+		if err != nil {
+			lastErr = fmt.Errorf("invalid response from ocsp responder %s: %v", url, err)
+			continue
+		}
+
+		if err := c.checkOCSPFreshness(resp); err != nil {
+			lastErr = fmt.Errorf("stale response from ocsp responder %s: %v", url, err)
+			continue
+		}
+
+		return resp, nil
+	}
+
+	return nil, lastErr
+}
+
+// checkOCSPFreshness rejects responses past their next update or older than
+// the maximum age.
+func (c *RevocationChecker) checkOCSPFreshness(resp *ocsp.Response) error {
+	now := time.Now()
+	if !resp.NextUpdate.IsZero() && !now.Before(resp.NextUpdate) {
+		return fmt.Errorf("expired at %s", resp.NextUpdate)
+	}
+
+	if c.opts.maxOCSPAge > 0 && now.Sub(resp.ThisUpdate) > c.opts.maxOCSPAge {
+		return fmt.Errorf("produced at %s, older than %s", resp.ThisUpdate, c.opts.maxOCSPAge)
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package ca
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Schema creates the table the SQL store records issued certificates in.
+var Schema = []string{
+	`CREATE TABLE IF NOT EXISTS ca_certificates (
+		serial TEXT PRIMARY KEY,
+		subject TEXT NOT NULL,
+		sans TEXT NOT NULL DEFAULT '',
+		not_before BIGINT NOT NULL,
+		not_after BIGINT NOT NULL,
+		certificate BLOB NOT NULL,
+		revoked_at BIGINT NOT NULL DEFAULT 0,
+		revocation_reason INTEGER NOT NULL DEFAULT 0
+	)`,
+	"CREATE INDEX IF NOT EXISTS ca_certificates_revoked_at ON ca_certificates (revoked_at)",
+}
+
+// Record is an issued certificate. A zero RevokedAt means it is not revoked.
+type Record struct {
+	Serial           *big.Int
+	Subject          string
+	SANs             []string
+	NotBefore        time.Time
+	NotAfter         time.Time
+	Certificate      []byte
+	RevokedAt        time.Time
+	RevocationReason int
+}
+
+func (r *Record) Revoked() bool {
+	return !r.RevokedAt.IsZero()
+}
+
+// Store records issued certificates by serial.
+type Store interface {
+	Put(ctx context.Context, cert *x509.Certificate) error
+	Get(ctx context.Context, serial *big.Int) (*Record, error)
+	List(ctx context.Context) ([]Record, error)
+	// Revoke marks the certificate as revoked, revoking it again keeps the
+	// first revocation.
+	Revoke(ctx context.Context, serial *big.Int, reason int, at time.Time) error
+	Revoked(ctx context.Context) ([]Record, error)
+}
+
+// SQLStore stores certificates in a SQLite database created with Schema.
+type SQLStore struct {
+	db *sql.DB
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+func serialKey(serial *big.Int) string {
+	return serial.Text(16)
+}
+
+func sans(cert *x509.Certificate) []string {
+	var names []string
+	names = append(names, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+
+	return names
+}
+
+func (s *SQLStore) Put(ctx context.Context, cert *x509.Certificate) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO ca_certificates (serial, subject, sans, not_before, not_after, certificate) VALUES (?, ?, ?, ?, ?, ?)",
+		serialKey(cert.SerialNumber), cert.Subject.String(), strings.Join(sans(cert), ","), cert.NotBefore.Unix(), cert.NotAfter.Unix(), cert.Raw)
+	if err != nil {
+		return fmt.Errorf("failed to record certificate %s: %v", serialKey(cert.SerialNumber), err)
+	}
+
+	return nil
+}
+
+const recordColumns = "serial, subject, sans, not_before, not_after, certificate, revoked_at, revocation_reason"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRecord(row scanner) (*Record, error) {
+	var r Record
+	var serial, sanList string
+	var notBefore, notAfter, revokedAt int64
+	err := row.Scan(&serial, &r.Subject, &sanList, &notBefore, &notAfter, &r.Certificate, &revokedAt, &r.RevocationReason)
+	if err != nil {
+		return nil, err
+	}
+
+	var ok bool
+	if r.Serial, ok = new(big.Int).SetString(serial, 16); !ok {
+		return nil, fmt.Errorf("invalid serial %q", serial)
+	}
+	if sanList != "" {
+		r.SANs = strings.Split(sanList, ",")
+	}
+	r.NotBefore = time.Unix(notBefore, 0)
+	r.NotAfter = time.Unix(notAfter, 0)
+	if revokedAt != 0 {
+		r.RevokedAt = time.Unix(revokedAt, 0)
+	}
+
+	return &r, nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, serial *big.Int) (*Record, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+recordColumns+" FROM ca_certificates WHERE serial = ?", serialKey(serial))
+	r, err := scanRecord(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrCertificateNotFound, serialKey(serial))
+		}
+
+		return nil, fmt.Errorf("failed to get certificate: %v", err)
+	}
+
+	return r, nil
+}
+
+func (s *SQLStore) list(ctx context.Context, where string) ([]Record, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+recordColumns+" FROM ca_certificates"+where+" ORDER BY not_before, serial")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list certificates: %v", err)
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		r, err := scanRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan certificate: %v", err)
+		}
+		records = append(records, *r)
+	}
+
+	return records, rows.Err()
+}
+
+func (s *SQLStore) List(ctx context.Context) ([]Record, error) {
+	return s.list(ctx, "")
+}
+
+func (s *SQLStore) Revoked(ctx context.Context) ([]Record, error) {
+	return s.list(ctx, " WHERE revoked_at != 0")
+}
+
+func (s *SQLStore) Revoke(ctx context.Context, serial *big.Int, reason int, at time.Time) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE ca_certificates SET revoked_at = ?, revocation_reason = ? WHERE serial = ? AND revoked_at = 0",
+		at.Unix(), reason, serialKey(serial))
+	if err != nil {
+		return fmt.Errorf("failed to revoke certificate: %v", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		// already revoked or never issued
+		_, err := s.Get(ctx, serial)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	ChaCha20Poly1305  AlgorithmType = "chacha20-poly1305"
+	XChaCha20Poly1305 AlgorithmType = "xchacha20-poly1305"
+)
+
+func NewChaCha20Poly1305Algorithm(password string, salt [SALT_SIZE]byte) Algorithm {
+	return newChaChaAlgorithm(ChaCha20Poly1305, chacha20poly1305.New, password, salt)
+}
+
+func NewChaCha20Poly1305AlgorithmWithKey(key []byte, salt [SALT_SIZE]byte) Algorithm {
+	return newChaChaAlgorithmWithKey(ChaCha20Poly1305, chacha20poly1305.New, key, salt)
+}
+
+// NewXChaCha20Poly1305Algorithm uses the 24 byte nonce variant, which makes
+// random nonces safe for any number of messages under the same key.
+func NewXChaCha20Poly1305Algorithm(password string, salt [SALT_SIZE]byte) Algorithm {
+	return newChaChaAlgorithm(XChaCha20Poly1305, chacha20poly1305.NewX, password, salt)
+}
+
+func NewXChaCha20Poly1305AlgorithmWithKey(key []byte, salt [SALT_SIZE]byte) Algorithm {
+	return newChaChaAlgorithmWithKey(XChaCha20Poly1305, chacha20poly1305.NewX, key, salt)
+}
+
+type newAEAD func(key []byte) (cipher.AEAD, error)
+
+func newChaChaAlgorithm(t AlgorithmType, newCipher newAEAD, password string, salt [SALT_SIZE]byte) Algorithm {
+	seal := func(data, additionalData []byte) ([]byte, error) {
+		key, err := DeriveAESGCMKey(password, salt)
+		if err != nil {
+			return nil, err
+		}
+
+		return aeadEncrypt(newCipher, key, salt, data, additionalData)
+	}
+	open := func(data, additionalData []byte) ([]byte, error) {
+		salt, _, err := decodeAEAD(data, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := DeriveAESGCMKey(password, salt)
+		if err != nil {
+			return nil, err
+		}
+
+		return aeadDecrypt(newCipher, key, data, additionalData)
+	}
+
+	return newAEADAlgorithm(t, seal, open, func() ([]byte, error) { return DeriveAESGCMKey(password, salt) })
+}
+
+func newChaChaAlgorithmWithKey(t AlgorithmType, newCipher newAEAD, key []byte, salt [SALT_SIZE]byte) Algorithm {
+	seal := func(data, additionalData []byte) ([]byte, error) {
+		return aeadEncrypt(newCipher, key, salt, data, additionalData)
+	}
+	open := func(data, additionalData []byte) ([]byte, error) {
+		return aeadDecrypt(newCipher, key, data, additionalData)
+	}
+
+	return newAEADAlgorithm(t, seal, open, func() ([]byte, error) { return key, nil })
+}
+
+func ChaCha20Poly1305EncryptWithKey(key []byte, salt [SALT_SIZE]byte, data []byte) ([]byte, error) {
+	return aeadEncrypt(chacha20poly1305.New, key, salt, data, nil)
+}
+
+func ChaCha20Poly1305DecryptWithKey(key, data []byte) ([]byte, error) {
+	return aeadDecrypt(chacha20poly1305.New, key, data, nil)
+}
+
+func XChaCha20Poly1305EncryptWithKey(key []byte, salt [SALT_SIZE]byte, data []byte) ([]byte, error) {
+	return aeadEncrypt(chacha20poly1305.NewX, key, salt, data, nil)
+}
+
+func XChaCha20Poly1305DecryptWithKey(key, data []byte) ([]byte, error) {
+	return aeadDecrypt(chacha20poly1305.NewX, key, data, nil)
+}
+
+// aeadEncrypt encodes like EncodeAESGCM: salt || nonce || ciphertext, with a
+// nonce of the cipher's size.
+func aeadEncrypt(newCipher newAEAD, key []byte, salt [SALT_SIZE]byte, data, additionalData []byte) ([]byte, error) {
+	aead, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	payload := append(salt[:], nonce...)
+	return aead.Seal(payload, nonce, data, additionalData), nil
+}
+
+func aeadDecrypt(newCipher newAEAD, key, data, additionalData []byte) ([]byte, error) {
+	aead, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	_, rest, err := decodeAEAD(data, aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], additionalData)
+}
+
+// decodeAEAD splits off the salt and returns the nonce and ciphertext,
+// checking that at least nonceSize bytes follow the salt.
+func decodeAEAD(data []byte, nonceSize int) (salt [SALT_SIZE]byte, rest []byte, err error) {
+	if len(data) < SALT_SIZE+nonceSize {
+		return salt, nil, ErrDataTooShort
+	}
+
+	copy(salt[:], data[:SALT_SIZE])
+	return salt, data[SALT_SIZE:], nil
+}
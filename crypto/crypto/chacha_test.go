@@ -0,0 +1,48 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChaCha20Poly1305Algorithms(t *testing.T) {
+	var salt [SALT_SIZE]byte
+	rand.Read(salt[:])
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	for name, tc := range map[string]struct {
+		algo      Algorithm
+		nonceSize int
+	}{
+		"chacha20":           {NewChaCha20Poly1305AlgorithmWithKey(key, salt), 12},
+		"xchacha20":          {NewXChaCha20Poly1305AlgorithmWithKey(key, salt), 24},
+		"chacha20-password":  {NewChaCha20Poly1305Algorithm("password", salt), 12},
+		"xchacha20-password": {NewXChaCha20Poly1305Algorithm("password", salt), 24},
+	} {
+		t.Run(name, func(t *testing.T) {
+			encrypted, err := tc.algo.Encrypt([]byte("hello world"))
+			assert.Nilf(t, err, "should be able to encrypt")
+			assert.Equal(t, salt[:], []byte(encrypted[:SALT_SIZE]), "should start with the salt")
+			assert.Len(t, encrypted, SALT_SIZE+tc.nonceSize+len("hello world")+16)
+
+			decrypted, err := tc.algo.Decrypt(encrypted)
+			assert.Nilf(t, err, "should be able to decrypt")
+			assert.Equal(t, "hello world", string(decrypted))
+
+			encrypted[len(encrypted)-1] ^= 1
+			_, err = tc.algo.Decrypt(encrypted)
+			assert.NotNil(t, err)
+
+			_, err = tc.algo.Decrypt([]byte("short"))
+			assert.ErrorIs(t, err, ErrDataTooShort)
+		})
+	}
+
+	encrypted, err := ChaCha20Poly1305EncryptWithKey(key, salt, []byte("data"))
+	assert.Nil(t, err)
+	_, err = XChaCha20Poly1305DecryptWithKey(key, encrypted)
+	assert.NotNilf(t, err, "variants should not be interchangeable")
+}
@@ -0,0 +1,256 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const ciphertextFormatVersion = 1
+
+var ciphertextMagic = []byte("GSCT")
+
+// CiphertextHeader is prepended to self-describing ciphertext and names the
+// algorithm and key that decrypt the payload.
+type CiphertextHeader struct {
+	Version   byte
+	Algorithm AlgorithmType
+	KeyId     string
+}
+
+// EncodeCiphertext prepends the header to the ciphertext. The layout is the
+// magic "GSCT", the format version, then the algorithm type and key id each
+// prefixed with a one byte length.
+func EncodeCiphertext(h CiphertextHeader, ciphertext []byte) ([]byte, error) {
+	if len(h.Algorithm) > 255 || len(h.KeyId) > 255 {
+		return nil, fmt.Errorf("%w: algorithm type or key id too long", ErrInvalidData)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(ciphertextMagic)
+	buf.WriteByte(ciphertextFormatVersion)
+	for _, field := range []string{string(h.Algorithm), h.KeyId} {
+		buf.WriteByte(byte(len(field)))
+		buf.WriteString(field)
+	}
+	buf.Write(ciphertext)
+
+	return buf.Bytes(), nil
+}
+
+// HasCiphertextHeader reports whether data starts with a ciphertext header.
+// Legacy formats never start with the magic followed by a known version, raw
+// binary ones only by chance with a probability of 2^-40.
+func HasCiphertextHeader(data []byte) bool {
+	return len(data) > len(ciphertextMagic) &&
+		bytes.Equal(data[:len(ciphertextMagic)], ciphertextMagic) &&
+		data[len(ciphertextMagic)] == ciphertextFormatVersion
+}
+
+// ParseCiphertext returns the header of self-describing ciphertext and the
+// remaining payload.
+func ParseCiphertext(data []byte) (*CiphertextHeader, []byte, error) {
+	if !HasCiphertextHeader(data) {
+		return nil, nil, ErrNoCiphertextHeader
+	}
+
+	r := bytes.NewReader(data[len(ciphertextMagic)+1:])
+	var fields [2][]byte
+	for i := range fields {
+		var err error
+		if fields[i], err = readField8(r); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	h := CiphertextHeader{
+		Version:   ciphertextFormatVersion,
+		Algorithm: AlgorithmType(fields[0]),
+		KeyId:     string(fields[1]),
+	}
+
+	return &h, data[len(data)-r.Len():], nil
+}
+
+type algorithmKey struct {
+	algorithm AlgorithmType
+	keyId     string
+}
+
+// AlgorithmRegistry encrypts data into self-describing ciphertext and
+// decrypts it with the algorithm registered for the type and key id in its
+// header. The header is not encrypted, an AuthenticatedAlgorithm binds it to
+// the payload as additional data. Data without a header is handed to the
+// legacy algorithms.
+type AlgorithmRegistry struct {
+	m           sync.RWMutex
+	algorithms  map[algorithmKey]Algorithm
+	legacy      []Algorithm
+	legacyTypes []AlgorithmType
+}
+
+func NewAlgorithmRegistry() *AlgorithmRegistry {
+	return &AlgorithmRegistry{
+		algorithms: map[algorithmKey]Algorithm{},
+	}
+}
+
+// Register makes algo available for the algorithm type and key id. Use an
+// empty key id for algorithms that are not tied to a specific key.
+//
+// Decrypt trusts the header to pick the algorithm, so registering an
+// unauthenticated one such as none or base64 lets anyone relabel ciphertext
+// and have Decrypt return the plaintext of their choosing.
+func (r *AlgorithmRegistry) Register(t AlgorithmType, keyId string, algo Algorithm) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.algorithms[algorithmKey{t, keyId}] = algo
+}
+
+func (r *AlgorithmRegistry) Get(t AlgorithmType, keyId string) (Algorithm, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	algo, ok := r.algorithms[algorithmKey{t, keyId}]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s with key id %q", ErrUnknownAlgorithm, t, keyId)
+	}
+
+	return algo, nil
+}
+
+// SetLegacy sets the algorithms tried in order for data without a header.
+// The first one to decrypt without an error wins, so authenticated formats
+// should come before lenient ones such as base64.
+func (r *AlgorithmRegistry) SetLegacy(algos ...Algorithm) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.legacy = algos
+}
+
+// SetLegacyTypes makes data without a header fall back to every algorithm
+// registered for the types, in the order of the types and then of the key
+// ids, after the algorithms set with SetLegacy.
+func (r *AlgorithmRegistry) SetLegacyTypes(types ...AlgorithmType) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.legacyTypes = types
+}
+
+// Encrypt encrypts data with the registered algorithm and prepends a header
+// naming it.
+func (r *AlgorithmRegistry) Encrypt(t AlgorithmType, keyId string, data []byte) ([]byte, error) {
+	algo, err := r.Get(t, keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := EncodeCiphertext(CiphertextHeader{Algorithm: t, KeyId: keyId}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var encrypted []byte
+	if aead, ok := algo.(AuthenticatedAlgorithm); ok {
+		encrypted, err = aead.Seal(data, header)
+	} else {
+		encrypted, err = algo.Encrypt(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return append(header, encrypted...), nil
+}
+
+// Decrypt decrypts self-describing ciphertext, or legacy data without a
+// header using the legacy algorithms.
+func (r *AlgorithmRegistry) Decrypt(data []byte) ([]byte, error) {
+	if !HasCiphertextHeader(data) {
+		return r.decryptLegacy(data)
+	}
+
+	h, payload, err := ParseCiphertext(data)
+	if err != nil {
+		return nil, err
+	}
+
+	algo, err := r.Get(h.Algorithm, h.KeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	if aead, ok := algo.(AuthenticatedAlgorithm); ok {
+		return aead.Open(payload, data[:len(data)-len(payload)])
+	}
+
+	return algo.Decrypt(payload)
+}
+
+func (r *AlgorithmRegistry) decryptLegacy(data []byte) ([]byte, error) {
+	r.m.RLock()
+	legacy := slices.Clone(r.legacy)
+	for _, t := range r.legacyTypes {
+		var registered []algorithmKey
+		for key := range r.algorithms {
+			if key.algorithm == t {
+				registered = append(registered, key)
+			}
+		}
+
+		slices.SortFunc(registered, func(a, b algorithmKey) int { return strings.Compare(a.keyId, b.keyId) })
+		for _, key := range registered {
+			legacy = append(legacy, r.algorithms[key])
+		}
+	}
+	r.m.RUnlock()
+
+	err := ErrNoCiphertextHeader
+	for _, algo := range legacy {
+		var decrypted []byte
+		if decrypted, err = algo.Decrypt(data); err == nil {
+			return decrypted, nil
+		}
+	}
+
+	return nil, err
+}
+
+var algorithms = NewAlgorithmRegistry()
+
+func init() {
+	algorithms.Register(RSA, "", NewRsaAlgorithm())
+	algorithms.SetLegacyTypes(AESGCM, RSA)
+}
+
+// Algorithms returns the registry used by Decrypt and EncryptWith. It comes
+// with the RSA algorithm of keys.RSA registered under an empty key id, and
+// reads headerless data with the registered AES-GCM and RSA algorithms. None
+// and base64 are not authenticated and must be opted into, e.g.
+//
+//	crypto.RegisterAlgorithm(crypto.Base64, "", crypto.NewBase64Algorithm())
+//	crypto.Algorithms().SetLegacy(crypto.NewBase64Algorithm())
+func Algorithms() *AlgorithmRegistry {
+	return algorithms
+}
+
+// RegisterAlgorithm registers algo with the default registry.
+func RegisterAlgorithm(t AlgorithmType, keyId string, algo Algorithm) {
+	algorithms.Register(t, keyId, algo)
+}
+
+// EncryptWith encrypts data into self-describing ciphertext with an algorithm
+// of the default registry.
+func EncryptWith(t AlgorithmType, keyId string, data []byte) ([]byte, error) {
+	return algorithms.Encrypt(t, keyId, data)
+}
+
+func decodeBase64(data []byte) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(string(data))
+}
@@ -0,0 +1,222 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCiphertextHeader(t *testing.T) {
+	encoded, err := EncodeCiphertext(CiphertextHeader{Algorithm: AESGCM, KeyId: "key-1"}, []byte("payload"))
+	assert.Nil(t, err)
+	assert.True(t, HasCiphertextHeader(encoded))
+
+	h, payload, err := ParseCiphertext(encoded)
+	assert.Nilf(t, err, "should be able to parse the header")
+	assert.Equal(t, byte(ciphertextFormatVersion), h.Version)
+	assert.Equal(t, AESGCM, h.Algorithm)
+	assert.Equal(t, "key-1", h.KeyId)
+	assert.Equal(t, "payload", string(payload))
+
+	_, _, err = ParseCiphertext([]byte("hello world"))
+	assert.ErrorIs(t, err, ErrNoCiphertextHeader)
+
+	_, _, err = ParseCiphertext(encoded[:len(ciphertextMagic)+3])
+	assert.ErrorIsf(t, err, ErrDataTooShort, "truncated headers should be rejected")
+}
+
+func TestAlgorithmRegistry(t *testing.T) {
+	var salt [SALT_SIZE]byte
+	rand.Read(salt[:])
+	key1 := make([]byte, 32)
+	rand.Read(key1)
+	key2 := make([]byte, 32)
+	rand.Read(key2)
+
+	r := NewAlgorithmRegistry()
+	r.Register(AESGCM, "key-1", NewAESGCMAlgorithmWithKey(key1, salt))
+	r.Register(AESGCM, "key-2", NewAESGCMAlgorithmWithKey(key2, salt))
+	r.Register(ChaCha20Poly1305, "key-1", NewChaCha20Poly1305AlgorithmWithKey(key1, salt))
+
+	for _, tc := range []struct {
+		algorithm AlgorithmType
+		keyId     string
+	}{
+		{AESGCM, "key-1"},
+		{AESGCM, "key-2"},
+		{ChaCha20Poly1305, "key-1"},
+	} {
+		encrypted, err := r.Encrypt(tc.algorithm, tc.keyId, []byte("hello world"))
+		assert.Nilf(t, err, "should be able to encrypt with %s/%s", tc.algorithm, tc.keyId)
+
+		decrypted, err := r.Decrypt(encrypted)
+		assert.Nilf(t, err, "should be able to decrypt %s/%s without knowing the algorithm", tc.algorithm, tc.keyId)
+		assert.Equal(t, "hello world", string(decrypted))
+	}
+
+	_, err := r.Encrypt(RSA, "", []byte("data"))
+	assert.ErrorIs(t, err, ErrUnknownAlgorithm)
+
+	unknown, err := EncodeCiphertext(CiphertextHeader{Algorithm: AESGCM, KeyId: "key-3"}, []byte("data"))
+	assert.Nil(t, err)
+	_, err = r.Decrypt(unknown)
+	assert.ErrorIs(t, err, ErrUnknownAlgorithm)
+
+	_, err = r.Decrypt([]byte("legacy"))
+	assert.ErrorIsf(t, err, ErrNoCiphertextHeader, "headerless data needs a legacy algorithm")
+}
+
+func TestAlgorithmRegistry_Legacy(t *testing.T) {
+	var salt [SALT_SIZE]byte
+	rand.Read(salt[:])
+
+	legacy, err := AESGCMEncrypt("password", salt, []byte("legacy data"))
+	assert.Nil(t, err)
+
+	r := NewAlgorithmRegistry()
+	r.SetLegacy(NewAESGCMAlgorithm("password", salt), NewBase64Algorithm())
+
+	decrypted, err := r.Decrypt(legacy)
+	assert.Nilf(t, err, "should be able to decrypt legacy AES-GCM data")
+	assert.Equal(t, "legacy data", string(decrypted))
+
+	decrypted, err = r.Decrypt([]byte(base64.StdEncoding.EncodeToString([]byte("legacy base64"))))
+	assert.Nilf(t, err, "should fall back to base64")
+	assert.Equal(t, "legacy base64", string(decrypted))
+}
+
+func TestAlgorithmRegistry_LegacyTypes(t *testing.T) {
+	var salt [SALT_SIZE]byte
+	rand.Read(salt[:])
+	key1 := make([]byte, 32)
+	rand.Read(key1)
+	key2 := make([]byte, 32)
+	rand.Read(key2)
+	rsaKey, err := keys.NewRSA()
+	assert.Nil(t, err)
+
+	r := NewAlgorithmRegistry()
+	r.Register(AESGCM, "key-1", NewAESGCMAlgorithmWithKey(key1, salt))
+	r.Register(AESGCM, "key-2", NewAESGCMAlgorithmWithKey(key2, salt))
+	r.Register(RSA, "", NewRSAAlgorithmWithKey(*rsaKey))
+	r.Register(Base64, "", NewBase64Algorithm())
+	r.SetLegacyTypes(AESGCM, RSA)
+
+	aesLegacy, err := AESGCMEncryptWithKey(key2, salt, []byte("legacy aes"))
+	assert.Nil(t, err)
+	rsaLegacy, err := rsaKey.Encrypt([]byte("legacy rsa"))
+	assert.Nil(t, err)
+
+	for _, tc := range []struct {
+		name       string
+		ciphertext []byte
+		expected   string
+	}{
+		{"AES-GCM", aesLegacy, "legacy aes"},
+		{"RSA", rsaLegacy, "legacy rsa"},
+	} {
+		decrypted, err := r.Decrypt(tc.ciphertext)
+		assert.Nilf(t, err, "should be able to decrypt legacy %s data", tc.name)
+		assert.Equal(t, tc.expected, string(decrypted))
+	}
+
+	_, err = r.Decrypt([]byte(base64.StdEncoding.EncodeToString([]byte("legacy base64"))))
+	assert.NotNilf(t, err, "base64 is only a legacy algorithm when set")
+}
+
+func TestAlgorithmRegistry_HeaderIsAuthenticated(t *testing.T) {
+	var salt [SALT_SIZE]byte
+	rand.Read(salt[:])
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	r := NewAlgorithmRegistry()
+	r.Register(AESGCM, "key-1", NewAESGCMAlgorithmWithKey(key, salt))
+	r.Register(AESGCM, "key-1-copy", NewAESGCMAlgorithmWithKey(key, salt))
+
+	encrypted, err := r.Encrypt(AESGCM, "key-1", []byte("hello world"))
+	assert.Nil(t, err)
+
+	_, payload, err := ParseCiphertext(encrypted)
+	assert.Nil(t, err)
+	relabelled, err := EncodeCiphertext(CiphertextHeader{Algorithm: AESGCM, KeyId: "key-1-copy"}, payload)
+	assert.Nil(t, err)
+
+	_, err = r.Decrypt(relabelled)
+	assert.NotNilf(t, err, "a changed key id should fail authentication even for the same key")
+
+	_, err = AESGCMDecryptWithKey(key, payload)
+	assert.NotNilf(t, err, "the payload should only open with its header")
+}
+
+func TestDecrypt(t *testing.T) {
+	rsaKey, err := keys.NewRSA()
+	assert.Nil(t, err)
+	keys.SetRSA(rsaKey)
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	var salt [SALT_SIZE]byte
+	rand.Read(salt[:])
+	RegisterAlgorithm(AESGCM, "test", NewAESGCMAlgorithmWithKey(key, salt))
+	RegisterAlgorithm(XChaCha20Poly1305, "test", NewXChaCha20Poly1305AlgorithmWithKey(key, [SALT_SIZE]byte{}))
+
+	for _, tc := range []struct {
+		algorithm AlgorithmType
+		keyId     string
+	}{
+		{RSA, ""},
+		{AESGCM, "test"},
+		{XChaCha20Poly1305, "test"},
+	} {
+		encrypted, err := EncryptWith(tc.algorithm, tc.keyId, []byte("hello world"))
+		assert.Nil(t, err)
+
+		decrypted, err := Decrypt(encrypted)
+		assert.Nilf(t, err, "should be able to decrypt %s data", tc.algorithm)
+		assert.Equal(t, "hello world", string(decrypted))
+	}
+
+	// ciphertexts written before the header existed
+	rsaLegacy, err := RSAEncrypt([]byte("legacy rsa"))
+	assert.Nil(t, err)
+	aesLegacy, err := AESGCMEncryptWithKey(key, salt, []byte("legacy aes"))
+	assert.Nil(t, err)
+	for _, legacy := range [][]byte{rsaLegacy, aesLegacy} {
+		assert.False(t, HasCiphertextHeader(legacy))
+		decrypted, err := Decrypt(legacy)
+		assert.Nilf(t, err, "should be able to decrypt legacy data")
+		assert.Contains(t, string(decrypted), "legacy")
+	}
+}
+
+func TestDecrypt_UnauthenticatedAlgorithmsAreOptIn(t *testing.T) {
+	for _, algo := range []AlgorithmType{None, Base64} {
+		_, err := EncryptWith(algo, "", []byte("hello world"))
+		assert.ErrorIsf(t, err, ErrUnknownAlgorithm, "%s should not be registered by default", algo)
+
+		relabelled, err := EncodeCiphertext(CiphertextHeader{Algorithm: algo}, []byte("attacker chosen"))
+		assert.Nil(t, err)
+		_, err = Decrypt(relabelled)
+		assert.ErrorIsf(t, err, ErrUnknownAlgorithm, "relabelling as %s should not return the payload", algo)
+	}
+
+	legacy, err := Encrypt([]byte("hello world"))
+	assert.Nil(t, err)
+	_, err = Decrypt(legacy)
+	assert.NotNilf(t, err, "headerless base64 should not be decoded by default")
+
+	r := NewAlgorithmRegistry()
+	r.Register(Base64, "", NewBase64Algorithm())
+	r.SetLegacy(NewBase64Algorithm())
+	encrypted, err := r.Encrypt(Base64, "", []byte("hello world"))
+	assert.Nil(t, err)
+	for _, data := range [][]byte{encrypted, legacy} {
+		decrypted, err := r.Decrypt(data)
+		assert.Nilf(t, err, "base64 should work once opted into")
+		assert.Equal(t, "hello world", string(decrypted))
+	}
+}
@@ -7,8 +7,6 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
-	"fmt"
-	glog "log"
 	"math/rand/v2"
 	"time"
 
@@ -57,6 +55,44 @@ func (g *GenericAlgorithm) GetKey() ([]byte, error) {
 	return g.KeyFunc()
 }
 
+// AuthenticatedAlgorithm is an Algorithm that authenticates additional data
+// along with the plaintext. The AlgorithmRegistry binds the ciphertext header
+// to the payload this way.
+type AuthenticatedAlgorithm interface {
+	Algorithm
+	Seal(data, additionalData []byte) (EncryptedData, error)
+	Open(data EncryptedData, additionalData []byte) (DecryptedData, error)
+}
+
+// AEADAlgorithm is a GenericAlgorithm for AEAD ciphers, Encrypt and Decrypt
+// use no additional data.
+type AEADAlgorithm struct {
+	GenericAlgorithm
+	SealFunc func(data, additionalData []byte) ([]byte, error)
+	OpenFunc func(data, additionalData []byte) ([]byte, error)
+}
+
+func (a *AEADAlgorithm) Seal(data, additionalData []byte) (EncryptedData, error) {
+	return a.SealFunc(data, additionalData)
+}
+
+func (a *AEADAlgorithm) Open(data EncryptedData, additionalData []byte) (DecryptedData, error) {
+	return a.OpenFunc(data, additionalData)
+}
+
+func newAEADAlgorithm(t AlgorithmType, seal, open func(data, additionalData []byte) ([]byte, error), key func() ([]byte, error)) *AEADAlgorithm {
+	return &AEADAlgorithm{
+		GenericAlgorithm: GenericAlgorithm{
+			EncryptFunc: func(data []byte) ([]byte, error) { return seal(data, nil) },
+			DecryptFunc: func(data []byte) ([]byte, error) { return open(data, nil) },
+			KeyFunc:     key,
+			GetTypeFunc: func() AlgorithmType { return t },
+		},
+		SealFunc: seal,
+		OpenFunc: open,
+	}
+}
+
 func NewNoopAlgorithm() Algorithm {
 	return &GenericAlgorithm{
 		EncryptFunc: func(data []byte) ([]byte, error) { return data, nil },
@@ -68,7 +104,7 @@ func NewNoopAlgorithm() Algorithm {
 func NewBase64Algorithm() Algorithm {
 	return &GenericAlgorithm{
 		EncryptFunc: Encrypt,
-		DecryptFunc: Decrypt,
+		DecryptFunc: decodeBase64,
 		KeyFunc:     func() ([]byte, error) { return nil, nil },
 	}
 }
@@ -85,14 +121,17 @@ func NewDefaultAlgorithm() Algorithm {
 	}
 }
 
+// Encrypt encodes data as base64, it does not encrypt. Decrypt only reads it
+// back when base64 is opted into, see Algorithms.
 func Encrypt(data []byte) ([]byte, error) {
 	return EncryptedData([]byte(base64.StdEncoding.EncodeToString(data))), nil
 }
 
+// Decrypt decrypts self-describing ciphertext with the algorithm named in its
+// header, see EncryptWith, and data without a header with the registered
+// AES-GCM and RSA algorithms.
 func Decrypt(data []byte) ([]byte, error) {
-	strData := fmt.Sprintf("%b", data)
-	l.Info("got string data", zap.String("data", strData))
-	dec, err := base64.StdEncoding.DecodeString(strData)
+	dec, err := algorithms.Decrypt(data)
 	return DecryptedData(dec), err
 }
 
@@ -101,7 +140,9 @@ func NewRSAAlgorithmWithKey(key keys.RSAKey) Algorithm {
 		EncryptFunc: func(data []byte) ([]byte, error) {
 			return key.Encrypt(data)
 		},
-		DecryptFunc: RSADecrypt,
+		DecryptFunc: func(data []byte) ([]byte, error) {
+			return key.Decrypt(data)
+		},
 		KeyFunc: func() ([]byte, error) {
 			_, b := key.PrivateKey()
 			return b, nil
@@ -124,6 +165,10 @@ func NewRsaAlgorithm() Algorithm {
 }
 
 func RSAEncrypt(data []byte) ([]byte, error) {
+	if !keys.HasRSA() {
+		return nil, ErrNoRSAKey
+	}
+
 	keys := keys.RSA()
 	enc, err := keys.Encrypt(data)
 	if err != nil {
@@ -134,6 +179,10 @@ func RSAEncrypt(data []byte) ([]byte, error) {
 }
 
 func RSADecrypt(data []byte) ([]byte, error) {
+	if !keys.HasRSA() {
+		return nil, ErrNoRSAKey
+	}
+
 	keys := keys.RSA()
 	dec, err := keys.Decrypt([]byte(data))
 	if err != nil {
@@ -143,28 +192,43 @@ func RSADecrypt(data []byte) ([]byte, error) {
 	return DecryptedData(dec), nil
 }
 
+// NewAESGCMAlgorithm encrypts with a key derived from password, in the
+// salt || nonce || ciphertext layout of EncodeAESGCM with a random nonce.
 func NewAESGCMAlgorithm(password string, salt [SALT_SIZE]byte) Algorithm {
-	return &GenericAlgorithm{
-		EncryptFunc: func(data []byte) ([]byte, error) {
-			return AESGCMEncrypt(password, salt, data)
+	return newAEADAlgorithm(AESGCM,
+		func(data, additionalData []byte) ([]byte, error) {
+			key, err := DeriveAESGCMKey(password, salt)
+			if err != nil {
+				return nil, err
+			}
+
+			return aeadEncrypt(NewGCM, key, salt, data, additionalData)
 		},
-		DecryptFunc: func(data []byte) ([]byte, error) {
-			return AESGCMDecrypt(password, data)
+		func(data, additionalData []byte) ([]byte, error) {
+			salt, _, err := decodeAEAD(data, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			key, err := DeriveAESGCMKey(password, salt)
+			if err != nil {
+				return nil, err
+			}
+
+			return aeadDecrypt(NewGCM, key, data, additionalData)
 		},
-		KeyFunc: func() ([]byte, error) { return DeriveAESGCMKey(password, salt) },
-	}
+		func() ([]byte, error) { return DeriveAESGCMKey(password, salt) })
 }
 
 func NewAESGCMAlgorithmWithKey(key []byte, salt [SALT_SIZE]byte) Algorithm {
-	return &GenericAlgorithm{
-		EncryptFunc: func(data []byte) ([]byte, error) {
-			return AESGCMEncryptWithKey(key, salt, data)
+	return newAEADAlgorithm(AESGCM,
+		func(data, additionalData []byte) ([]byte, error) {
+			return aeadEncrypt(NewGCM, key, salt, data, additionalData)
 		},
-		DecryptFunc: func(data []byte) ([]byte, error) {
-			return AESGCMDecryptWithKey(key, data)
+		func(data, additionalData []byte) ([]byte, error) {
+			return aeadDecrypt(NewGCM, key, data, additionalData)
 		},
-		GetTypeFunc: func() AlgorithmType { return AESGCM },
-	}
+		func() ([]byte, error) { return key, nil })
 }
 
 func NewGCM(key []byte) (cipher.AEAD, error) {
@@ -210,8 +274,6 @@ func AESGCMDecrypt(password string, data []byte) ([]byte, error) {
 }
 
 func AESGCMEncryptWithKey(key []byte, salt [SALT_SIZE]byte, data []byte) ([]byte, error) {
-	glog.Printf("%s", string(key))
-
 	gcm, err := NewGCM(key)
 	if err != nil {
 		return nil, err
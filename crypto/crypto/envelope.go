@@ -0,0 +1,415 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	Envelope AlgorithmType = "envelope"
+
+	// envelopeDataAlgorithm is the cipher the payload is encrypted with.
+	envelopeDataAlgorithm = "aes-256-gcm"
+	// envelopeStreamAlgorithm marks envelopes whose payload is a chunked
+	// AES-GCM stream.
+	envelopeStreamAlgorithm = "aes-256-gcm-stream"
+	dataKeySize             = 32
+	envelopeFormatVersion   = 1
+)
+
+var envelopeMagic = []byte("GSEV")
+
+// KeyCipher encrypts and decrypts data keys, keys.Key implementations such as
+// RSA and X509 keys satisfy it.
+type KeyCipher interface {
+	Encrypt(data []byte) ([]byte, error)
+	Decrypt(data []byte) ([]byte, error)
+}
+
+// KeyEncryptionKey wraps the per message data keys of envelope encryption. A
+// key is identified by its id and version, a rotated key keeps the id and
+// gets a new version.
+type KeyEncryptionKey struct {
+	Id      string
+	Version uint32
+	Type    AlgorithmType
+	Cipher  KeyCipher
+}
+
+// NewRSAKeyEncryptionKey wraps data keys with RSA-OAEP using an RSA or X509
+// key.
+func NewRSAKeyEncryptionKey(id string, version uint32, key KeyCipher) *KeyEncryptionKey {
+	return &KeyEncryptionKey{Id: id, Version: version, Type: RSA, Cipher: key}
+}
+
+// NewAESKeyEncryptionKey wraps data keys with AES-GCM using a 16, 24 or 32
+// byte key.
+func NewAESKeyEncryptionKey(id string, version uint32, key []byte) (*KeyEncryptionKey, error) {
+	if err := VerifyGCMAESKey(key); err != nil {
+		return nil, err
+	}
+
+	return &KeyEncryptionKey{Id: id, Version: version, Type: AESGCM, Cipher: aesKeyCipher(key)}, nil
+}
+
+type aesKeyCipher []byte
+
+func (k aesKeyCipher) Encrypt(data []byte) ([]byte, error) {
+	return sealRandomNonce(k, data)
+}
+
+func (k aesKeyCipher) Decrypt(data []byte) ([]byte, error) {
+	return openRandomNonce(k, data)
+}
+
+// sealRandomNonce encrypts with AES-GCM and prepends the random nonce.
+func sealRandomNonce(key, data []byte) ([]byte, error) {
+	gcm, err := NewGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func openRandomNonce(key, data []byte) ([]byte, error) {
+	gcm, err := NewGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrDataTooShort
+	}
+
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// KeyEncryptionKeys holds the current key encryption key and every older key
+// that may still be needed to decrypt existing data.
+type KeyEncryptionKeys struct {
+	m       sync.RWMutex
+	keys    map[string]map[uint32]*KeyEncryptionKey
+	primary *KeyEncryptionKey
+}
+
+func NewKeyEncryptionKeys(primary *KeyEncryptionKey, older ...*KeyEncryptionKey) *KeyEncryptionKeys {
+	k := &KeyEncryptionKeys{keys: map[string]map[uint32]*KeyEncryptionKey{}}
+	for _, o := range older {
+		k.Add(o)
+	}
+	k.SetPrimary(primary)
+	return k
+}
+
+// Add makes the key available for decryption without using it to encrypt.
+func (k *KeyEncryptionKeys) Add(kek *KeyEncryptionKey) {
+	k.m.Lock()
+	defer k.m.Unlock()
+
+	if k.keys[kek.Id] == nil {
+		k.keys[kek.Id] = map[uint32]*KeyEncryptionKey{}
+	}
+	k.keys[kek.Id][kek.Version] = kek
+}
+
+// SetPrimary adds the key and uses it for all new encryptions, e.g. after a
+// rotation.
+func (k *KeyEncryptionKeys) SetPrimary(kek *KeyEncryptionKey) {
+	k.Add(kek)
+
+	k.m.Lock()
+	defer k.m.Unlock()
+	k.primary = kek
+}
+
+func (k *KeyEncryptionKeys) Primary() *KeyEncryptionKey {
+	k.m.RLock()
+	defer k.m.RUnlock()
+	return k.primary
+}
+
+func (k *KeyEncryptionKeys) Get(id string, version uint32) (*KeyEncryptionKey, error) {
+	k.m.RLock()
+	defer k.m.RUnlock()
+
+	kek, ok := k.keys[id][version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s v%d", ErrUnknownKeyEncryptionKey, id, version)
+	}
+
+	return kek, nil
+}
+
+// EnvelopeHeader describes how an envelope was encrypted.
+type EnvelopeHeader struct {
+	DataAlgorithm string
+	KeyType       AlgorithmType
+	KeyId         string
+	KeyVersion    uint32
+	WrappedKey    []byte
+}
+
+// ParseEnvelopeHeader returns the header of envelope encrypted data and the
+// remaining nonce and ciphertext.
+func ParseEnvelopeHeader(data []byte) (*EnvelopeHeader, []byte, error) {
+	r := bytes.NewReader(data)
+	h, err := readEnvelopeHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return h, data[len(data)-r.Len():], nil
+}
+
+// readEnvelopeHeader reads exactly the header from r, leaving the payload.
+func readEnvelopeHeader(r io.Reader) (*EnvelopeHeader, error) {
+	magic := make([]byte, len(envelopeMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, envelopeMagic) {
+		return nil, ErrNotEnvelope
+	}
+
+	version, err := readN(r, 1)
+	if err != nil {
+		return nil, err
+	}
+	if version[0] != envelopeFormatVersion {
+		return nil, fmt.Errorf("%w: envelope format version %d", ErrInvalidData, version[0])
+	}
+
+	var fields [3][]byte
+	for i := range fields {
+		if fields[i], err = readField8(r); err != nil {
+			return nil, err
+		}
+	}
+
+	h := EnvelopeHeader{
+		DataAlgorithm: string(fields[0]),
+		KeyType:       AlgorithmType(fields[1]),
+		KeyId:         string(fields[2]),
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &h.KeyVersion); err != nil {
+		return nil, ErrDataTooShort
+	}
+
+	var wrappedLen uint16
+	if err := binary.Read(r, binary.BigEndian, &wrappedLen); err != nil {
+		return nil, ErrDataTooShort
+	}
+
+	if h.WrappedKey, err = readN(r, int(wrappedLen)); err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+func readN(r io.Reader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, ErrDataTooShort
+	}
+
+	return b, nil
+}
+
+func readField8(r io.Reader) ([]byte, error) {
+	n, err := readN(r, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return readN(r, int(n[0]))
+}
+
+func (h *EnvelopeHeader) encode() ([]byte, error) {
+	if len(h.KeyId) > 255 || len(h.WrappedKey) > 65535 {
+		return nil, fmt.Errorf("%w: key id or wrapped key too long", ErrInvalidData)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(envelopeMagic)
+	buf.WriteByte(envelopeFormatVersion)
+	for _, field := range []string{h.DataAlgorithm, string(h.KeyType), h.KeyId} {
+		buf.WriteByte(byte(len(field)))
+		buf.WriteString(field)
+	}
+	binary.Write(&buf, binary.BigEndian, h.KeyVersion)
+	binary.Write(&buf, binary.BigEndian, uint16(len(h.WrappedKey)))
+	buf.Write(h.WrappedKey)
+
+	return buf.Bytes(), nil
+}
+
+// EnvelopeAlgorithm encrypts every message with a fresh random data key and
+// stores the data key wrapped by the primary key encryption key in the
+// ciphertext header, so payload size is not limited by the wrapping key and
+// data stays decryptable after the key encryption key is rotated.
+type EnvelopeAlgorithm struct {
+	keks *KeyEncryptionKeys
+}
+
+func NewEnvelopeAlgorithm(keks *KeyEncryptionKeys) *EnvelopeAlgorithm {
+	return &EnvelopeAlgorithm{keks: keks}
+}
+
+func (e *EnvelopeAlgorithm) Encrypt(data []byte) (EncryptedData, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %v", err)
+	}
+
+	ciphertext, err := sealRandomNonce(dataKey, data)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := e.wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(header, ciphertext...), nil
+}
+
+func (e *EnvelopeAlgorithm) wrap(dataKey []byte) ([]byte, error) {
+	return e.wrapFor(envelopeDataAlgorithm, dataKey)
+}
+
+func (e *EnvelopeAlgorithm) wrapFor(dataAlgorithm string, dataKey []byte) ([]byte, error) {
+	kek := e.keks.Primary()
+	wrapped, err := kek.Cipher.Encrypt(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key with %s v%d: %v", kek.Id, kek.Version, err)
+	}
+
+	h := EnvelopeHeader{
+		DataAlgorithm: dataAlgorithm,
+		KeyType:       kek.Type,
+		KeyId:         kek.Id,
+		KeyVersion:    kek.Version,
+		WrappedKey:    wrapped,
+	}
+
+	return h.encode()
+}
+
+func (e *EnvelopeAlgorithm) unwrap(h *EnvelopeHeader) ([]byte, error) {
+	kek, err := e.keks.Get(h.KeyId, h.KeyVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := kek.Cipher.Decrypt(h.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with %s v%d: %v", kek.Id, kek.Version, err)
+	}
+
+	return dataKey, nil
+}
+
+func (e *EnvelopeAlgorithm) Decrypt(data EncryptedData) (DecryptedData, error) {
+	h, ciphertext, err := ParseEnvelopeHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.DataAlgorithm != envelopeDataAlgorithm {
+		return nil, fmt.Errorf("%w: data algorithm %s", ErrInvalidData, h.DataAlgorithm)
+	}
+
+	dataKey, err := e.unwrap(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return openRandomNonce(dataKey, ciphertext)
+}
+
+// GetKey returns nil, there is no single key behind envelope encryption.
+func (e *EnvelopeAlgorithm) GetKey() ([]byte, error) {
+	return nil, nil
+}
+
+// NeedsRewrap reports whether the data key was not wrapped by the primary
+// key encryption key.
+func (e *EnvelopeAlgorithm) NeedsRewrap(data []byte) (bool, error) {
+	h, _, err := ParseEnvelopeHeader(data)
+	if err != nil {
+		return false, err
+	}
+
+	primary := e.keks.Primary()
+	return h.KeyId != primary.Id || h.KeyVersion != primary.Version, nil
+}
+
+// Rewrap re-encrypts the data key of an envelope under the primary key
+// encryption key. The payload itself is not decrypted.
+func (e *EnvelopeAlgorithm) Rewrap(data []byte) ([]byte, error) {
+	h, ciphertext, err := ParseEnvelopeHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := e.unwrap(h)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := e.wrapFor(h.DataAlgorithm, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(header, ciphertext...), nil
+}
+
+// EncryptWriter streams envelope encrypted data to w, for payloads too large
+// to hold in memory. Close must be called to finish the stream.
+func (e *EnvelopeAlgorithm) EncryptWriter(w io.Writer, opts ...streamOption) (io.WriteCloser, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %v", err)
+	}
+
+	header, err := e.wrapFor(envelopeStreamAlgorithm, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return NewEncryptWriter(w, dataKey, opts...)
+}
+
+// DecryptReader decrypts a stream written by EncryptWriter.
+func (e *EnvelopeAlgorithm) DecryptReader(r io.Reader) (io.Reader, error) {
+	h, err := readEnvelopeHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.DataAlgorithm != envelopeStreamAlgorithm {
+		return nil, fmt.Errorf("%w: data algorithm %s", ErrInvalidData, h.DataAlgorithm)
+	}
+
+	dataKey, err := e.unwrap(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDecryptReader(r, dataKey)
+}
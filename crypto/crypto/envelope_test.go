@@ -0,0 +1,90 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAESKek(t *testing.T, version uint32) *KeyEncryptionKey {
+	key := make([]byte, 32)
+	rand.Read(key)
+	kek, err := NewAESKeyEncryptionKey("aes", version, key)
+	assert.Nilf(t, err, "should be able to create kek")
+	return kek
+}
+
+func TestEnvelopeAlgorithm(t *testing.T) {
+	rsaKey, err := keys.NewRSA()
+	assert.Nil(t, err)
+
+	for name, kek := range map[string]*KeyEncryptionKey{
+		"aes": newTestAESKek(t, 1),
+		"rsa": NewRSAKeyEncryptionKey("rsa", 1, rsaKey),
+	} {
+		t.Run(name, func(t *testing.T) {
+			algo := NewEnvelopeAlgorithm(NewKeyEncryptionKeys(kek))
+
+			// larger than RSA-OAEP could encrypt directly
+			data := make([]byte, 4096)
+			rand.Read(data)
+
+			encrypted, err := algo.Encrypt(data)
+			assert.Nilf(t, err, "should be able to encrypt")
+
+			h, _, err := ParseEnvelopeHeader(encrypted)
+			assert.Nil(t, err)
+			assert.Equal(t, kek.Id, h.KeyId)
+			assert.Equal(t, kek.Version, h.KeyVersion)
+			assert.Equal(t, kek.Type, h.KeyType)
+
+			decrypted, err := algo.Decrypt(encrypted)
+			assert.Nilf(t, err, "should be able to decrypt")
+			assert.True(t, bytes.Equal(data, decrypted))
+
+			encrypted[len(encrypted)-1] ^= 1
+			_, err = algo.Decrypt(encrypted)
+			assert.NotNilf(t, err, "should detect tampering")
+		})
+	}
+}
+
+func TestEnvelopeAlgorithm_Rotation(t *testing.T) {
+	v1 := newTestAESKek(t, 1)
+	keks := NewKeyEncryptionKeys(v1)
+	algo := NewEnvelopeAlgorithm(keks)
+
+	encrypted, err := algo.Encrypt([]byte("hello world"))
+	assert.Nil(t, err)
+
+	v2 := newTestAESKek(t, 2)
+	keks.SetPrimary(v2)
+
+	decrypted, err := algo.Decrypt(encrypted)
+	assert.Nilf(t, err, "data of the old key version should stay decryptable")
+	assert.Equal(t, "hello world", string(decrypted))
+
+	needsRewrap, err := algo.NeedsRewrap(encrypted)
+	assert.Nil(t, err)
+	assert.True(t, needsRewrap)
+
+	rewrapped, err := algo.Rewrap(encrypted)
+	assert.Nilf(t, err, "should be able to rewrap")
+	h, _, err := ParseEnvelopeHeader(rewrapped)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), h.KeyVersion)
+
+	// only the new version is needed after rewrapping
+	decrypted, err = NewEnvelopeAlgorithm(NewKeyEncryptionKeys(v2)).Decrypt(rewrapped)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(decrypted))
+
+	_, err = NewEnvelopeAlgorithm(NewKeyEncryptionKeys(v2)).Decrypt(encrypted)
+	assert.ErrorIs(t, err, ErrUnknownKeyEncryptionKey)
+
+	_, err = algo.Decrypt([]byte("not an envelope"))
+	assert.ErrorIs(t, err, ErrNotEnvelope)
+}
@@ -3,6 +3,18 @@ package crypto
 import "errors"
 
 var (
-	ErrDataTooShort = errors.New("data too short")
-	ErrInvalidData  = errors.New("invalid data")
+	ErrDataTooShort    = errors.New("data too short")
+	ErrInvalidData     = errors.New("invalid data")
+	ErrInvalidHash     = errors.New("invalid password hash")
+	ErrUnsupportedHash = errors.New("unsupported password hash")
+	ErrNotEnvelope     = errors.New("data is not envelope encrypted")
+	ErrStreamClosed    = errors.New("stream is closed")
+	ErrStreamTooLong   = errors.New("stream exceeds the maximum number of chunks")
+	ErrStreamTruncated = errors.New("stream is truncated or its last chunk was modified")
+
+	ErrNoCiphertextHeader = errors.New("data has no ciphertext header")
+	ErrUnknownAlgorithm   = errors.New("no algorithm registered")
+	ErrNoRSAKey           = errors.New("rsa key is not initialized")
+
+	ErrUnknownKeyEncryptionKey = errors.New("unknown key encryption key")
 )
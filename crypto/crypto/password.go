@@ -0,0 +1,240 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PasswordParams are the argon2id parameters new password hashes are created
+// with.
+type PasswordParams struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+var DefaultPasswordParams = PasswordParams{
+	Memory:  64 * 1024,
+	Time:    3,
+	Threads: 2,
+	KeyLen:  32,
+	SaltLen: SALT_SIZE,
+}
+
+// PasswordHasher hashes passwords into PHC strings, e.g.
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>, and verifies argon2id as
+// well as legacy bcrypt and scrypt hashes.
+type PasswordHasher struct {
+	params PasswordParams
+}
+
+func NewPasswordHasher(params PasswordParams) *PasswordHasher {
+	return &PasswordHasher{params: params}
+}
+
+func NewDefaultPasswordHasher() *PasswordHasher {
+	return NewPasswordHasher(DefaultPasswordParams)
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %v", err)
+	}
+
+	p := h.params
+	key := NewArgon2HashingAlgorithm(p.Memory, p.Time, p.Threads, p.KeyLen, salt).Hash([]byte(password))
+	return encodeArgon2id(p, salt, key), nil
+}
+
+// Verify reports whether the password matches the encoded hash. The
+// comparison is constant time for every supported format.
+func (h *PasswordHasher) Verify(password, encoded string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		p, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+
+		actual := NewArgon2HashingAlgorithm(p.Memory, p.Time, p.Threads, p.KeyLen, salt).Hash([]byte(password))
+		return subtle.ConstantTimeCompare(actual, key) == 1, nil
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+		}
+
+		return true, nil
+	case strings.HasPrefix(encoded, "$scrypt$"):
+		return verifyScrypt(password, encoded)
+	default:
+		return false, ErrUnsupportedHash
+	}
+}
+
+// NeedsRehash reports whether the encoded hash was not created with the
+// hasher's current algorithm and parameters.
+func (h *PasswordHasher) NeedsRehash(encoded string) bool {
+	p, salt, _, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+
+	return p != h.params || uint32(len(salt)) != h.params.SaltLen
+}
+
+// VerifyAndUpgrade verifies the password and, if the stored hash is outdated,
+// returns a new hash that should replace it. The new hash is empty when no
+// upgrade is needed or the password does not match.
+func (h *PasswordHasher) VerifyAndUpgrade(password, encoded string) (bool, string, error) {
+	ok, err := h.Verify(password, encoded)
+	if err != nil || !ok {
+		return ok, "", err
+	}
+
+	if !h.NeedsRehash(encoded) {
+		return true, "", nil
+	}
+
+	rehashed, err := h.Hash(password)
+	if err != nil {
+		return true, "", err
+	}
+
+	return true, rehashed, nil
+}
+
+var b64 = base64.RawStdEncoding
+
+// Limits of the parameters accepted when decoding a hash, so a malformed or
+// hostile hash cannot make Verify panic or allocate unbounded memory.
+const (
+	maxHashMemory  = 1 << 30 // bytes
+	maxArgon2Time  = 64
+	maxArgon2Procs = 64
+	maxScryptLn    = 30
+	maxScryptR     = 32
+	maxScryptP     = 16
+	maxHashLen     = 1024
+)
+
+func checkSaltAndKey(salt, key []byte) error {
+	if len(salt) == 0 || len(salt) > maxHashLen {
+		return fmt.Errorf("%w: salt length %d", ErrInvalidHash, len(salt))
+	}
+	if len(key) == 0 || len(key) > maxHashLen {
+		return fmt.Errorf("%w: key length %d", ErrInvalidHash, len(key))
+	}
+
+	return nil
+}
+
+func encodeArgon2id(p PasswordParams, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Threads, b64.EncodeToString(salt), b64.EncodeToString(key))
+}
+
+func decodeArgon2id(encoded string) (PasswordParams, []byte, []byte, error) {
+	var p PasswordParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("%w: argon2 version %d", ErrUnsupportedHash, version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	if p.Memory == 0 || uint64(p.Memory)*1024 > maxHashMemory ||
+		p.Time == 0 || p.Time > maxArgon2Time ||
+		p.Threads == 0 || p.Threads > maxArgon2Procs {
+		return p, nil, nil, fmt.Errorf("%w: argon2 parameters %s", ErrInvalidHash, parts[3])
+	}
+
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+
+	key, err := b64.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+
+	if err := checkSaltAndKey(salt, key); err != nil {
+		return p, nil, nil, err
+	}
+
+	p.KeyLen = uint32(len(key))
+	p.SaltLen = uint32(len(salt))
+	return p, salt, key, nil
+}
+
+func isBcrypt(encoded string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(encoded, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifyScrypt verifies hashes of the form $scrypt$ln=15,r=8,p=1$<salt>$<hash>
+// where ln is log2 of the cost parameter.
+func verifyScrypt(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return false, ErrInvalidHash
+	}
+
+	var ln, r, p int
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &ln, &r, &p); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	if ln < 1 || ln > maxScryptLn || r < 1 || r > maxScryptR || p < 1 || p > maxScryptP ||
+		uint64(128*r)<<ln > maxHashMemory {
+		return false, fmt.Errorf("%w: scrypt parameters %s", ErrInvalidHash, parts[2])
+	}
+
+	salt, err := b64.DecodeString(parts[3])
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+
+	key, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+
+	if err := checkSaltAndKey(salt, key); err != nil {
+		return false, err
+	}
+
+	actual, err := scrypt.Key([]byte(password), salt, 1<<ln, r, p, len(key))
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
@@ -0,0 +1,119 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+func testPasswordParams() PasswordParams {
+	return PasswordParams{Memory: 1024, Time: 1, Threads: 1, KeyLen: 32, SaltLen: SALT_SIZE}
+}
+
+func TestPasswordHasher(t *testing.T) {
+	h := NewPasswordHasher(testPasswordParams())
+
+	encoded, err := h.Hash("password")
+	assert.Nilf(t, err, "should be able to hash")
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	other, err := h.Hash("password")
+	assert.Nil(t, err)
+	assert.NotEqualf(t, encoded, other, "salts should be random")
+
+	ok, err := h.Verify("password", encoded)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = h.Verify("wrong", encoded)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	assert.False(t, h.NeedsRehash(encoded))
+
+	stronger := testPasswordParams()
+	stronger.Time = 2
+	assert.Truef(t, NewPasswordHasher(stronger).NeedsRehash(encoded), "changed parameters should need a rehash")
+
+	_, err = h.Verify("password", "$md5$abc")
+	assert.ErrorIs(t, err, ErrUnsupportedHash)
+
+	_, err = h.Verify("password", "$argon2id$v=19$m=1024$abc")
+	assert.ErrorIs(t, err, ErrInvalidHash)
+}
+
+func TestPasswordHasher_Legacy(t *testing.T) {
+	h := NewPasswordHasher(testPasswordParams())
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.Nil(t, err)
+
+	ok, err := h.Verify("password", string(bcryptHash))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = h.Verify("wrong", string(bcryptHash))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	salt := []byte("0123456789abcdef")
+	key, err := scrypt.Key([]byte("password"), salt, 1<<10, 8, 1, 32)
+	assert.Nil(t, err)
+	scryptHash := "$scrypt$ln=10,r=8,p=1$" + b64.EncodeToString(salt) + "$" + b64.EncodeToString(key)
+
+	ok, err = h.Verify("password", scryptHash)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, upgraded, err := h.VerifyAndUpgrade("password", scryptHash)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Truef(t, strings.HasPrefix(upgraded, "$argon2id$"), "legacy hashes should be upgraded")
+
+	ok, upgraded, err = h.VerifyAndUpgrade("password", upgraded)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Emptyf(t, upgraded, "current hashes should not be upgraded")
+
+	ok, upgraded, err = h.VerifyAndUpgrade("wrong", string(bcryptHash))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Empty(t, upgraded)
+}
+
+func TestPasswordHasher_Malformed(t *testing.T) {
+	h := NewPasswordHasher(testPasswordParams())
+	salt := b64.EncodeToString([]byte("0123456789abcdef"))
+	key := b64.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+	for name, encoded := range map[string]string{
+		"argon2 empty key":     "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$",
+		"argon2 empty salt":    "$argon2id$v=19$m=1024,t=1,p=1$$" + key,
+		"argon2 zero time":     "$argon2id$v=19$m=1024,t=0,p=1$" + salt + "$" + key,
+		"argon2 zero threads":  "$argon2id$v=19$m=1024,t=1,p=0$" + salt + "$" + key,
+		"argon2 zero memory":   "$argon2id$v=19$m=0,t=1,p=1$" + salt + "$" + key,
+		"argon2 huge memory":   "$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + key,
+		"argon2 huge time":     "$argon2id$v=19$m=1024,t=4294967295,p=1$" + salt + "$" + key,
+		"argon2 huge threads":  "$argon2id$v=19$m=1024,t=1,p=255$" + salt + "$" + key,
+		"scrypt negative ln":   "$scrypt$ln=-1,r=8,p=1$" + salt + "$" + key,
+		"scrypt zero ln":       "$scrypt$ln=0,r=8,p=1$" + salt + "$" + key,
+		"scrypt huge ln":       "$scrypt$ln=31,r=8,p=1$" + salt + "$" + key,
+		"scrypt huge memory":   "$scrypt$ln=30,r=8,p=1$" + salt + "$" + key,
+		"scrypt zero r":        "$scrypt$ln=10,r=0,p=1$" + salt + "$" + key,
+		"scrypt huge r":        "$scrypt$ln=10,r=1024,p=1$" + salt + "$" + key,
+		"scrypt zero p":        "$scrypt$ln=10,r=8,p=0$" + salt + "$" + key,
+		"scrypt huge p":        "$scrypt$ln=10,r=8,p=1024$" + salt + "$" + key,
+		"scrypt empty key":     "$scrypt$ln=10,r=8,p=1$" + salt + "$",
+		"scrypt empty salt":    "$scrypt$ln=10,r=8,p=1$$" + key,
+		"scrypt missing parts": "$scrypt$ln=10,r=8,p=1$" + salt,
+	} {
+		assert.NotPanicsf(t, func() {
+			ok, err := h.Verify("password", encoded)
+			assert.Falsef(t, ok, "%s should not verify", name)
+			assert.ErrorIsf(t, err, ErrInvalidHash, "%s should be an invalid hash", name)
+		}, "%s should not panic", name)
+	}
+}
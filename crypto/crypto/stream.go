@@ -0,0 +1,274 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	DefaultChunkSize = 64 * 1024
+	// MaxChunkSize bounds the chunk size of a stream, which is read from its
+	// untrusted header and sizes the buffer of the reader.
+	MaxChunkSize = 16 * 1024 * 1024
+
+	// streamNoncePrefixSize leaves 4 bytes of the 12 byte nonce for the chunk
+	// counter and 1 byte for the last chunk flag.
+	streamNoncePrefixSize = 7
+	streamFormatVersion   = 1
+)
+
+var streamMagic = []byte("GSST")
+
+type streamOptions struct {
+	chunkSize int
+}
+
+type streamOption func(*streamOptions)
+
+// WithChunkSize sets the plaintext size of every chunk but the last.
+func WithChunkSize(n int) streamOption {
+	return func(o *streamOptions) {
+		o.chunkSize = n
+	}
+}
+
+// streamNonce builds the STREAM nonce: prefix || counter || last flag. The
+// counter authenticates the chunk order and the flag the end of the stream,
+// so chunks can neither be reordered nor dropped from the end.
+func streamNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 0, IV_SIZE)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if last {
+		return append(nonce, 1)
+	}
+
+	return append(nonce, 0)
+}
+
+type encryptWriter struct {
+	w       io.Writer
+	gcm     cipher.AEAD
+	prefix  []byte
+	buf     []byte
+	size    int
+	counter uint32
+	closed  bool
+}
+
+// NewEncryptWriter returns a writer that encrypts everything written to it
+// with chunked AES-GCM and writes the result to w. Close must be called to
+// write the final chunk; it does not close w.
+func NewEncryptWriter(w io.Writer, key []byte, opts ...streamOption) (io.WriteCloser, error) {
+	o := streamOptions{chunkSize: DefaultChunkSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.chunkSize <= 0 || o.chunkSize > MaxChunkSize {
+		return nil, fmt.Errorf("%w: chunk size must be between 1 and %d", ErrInvalidData, MaxChunkSize)
+	}
+
+	gcm, err := NewGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, streamNoncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce prefix: %v", err)
+	}
+
+	var header bytes.Buffer
+	header.Write(streamMagic)
+	header.WriteByte(streamFormatVersion)
+	binary.Write(&header, binary.BigEndian, uint32(o.chunkSize))
+	header.Write(prefix)
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:      w,
+		gcm:    gcm,
+		prefix: prefix,
+		buf:    make([]byte, 0, o.chunkSize),
+		size:   o.chunkSize,
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, ErrStreamClosed
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):e.size], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+
+		// only flush a full chunk once more data arrives, the last chunk must
+		// be sealed with the last flag on Close
+		if len(e.buf) == e.size && len(p) > 0 {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	if e.counter == math.MaxUint32 {
+		return ErrStreamTooLong
+	}
+
+	sealed := e.gcm.Seal(nil, streamNonce(e.prefix, e.counter, last), e.buf, nil)
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+
+	e.counter++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	return e.flush(true)
+}
+
+type decryptReader struct {
+	r       io.Reader
+	gcm     cipher.AEAD
+	prefix  []byte
+	chunk   []byte
+	out     []byte
+	counter uint32
+	done    bool
+}
+
+// NewDecryptReader returns a reader that decrypts a stream written by
+// NewEncryptWriter. Read returns an error if a chunk was modified, reordered
+// or the stream was truncated.
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	header := make([]byte, len(streamMagic)+1+4+streamNoncePrefixSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrDataTooShort
+	}
+
+	if !bytes.Equal(header[:len(streamMagic)], streamMagic) {
+		return nil, fmt.Errorf("%w: not an encrypted stream", ErrInvalidData)
+	}
+
+	if v := header[len(streamMagic)]; v != streamFormatVersion {
+		return nil, fmt.Errorf("%w: stream format version %d", ErrInvalidData, v)
+	}
+
+	chunkSize := binary.BigEndian.Uint32(header[len(streamMagic)+1:])
+	if chunkSize == 0 || chunkSize > MaxChunkSize {
+		return nil, fmt.Errorf("%w: chunk size %d", ErrInvalidData, chunkSize)
+	}
+
+	gcm, err := NewGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{
+		r:      r,
+		gcm:    gcm,
+		prefix: header[len(header)-streamNoncePrefixSize:],
+		// one byte more than a sealed chunk tells whether another follows
+		chunk: make([]byte, 0, int(chunkSize)+gcm.Overhead()+1),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	sealedSize := cap(d.chunk) - 1
+
+	// d.chunk holds the byte read ahead of the previous chunk
+	n, err := io.ReadFull(d.r, d.chunk[len(d.chunk):cap(d.chunk)])
+	d.chunk = d.chunk[:len(d.chunk)+n]
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+
+	last := len(d.chunk) <= sealedSize
+	sealed := d.chunk
+	if !last {
+		sealed = d.chunk[:sealedSize]
+	}
+
+	opened, err := d.gcm.Open(nil, streamNonce(d.prefix, d.counter, last), sealed, nil)
+	if err != nil {
+		if last {
+			return fmt.Errorf("%w: %v", ErrStreamTruncated, err)
+		}
+
+		return fmt.Errorf("%w: chunk %d: %v", ErrInvalidData, d.counter, err)
+	}
+
+	d.out = opened
+	d.counter++
+	d.done = last
+	if !last {
+		d.chunk = append(d.chunk[:0], d.chunk[sealedSize:]...)
+	}
+
+	return nil
+}
+
+// EncryptStream encrypts src into dst with chunked AES-GCM.
+func EncryptStream(dst io.Writer, src io.Reader, key []byte, opts ...streamOption) error {
+	w, err := NewEncryptWriter(dst, key, opts...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// DecryptStream decrypts src, written by EncryptStream, into dst. Data
+// written to dst before an error is returned must not be trusted.
+func DecryptStream(dst io.Writer, src io.Reader, key []byte) error {
+	r, err := NewDecryptReader(src, key)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, r)
+	return err
+}
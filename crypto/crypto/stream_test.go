@@ -0,0 +1,107 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	for _, size := range []int{0, 1, 100, 1024, 1025, 5000} {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		var encrypted bytes.Buffer
+		err := EncryptStream(&encrypted, bytes.NewReader(data), key, WithChunkSize(1024))
+		assert.Nilf(t, err, "should be able to encrypt %d bytes", size)
+
+		var decrypted bytes.Buffer
+		err = DecryptStream(&decrypted, bytes.NewReader(encrypted.Bytes()), key)
+		assert.Nilf(t, err, "should be able to decrypt %d bytes", size)
+		assert.True(t, bytes.Equal(data, decrypted.Bytes()))
+	}
+}
+
+func TestStream_Tampering(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	data := make([]byte, 3000)
+	rand.Read(data)
+
+	var buf bytes.Buffer
+	assert.Nil(t, EncryptStream(&buf, bytes.NewReader(data), key, WithChunkSize(1000)))
+	encrypted := buf.Bytes()
+
+	headerSize := len(streamMagic) + 1 + 4 + streamNoncePrefixSize
+	sealedSize := 1000 + 16
+
+	decrypt := func(b []byte) error {
+		return DecryptStream(io.Discard, bytes.NewReader(b), key)
+	}
+
+	truncated := encrypted[:headerSize+2*sealedSize]
+	assert.ErrorIsf(t, decrypt(truncated), ErrStreamTruncated, "dropping the last chunk should be detected")
+
+	swapped := append([]byte{}, encrypted[:headerSize]...)
+	swapped = append(swapped, encrypted[headerSize+sealedSize:headerSize+2*sealedSize]...)
+	swapped = append(swapped, encrypted[headerSize:headerSize+sealedSize]...)
+	swapped = append(swapped, encrypted[headerSize+2*sealedSize:]...)
+	assert.NotNilf(t, decrypt(swapped), "reordering chunks should be detected")
+
+	flipped := append([]byte{}, encrypted...)
+	flipped[headerSize+10] ^= 1
+	assert.NotNilf(t, decrypt(flipped), "modifying a chunk should be detected")
+
+	otherKey := make([]byte, 32)
+	rand.Read(otherKey)
+	assert.NotNil(t, DecryptStream(io.Discard, bytes.NewReader(encrypted), otherKey))
+
+	oversized := append([]byte{}, encrypted...)
+	binary.BigEndian.PutUint32(oversized[len(streamMagic)+1:], MaxChunkSize+1)
+	_, err := NewDecryptReader(bytes.NewReader(oversized), key)
+	assert.ErrorIsf(t, err, ErrInvalidData, "should reject a chunk size above MaxChunkSize")
+
+	_, err = NewEncryptWriter(io.Discard, key, WithChunkSize(MaxChunkSize+1))
+	assert.ErrorIs(t, err, ErrInvalidData)
+}
+
+func TestEnvelopeAlgorithm_Stream(t *testing.T) {
+	rsaKey, err := keys.NewRSA()
+	assert.Nil(t, err)
+	algo := NewEnvelopeAlgorithm(NewKeyEncryptionKeys(NewRSAKeyEncryptionKey("rsa", 1, rsaKey)))
+
+	data := make([]byte, 200*1024)
+	rand.Read(data)
+
+	var buf bytes.Buffer
+	w, err := algo.EncryptWriter(&buf)
+	assert.Nil(t, err)
+	_, err = io.Copy(w, bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	r, err := algo.DecryptReader(bytes.NewReader(buf.Bytes()))
+	assert.Nilf(t, err, "should be able to open the stream")
+	decrypted, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(data, decrypted))
+
+	rewrapped, err := algo.Rewrap(buf.Bytes())
+	assert.Nilf(t, err, "should be able to rewrap a stream")
+	r, err = algo.DecryptReader(bytes.NewReader(rewrapped))
+	assert.Nil(t, err)
+	decrypted, err = io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(data, decrypted))
+
+	_, err = algo.Decrypt(buf.Bytes())
+	assert.ErrorIsf(t, err, ErrInvalidData, "streams should not be decrypted as a single message")
+}
@@ -13,3 +13,7 @@ type ClaimsWrapper[C any] struct {
 	jwt.RegisteredClaims
 	CustomClaims C `json:"custom_claims"`
 }
+
+func (c ClaimsWrapper[C]) registeredClaims() *jwt.RegisteredClaims {
+	return &c.RegisteredClaims
+}
@@ -1,7 +1,10 @@
 package jwt
 
 import (
+	"fmt"
 	"os"
+	"regexp"
+	"time"
 
 	"github.com/google/uuid"
 	"gopkg.in/yaml.v3"
@@ -19,6 +22,10 @@ func ParseTokenConfigFile(f string) (*TokenConfiguration, error) {
 		return nil, err
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid token configuration %s: %v", f, err)
+	}
+
 	return &cfg, nil
 }
 
@@ -27,6 +34,26 @@ type TokenConfiguration struct {
 	Issuer                  string   `yaml:"issuer"`
 	IdGenType               string   `yaml:"id_gen_type"`
 	ValidityDurationSeconds float64  `yaml:"validity_duration_seconds"`
+	// SigningAlgorithm is one of RS256, RS384, RS512, PS256, ES256, ES384,
+	// ES512 or EdDSA. Defaults to the signing key's own algorithm.
+	SigningAlgorithm string `yaml:"signing_algorithm,omitempty"`
+	// JWKSURL is where the issuer publishes its public keys, either an http(s)
+	// URL or a local file path. Only used to verify tokens from other issuers.
+	JWKSURL string `yaml:"jwks_url,omitempty"`
+	// LeewaySeconds is the clock skew tolerated when checking exp, nbf, iat
+	// and the max age.
+	LeewaySeconds float64 `yaml:"leeway_seconds,omitempty"`
+	// NotBeforeOffsetSeconds is added to the issue time to compute the nbf
+	// claim of issued tokens. A negative offset backdates it.
+	NotBeforeOffsetSeconds float64 `yaml:"not_before_offset_seconds,omitempty"`
+	// MaxAgeSeconds rejects tokens issued longer ago than this, regardless of
+	// their expiry. Tokens without an iat claim are rejected when set.
+	MaxAgeSeconds float64 `yaml:"max_age_seconds,omitempty"`
+	// RequiredClaims lists the custom claims that must be present.
+	RequiredClaims []string `yaml:"required_claims,omitempty"`
+	// AllowedSubjects is a regular expression the whole sub claim must match,
+	// it is anchored at both ends, so "user-1" does not allow "user-10".
+	AllowedSubjects string `yaml:"allowed_subjects,omitempty"`
 }
 
 func (tc *TokenConfiguration) GenerateId() string {
@@ -41,3 +68,37 @@ func (tc *TokenConfiguration) GenerateId() string {
 
 	return id
 }
+
+// ValidMethods returns the algorithms accepted when verifying tokens, the
+// configured one or the fallback when none is configured.
+func (tc *TokenConfiguration) ValidMethods(fallback ...string) []string {
+	if tc.SigningAlgorithm != "" {
+		return []string{tc.SigningAlgorithm}
+	}
+
+	return fallback
+}
+
+// Validate checks the configuration for values that would make every token
+// invalid.
+func (tc *TokenConfiguration) Validate() error {
+	if tc.AllowedSubjects != "" {
+		if _, err := regexp.Compile(tc.AllowedSubjects); err != nil {
+			return fmt.Errorf("invalid allowed_subjects: %v", err)
+		}
+	}
+
+	if tc.LeewaySeconds < 0 {
+		return fmt.Errorf("leeway_seconds must not be negative")
+	}
+
+	if tc.MaxAgeSeconds < 0 {
+		return fmt.Errorf("max_age_seconds must not be negative")
+	}
+
+	return nil
+}
+
+func (tc *TokenConfiguration) leeway() time.Duration {
+	return time.Duration(tc.LeewaySeconds * float64(time.Second))
+}
@@ -3,7 +3,16 @@ package jwt
 import "errors"
 
 var (
-	ErrInvalidAudience = errors.New("invalid audience")
-	ErrInvalidSubject  = errors.New("invalid subject")
-	ErrInvalidIssuer   = errors.New("invalid issuer")
+	ErrInvalidAudience    = errors.New("invalid audience")
+	ErrInvalidSubject     = errors.New("invalid subject")
+	ErrInvalidIssuer      = errors.New("invalid issuer")
+	ErrInvalidClaims      = errors.New("invalid claims")
+	ErrTokenRevoked       = errors.New("token has been revoked")
+	ErrRefreshTokenReused = errors.New("refresh token was reused, token family revoked")
+	ErrUnknownTokenFamily = errors.New("unknown token family")
+	ErrIssueNotSupported  = errors.New("issuing tokens is not supported by this issuer")
+	ErrNoJWKSURL          = errors.New("no jwks url configured")
+	ErrMissingClaim       = errors.New("missing required claim")
+	ErrTokenTooOld        = errors.New("token exceeds max age")
+	ErrStaleJWKS          = errors.New("jwks could not be refreshed")
 )
@@ -1,39 +1,77 @@
 package jwt
 
 import (
+	"context"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/ooqls/getset/crypto/keys"
+	"github.com/ooqls/getset/log"
+	"go.uber.org/zap"
 )
 
+var l *zap.Logger = log.NewLogger("jwt")
+
 type TokenIssuer[C any] interface {
 	IssueToken(subj string, customClaim C) (string, *jwt.Token, error)
 	Decrypt(token string) (*jwt.Token, C, error)
 	GetIssuer() string
 }
 
-func newParserValidator(cfg *TokenConfiguration) (*jwt.Parser, *jwt.Validator) {
+func newParserValidator(cfg *TokenConfiguration, validMethods []string) (*jwt.Parser, *jwt.Validator) {
 	var opts []jwt.ParserOption
 	for _, aud := range cfg.Audience {
 		opts = append(opts, jwt.WithAudience(aud))
 	}
 	opts = append(opts, jwt.WithIssuer(cfg.Issuer))
-	opts = append(opts, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Name}))
+	opts = append(opts, jwt.WithValidMethods(validMethods))
+	opts = append(opts, jwt.WithLeeway(cfg.leeway()))
+	if cfg.MaxAgeSeconds > 0 {
+		opts = append(opts, jwt.WithIssuedAt())
+	}
 	p := jwt.NewParser(opts...)
 	v := jwt.NewValidator(opts...)
 	return p, v
 }
 
+type issuerOptions struct {
+	revocations RevocationList
+	hook        ValidationHook
+}
+
+type issuerOption func(*issuerOptions)
+
+// WithRevocationList makes the issuer reject tokens whose id has been revoked.
+func WithRevocationList(rl RevocationList) issuerOption {
+	return func(o *issuerOptions) {
+		o.revocations = rl
+	}
+}
+
+// WithValidationHook adds a check that runs after all configured validation
+// has passed. An error from the hook makes the token invalid.
+func WithValidationHook(hook ValidationHook) issuerOption {
+	return func(o *issuerOptions) {
+		o.hook = hook
+	}
+}
+
 func NewJwtTokenIssuer[C any](cfg *TokenConfiguration,
-	key keys.JwtSigningKey) TokenIssuer[C] {
-	p, v := newParserValidator(cfg)
+	key keys.JwtSigningKey, opts ...issuerOption) TokenIssuer[C] {
+	var o issuerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	p, v := newParserValidator(cfg, cfg.ValidMethods(key.Algorithm()))
 	return &jwtTokenIssuer[C]{
-		key:       key,
-		cfg:       cfg,
-		parser:    p,
-		validator: v,
+		key:         key,
+		cfg:         cfg,
+		parser:      p,
+		validator:   v,
+		claims:      newClaimsValidator(cfg, "custom_claims", o.hook),
+		revocations: o.revocations,
 	}
 }
 
@@ -45,21 +83,25 @@ func NewDefaultJwtTokenIssuer[C any]() TokenIssuer[C] {
 		ValidityDurationSeconds: 60 * 10,
 	}
 
-	p, v := newParserValidator(&tokenCfg)
+	key := keys.JWT()
+	p, v := newParserValidator(&tokenCfg, tokenCfg.ValidMethods(key.Algorithm()))
 	return &jwtTokenIssuer[C]{
-		key:       keys.JWT(),
+		key:       key,
 		cfg:       &tokenCfg,
 		parser:    p,
 		validator: v,
+		claims:    newClaimsValidator(&tokenCfg, "custom_claims", nil),
 	}
 
 }
 
 type jwtTokenIssuer[C any] struct {
-	key       keys.JwtSigningKey
-	cfg       *TokenConfiguration
-	parser    *jwt.Parser
-	validator *jwt.Validator
+	key         keys.JwtSigningKey
+	cfg         *TokenConfiguration
+	parser      *jwt.Parser
+	validator   *jwt.Validator
+	claims      *claimsValidator
+	revocations RevocationList
 }
 
 func (f *jwtTokenIssuer[C]) IssueToken(subject string, customClaim C) (string, *jwt.Token, error) {
@@ -69,13 +111,15 @@ func (f *jwtTokenIssuer[C]) IssueToken(subject string, customClaim C) (string, *
 	}
 
 	id := uuid.New().String()
+	now := time.Now()
+	notBefore := now.Add(time.Duration(f.cfg.NotBeforeOffsetSeconds * float64(time.Second)))
 	regClaims := jwt.RegisteredClaims{
 		Issuer:    f.cfg.Issuer,
 		Subject:   subject,
 		Audience:  f.cfg.Audience,
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Second * time.Duration(f.cfg.ValidityDurationSeconds))),
-		NotBefore: jwt.NewNumericDate(time.Now()),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Second * time.Duration(f.cfg.ValidityDurationSeconds))),
+		NotBefore: jwt.NewNumericDate(notBefore),
+		IssuedAt:  jwt.NewNumericDate(now),
 		ID:        id,
 	}
 
@@ -84,17 +128,40 @@ func (f *jwtTokenIssuer[C]) IssueToken(subject string, customClaim C) (string, *
 		CustomClaims:     customClaim,
 	}
 
+	if f.cfg.SigningAlgorithm != "" {
+		return f.key.SignWithAlgorithm(f.cfg.SigningAlgorithm, claim)
+	}
+
 	return f.key.Sign(claim)
 }
 
 func (f *jwtTokenIssuer[C]) Decrypt(token string) (*jwt.Token, C, error) {
 
 	claimWrapper := ClaimsWrapper[C]{}
-	jwtToken, err := f.parser.ParseWithClaims(token, &claimWrapper, func(t *jwt.Token) (interface{}, error) {
-		return f.key.PublicKey(), nil
-	})
+	jwtToken, err := f.parser.ParseWithClaims(token, &claimWrapper, f.key.Keyfunc)
+	if err != nil {
+		return jwtToken, claimWrapper.CustomClaims, err
+	}
+
+	if err := f.claims.validate(jwtToken, &claimWrapper.RegisteredClaims); err != nil {
+		jwtToken.Valid = false
+		return jwtToken, claimWrapper.CustomClaims, err
+	}
+
+	if f.revocations != nil {
+		revoked, err := f.revocations.IsRevoked(context.Background(), claimWrapper.ID)
+		if err != nil {
+			jwtToken.Valid = false
+			return jwtToken, claimWrapper.CustomClaims, err
+		}
+
+		if revoked {
+			jwtToken.Valid = false
+			return jwtToken, claimWrapper.CustomClaims, ErrTokenRevoked
+		}
+	}
 
-	return jwtToken, claimWrapper.CustomClaims, err
+	return jwtToken, claimWrapper.CustomClaims, nil
 }
 
 func (f *jwtTokenIssuer[C]) GetIssuer() string {
@@ -39,3 +39,43 @@ func TestIsIssuer(t *testing.T) {
 	assert.NotNilf(t, err, "should not have gotten an error")
 	assert.Falsef(t, notJwtToken.Valid, "token should not be valid")
 }
+
+func TestIssuer_SigningAlgorithm(t *testing.T) {
+	key, err := keys.GenerateJWTKey(keys.ES256)
+	assert.Nil(t, err)
+
+	issuer := NewJwtTokenIssuer[string](&TokenConfiguration{
+		Audience:                []string{"aud"},
+		Issuer:                  "issuer",
+		ValidityDurationSeconds: 60,
+	}, key)
+
+	tokenStr, token, err := issuer.IssueToken("123", "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, keys.ES256, token.Method.Alg())
+
+	_, claims, err := issuer.Decrypt(tokenStr)
+	assert.Nilf(t, err, "should verify with the key's algorithm")
+	assert.Equal(t, "hello", claims)
+
+	rsaKey, err := keys.GenerateJWTKey(keys.RS256)
+	assert.Nil(t, err)
+	psIssuer := NewJwtTokenIssuer[string](&TokenConfiguration{
+		Audience:                []string{"aud"},
+		Issuer:                  "issuer",
+		ValidityDurationSeconds: 60,
+		SigningAlgorithm:        keys.PS256,
+	}, rsaKey)
+
+	tokenStr, token, err = psIssuer.IssueToken("123", "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, keys.PS256, token.Method.Alg())
+
+	_, _, err = psIssuer.Decrypt(tokenStr)
+	assert.Nil(t, err)
+
+	rsTokenStr, _, err := rsaKey.Sign(ClaimsWrapper[string]{})
+	assert.Nil(t, err)
+	_, _, err = psIssuer.Decrypt(rsTokenStr)
+	assert.NotNilf(t, err, "should reject algorithms other than the configured one")
+}
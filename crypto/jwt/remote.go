@@ -0,0 +1,277 @@
+package jwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ooqls/getset/crypto/keys"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+type jwksOptions struct {
+	client             *http.Client
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	maxStaleness       time.Duration
+}
+
+type jwksOption func(*jwksOptions)
+
+func WithJWKSHTTPClient(c *http.Client) jwksOption {
+	return func(o *jwksOptions) {
+		o.client = c
+	}
+}
+
+// WithJWKSRefreshInterval sets how long a fetched key set is used before it
+// is fetched again.
+func WithJWKSRefreshInterval(d time.Duration) jwksOption {
+	return func(o *jwksOptions) {
+		o.refreshInterval = d
+	}
+}
+
+// WithJWKSMinRefreshInterval limits how often an unknown kid can trigger a
+// fetch, so tokens with made up kids cannot hammer the identity provider.
+func WithJWKSMinRefreshInterval(d time.Duration) jwksOption {
+	return func(o *jwksOptions) {
+		o.minRefreshInterval = d
+	}
+}
+
+// WithJWKSMaxStaleness sets how long the cached key set is still used while
+// refreshing it fails, so a short outage of the identity provider does not
+// fail every token check.
+func WithJWKSMaxStaleness(d time.Duration) jwksOption {
+	return func(o *jwksOptions) {
+		o.maxStaleness = d
+	}
+}
+
+// JWKSClient fetches and caches a JWKS document from a URL or local file.
+// Concurrent refreshes share one fetch, which runs without holding the lock
+// so a slow endpoint does not block checks against the cached keys.
+type JWKSClient struct {
+	source string
+	opts   jwksOptions
+	fetch  singleflight.Group
+
+	m           sync.RWMutex
+	keys        map[string]interface{}
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func NewJWKSClient(source string, opts ...jwksOption) *JWKSClient {
+	o := jwksOptions{
+		client:             http.DefaultClient,
+		refreshInterval:    time.Hour,
+		minRefreshInterval: time.Minute,
+		maxStaleness:       24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &JWKSClient{
+		source: source,
+		opts:   o,
+		keys:   map[string]interface{}{},
+	}
+}
+
+func (c *JWKSClient) read() ([]byte, error) {
+	if !strings.HasPrefix(c.source, "http://") && !strings.HasPrefix(c.source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(c.source, "file://"))
+	}
+
+	resp, err := c.opts.client.Get(c.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func (c *JWKSClient) load() (map[string]interface{}, error) {
+	b, err := c.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks from %s: %v", c.source, err)
+	}
+
+	set, err := keys.ParseJWKSet(b)
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		pub, err := k.PublicKey()
+		if err != nil {
+			l.Warn("skipping jwk", zap.String("kid", k.Kid), zap.Error(err))
+			continue
+		}
+		fetched[k.Kid] = pub
+	}
+
+	return fetched, nil
+}
+
+// refresh fetches the key set once for all concurrent callers and keeps the
+// cached keys if it fails.
+func (c *JWKSClient) refresh() error {
+	_, err, _ := c.fetch.Do("", func() (interface{}, error) {
+		c.m.Lock()
+		c.attemptedAt = time.Now()
+		c.m.Unlock()
+
+		fetched, err := c.load()
+		if err != nil {
+			return nil, err
+		}
+
+		c.m.Lock()
+		defer c.m.Unlock()
+		c.keys = fetched
+		c.fetchedAt = time.Now()
+		return nil, nil
+	})
+
+	return err
+}
+
+func (c *JWKSClient) lookup(kid string) (interface{}, bool, time.Time, time.Time) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	key, ok := c.keys[kid]
+	return key, ok, c.fetchedAt, c.attemptedAt
+}
+
+// Key returns the public key for kid. A stale key set is refreshed in the
+// background while the cached key is returned, an unknown kid waits for the
+// key set to be fetched. Fetches are retried at most every
+// WithJWKSMinRefreshInterval, failed ones keep the cached keys until they
+// are older than WithJWKSMaxStaleness.
+func (c *JWKSClient) Key(kid string) (interface{}, error) {
+	key, ok, fetchedAt, attemptedAt := c.lookup(kid)
+
+	now := time.Now()
+	stale := fetchedAt.IsZero() || now.Sub(fetchedAt) > c.opts.refreshInterval
+	canRetry := attemptedAt.IsZero() || now.Sub(attemptedAt) > c.opts.minRefreshInterval
+	if ok && stale && canRetry {
+		go func() {
+			if err := c.refresh(); err != nil {
+				l.Warn("failed to refresh jwks, using the cached keys",
+					zap.String("source", c.source), zap.Time("fetched_at", fetchedAt), zap.Error(err))
+			}
+		}()
+	} else if !ok && canRetry {
+		if err := c.refresh(); err != nil {
+			if fetchedAt.IsZero() {
+				return nil, err
+			}
+			l.Warn("failed to refresh jwks for an unknown kid",
+				zap.String("source", c.source), zap.String("kid", kid), zap.Error(err))
+		}
+		key, ok, fetchedAt, _ = c.lookup(kid)
+	}
+
+	if fetchedAt.IsZero() {
+		return nil, fmt.Errorf("%w: no keys fetched from %s yet", ErrStaleJWKS, c.source)
+	}
+
+	if time.Since(fetchedAt) > c.opts.maxStaleness {
+		return nil, fmt.Errorf("%w: last fetched from %s at %s", ErrStaleJWKS, c.source, fetchedAt)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", keys.ErrUnknownKeyId, kid)
+	}
+
+	return key, nil
+}
+
+func (c *JWKSClient) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	return c.Key(kid)
+}
+
+// remoteClaims decodes the registered claims and hands the whole payload to
+// C, since third party issuers put their claims at the top level.
+type remoteClaims[C any] struct {
+	jwt.RegisteredClaims
+	CustomClaims C
+}
+
+func (c *remoteClaims[C]) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &c.RegisteredClaims); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, &c.CustomClaims)
+}
+
+// NewRemoteTokenVerifier returns a TokenIssuer that only verifies tokens of a
+// third party issuer, using the keys published at cfg.JWKSURL. The custom
+// claims C are decoded from the full token payload.
+func NewRemoteTokenVerifier[C any](cfg *TokenConfiguration, opts ...jwksOption) (TokenIssuer[C], error) {
+	if cfg.JWKSURL == "" {
+		return nil, ErrNoJWKSURL
+	}
+
+	p, _ := newParserValidator(cfg, cfg.ValidMethods(keys.SigningAlgorithms...))
+	return &remoteTokenVerifier[C]{
+		cfg:    cfg,
+		parser: p,
+		claims: newClaimsValidator(cfg, "", nil),
+		jwks:   NewJWKSClient(cfg.JWKSURL, opts...),
+	}, nil
+}
+
+type remoteTokenVerifier[C any] struct {
+	cfg    *TokenConfiguration
+	parser *jwt.Parser
+	claims *claimsValidator
+	jwks   *JWKSClient
+}
+
+func (v *remoteTokenVerifier[C]) IssueToken(subj string, customClaim C) (string, *jwt.Token, error) {
+	return "", nil, ErrIssueNotSupported
+}
+
+func (v *remoteTokenVerifier[C]) Decrypt(token string) (*jwt.Token, C, error) {
+	claims := remoteClaims[C]{}
+	jwtToken, err := v.parser.ParseWithClaims(token, &claims, v.jwks.Keyfunc)
+	if err != nil {
+		return jwtToken, claims.CustomClaims, err
+	}
+
+	if err := v.claims.validate(jwtToken, &claims.RegisteredClaims); err != nil {
+		jwtToken.Valid = false
+		return jwtToken, claims.CustomClaims, err
+	}
+
+	return jwtToken, claims.CustomClaims, nil
+}
+
+func (v *remoteTokenVerifier[C]) GetIssuer() string {
+	return v.cfg.Issuer
+}
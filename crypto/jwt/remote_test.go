@@ -0,0 +1,161 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestJwtKey(t *testing.T) *keys.JwtKey {
+	rsakey, err := keys.NewRSA()
+	assert.Nilf(t, err, "should be able to create rsa key")
+	return keys.NewJWTKey(*rsakey)
+}
+
+func TestRemoteTokenVerifier(t *testing.T) {
+	current := newTestJwtKey(t)
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(current.JWKS())
+	}))
+	defer srv.Close()
+
+	cfg := &TokenConfiguration{
+		Audience:                []string{"api"},
+		Issuer:                  "idp",
+		ValidityDurationSeconds: 60,
+		JWKSURL:                 srv.URL,
+	}
+	verifier, err := NewRemoteTokenVerifier[map[string]any](cfg, WithJWKSMinRefreshInterval(0))
+	assert.Nilf(t, err, "should be able to create verifier")
+
+	tokenStr, _, err := NewJwtTokenIssuer[string](cfg, current).IssueToken("123", "hello")
+	assert.Nil(t, err)
+
+	token, claims, err := verifier.Decrypt(tokenStr)
+	assert.Nilf(t, err, "should verify token from the remote issuer")
+	assert.True(t, token.Valid)
+	assert.Equal(t, "hello", claims["custom_claims"])
+	assert.Equal(t, int32(1), fetches.Load())
+
+	_, _, err = verifier.Decrypt(tokenStr)
+	assert.Nil(t, err)
+	assert.Equalf(t, int32(1), fetches.Load(), "should use the cached key set")
+
+	// the provider rotates its key, the unknown kid triggers a refetch
+	current = newTestJwtKey(t)
+	tokenStr, _, err = NewJwtTokenIssuer[string](cfg, current).IssueToken("123", "hello")
+	assert.Nil(t, err)
+
+	_, _, err = verifier.Decrypt(tokenStr)
+	assert.Nilf(t, err, "should verify token signed with the rotated key")
+	assert.Equal(t, int32(2), fetches.Load())
+
+	otherCfg := *cfg
+	otherCfg.Issuer = "other"
+	tokenStr, _, err = NewJwtTokenIssuer[string](&otherCfg, current).IssueToken("123", "hello")
+	assert.Nil(t, err)
+
+	_, _, err = verifier.Decrypt(tokenStr)
+	assert.NotNilf(t, err, "should reject tokens of another issuer")
+
+	_, _, err = verifier.IssueToken("123", nil)
+	assert.ErrorIs(t, err, ErrIssueNotSupported)
+}
+
+func TestRemoteTokenVerifier_File(t *testing.T) {
+	key := newTestJwtKey(t)
+	b, err := json.Marshal(key.JWKS())
+	assert.Nil(t, err)
+
+	f, err := os.CreateTemp("", "jwks-*.json")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(b)
+	assert.Nil(t, err)
+
+	cfg := &TokenConfiguration{
+		Audience:                []string{"api"},
+		Issuer:                  "idp",
+		ValidityDurationSeconds: 60,
+		JWKSURL:                 f.Name(),
+	}
+	verifier, err := NewRemoteTokenVerifier[map[string]any](cfg)
+	assert.Nil(t, err)
+
+	tokenStr, _, err := NewJwtTokenIssuer[string](cfg, key).IssueToken("123", "hello")
+	assert.Nil(t, err)
+
+	_, _, err = verifier.Decrypt(tokenStr)
+	assert.Nilf(t, err, "should verify token with keys from a file")
+
+	_, err = NewRemoteTokenVerifier[string](&TokenConfiguration{})
+	assert.ErrorIs(t, err, ErrNoJWKSURL)
+}
+
+func TestJWKSClient_Outage(t *testing.T) {
+	key := newTestJwtKey(t)
+	var failing atomic.Bool
+	block := make(chan struct{})
+	release := sync.OnceFunc(func() { close(block) })
+	var blocking atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if blocking.Load() {
+			<-block
+		}
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(key.JWKS())
+	}))
+	defer srv.Close()
+	defer release()
+
+	client := NewJWKSClient(srv.URL,
+		WithJWKSRefreshInterval(time.Millisecond),
+		WithJWKSMinRefreshInterval(0),
+		WithJWKSMaxStaleness(200*time.Millisecond))
+	_, err := client.Key(key.KeyId())
+	assert.Nil(t, err)
+
+	// a hanging endpoint does not block checks against the cached keys
+	blocking.Store(true)
+	time.Sleep(2 * time.Millisecond)
+	done := make(chan error)
+	go func() {
+		_, err := client.Key(key.KeyId())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("should not wait for the refresh of a stale key set")
+	}
+	failing.Store(true)
+	release()
+	_, err = client.Key(key.KeyId())
+	assert.Nilf(t, err, "should keep the cached keys while the endpoint fails")
+
+	assert.Eventuallyf(t, func() bool {
+		_, err := client.Key(key.KeyId())
+		return errors.Is(err, ErrStaleJWKS)
+	}, time.Second, 10*time.Millisecond, "should fail once the cached keys exceed the max staleness")
+
+	failing.Store(false)
+	assert.Eventuallyf(t, func() bool {
+		_, err := client.Key(key.KeyId())
+		return err == nil
+	}, time.Second, 10*time.Millisecond, "should recover once the endpoint is back")
+}
@@ -0,0 +1,54 @@
+package jwt
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ooqls/getset/cache/cache"
+	"github.com/ooqls/getset/cache/store"
+)
+
+// RevocationList records the ids of tokens that must no longer be accepted,
+// even though their signature and expiry are still valid.
+type RevocationList interface {
+	Revoke(ctx context.Context, tokenId string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, tokenId string) (bool, error)
+}
+
+func NewStoreRevocationList(s store.GenericInterface) RevocationList {
+	return &storeRevocationList{s: s}
+}
+
+type storeRevocationList struct {
+	s store.GenericInterface
+}
+
+func (r *storeRevocationList) key(tokenId string) string {
+	return fmt.Sprintf("revoked/%s", tokenId)
+}
+
+// Revoke adds the token id to the deny list. The entry only lives as long as
+// the token itself would have, since an expired token is rejected anyway.
+func (r *storeRevocationList) Revoke(ctx context.Context, tokenId string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return r.s.SetWithTTL(ctx, r.key(tokenId), expiresAt, ttl)
+}
+
+func (r *storeRevocationList) IsRevoked(ctx context.Context, tokenId string) (bool, error) {
+	var expiresAt time.Time
+	err := r.s.Get(ctx, r.key(tokenId), &expiresAt)
+	if err != nil {
+		if cache.IsCacheMissErr(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to check revocation list: %v", err)
+	}
+
+	return time.Now().Before(expiresAt), nil
+}
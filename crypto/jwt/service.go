@@ -0,0 +1,327 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/ooqls/getset/cache/cache"
+	"github.com/ooqls/getset/cache/store"
+	"github.com/ooqls/getset/crypto/keys"
+)
+
+// RefreshClaims are the custom claims carried by a refresh token. The family
+// ties every refresh token obtained through rotation back to the original
+// login so that the whole chain can be revoked at once.
+type RefreshClaims[C any] struct {
+	Family string `json:"family"`
+	Claims C      `json:"claims"`
+}
+
+type TokenPair struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+type issuedToken struct {
+	Id        string
+	ExpiresAt time.Time
+}
+
+// tokenFamily is the state kept for a chain of rotated refresh tokens. Fields
+// are exported so the state can be gob encoded by the store.
+type tokenFamily struct {
+	Subject          string
+	CurrentRefreshId string
+	RefreshExpiresAt time.Time
+	AccessTokens     []issuedToken
+	Revoked          bool
+}
+
+// TokenService issues access/refresh token pairs, rotates the refresh token
+// every time it is used and revokes the whole token family when a rotated
+// refresh token is presented again.
+type TokenService[C any] struct {
+	access      TokenIssuer[C]
+	refresh     TokenIssuer[RefreshClaims[C]]
+	revocations RevocationList
+	s           store.GenericInterface
+}
+
+// NewTokenService keeps the state of token families in s, which should expire
+// entries after the validity of the refresh tokens.
+func NewTokenService[C any](accessCfg, refreshCfg *TokenConfiguration, key keys.JwtSigningKey, s store.GenericInterface) *TokenService[C] {
+	revocations := NewStoreRevocationList(s)
+	return &TokenService[C]{
+		access:      NewJwtTokenIssuer[C](accessCfg, key, WithRevocationList(revocations)),
+		refresh:     NewJwtTokenIssuer[RefreshClaims[C]](refreshCfg, key, WithRevocationList(revocations)),
+		revocations: revocations,
+		s:           s,
+	}
+}
+
+func (ts *TokenService[C]) familyKey(family string) string {
+	return fmt.Sprintf("family/%s", family)
+}
+
+// AccessIssuer returns the issuer used to verify access tokens. Its Decrypt
+// consults the same revocation list as the service.
+func (ts *TokenService[C]) AccessIssuer() TokenIssuer[C] {
+	return ts.access
+}
+
+// Issue creates a new token family for the subject and returns its first
+// access/refresh token pair.
+func (ts *TokenService[C]) Issue(ctx context.Context, subject string, claims C) (*TokenPair, error) {
+	family := uuid.NewString()
+	pair, access, refresh, err := ts.issuePair(subject, family, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	state := tokenFamily{
+		Subject:          subject,
+		CurrentRefreshId: refresh.Id,
+		RefreshExpiresAt: refresh.ExpiresAt,
+		AccessTokens:     []issuedToken{access},
+	}
+
+	if err := ts.saveFamily(ctx, family, state); err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented
+// refresh token is revoked; presenting it again revokes the whole family.
+func (ts *TokenService[C]) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	token, claims, err := ts.refresh.Decrypt(refreshToken)
+	if err != nil {
+		if errors.Is(err, ErrTokenRevoked) && claims.Family != "" {
+			if revokeErr := ts.RevokeFamily(ctx, claims.Family); revokeErr != nil {
+				return nil, fmt.Errorf("failed to revoke token family: %v", revokeErr)
+			}
+
+			return nil, ErrRefreshTokenReused
+		}
+
+		return nil, err
+	}
+
+	presented, err := tokenRegisteredClaims(token)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := ts.loadFamily(ctx, claims.Family)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.Revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	if state.CurrentRefreshId != presented.ID {
+		if err := ts.RevokeFamily(ctx, claims.Family); err != nil {
+			return nil, fmt.Errorf("failed to revoke token family: %v", err)
+		}
+
+		return nil, ErrRefreshTokenReused
+	}
+
+	pair, access, refresh, err := ts.issuePair(state.Subject, claims.Family, claims.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// Swap the current refresh id in a single Update, so neither a concurrent
+	// use of the same token nor a concurrent RevokeFamily is overwritten on
+	// stores whose Update is atomic. The family keeps the store's ttl, the
+	// validity of the refresh token.
+	var rotated tokenFamily
+	err = ts.s.Update(ctx, ts.familyKey(claims.Family), func(get func(target any) error) (any, error) {
+		if err := get(&rotated); err != nil {
+			return nil, err
+		}
+
+		if rotated.Revoked {
+			return nil, ErrTokenRevoked
+		}
+
+		if rotated.CurrentRefreshId != presented.ID {
+			return nil, ErrRefreshTokenReused
+		}
+
+		rotated.CurrentRefreshId = refresh.Id
+		rotated.RefreshExpiresAt = refresh.ExpiresAt
+		rotated.AccessTokens = append(unexpired(rotated.AccessTokens), access)
+		return rotated, nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			if revokeErr := ts.RevokeFamily(ctx, claims.Family); revokeErr != nil {
+				return nil, fmt.Errorf("failed to revoke token family: %v", revokeErr)
+			}
+		}
+
+		return nil, err
+	}
+
+	if err := ts.revocations.Revoke(ctx, presented.ID, presented.ExpiresAt.Time); err != nil {
+		return nil, fmt.Errorf("failed to revoke rotated refresh token: %v", err)
+	}
+
+	return pair, nil
+}
+
+// Revoke revokes the family the given refresh token belongs to, e.g. on
+// logout.
+func (ts *TokenService[C]) Revoke(ctx context.Context, refreshToken string) error {
+	_, claims, err := ts.refresh.Decrypt(refreshToken)
+	if err != nil && !errors.Is(err, ErrTokenRevoked) {
+		return err
+	}
+
+	if claims.Family == "" {
+		return ErrUnknownTokenFamily
+	}
+
+	return ts.RevokeFamily(ctx, claims.Family)
+}
+
+// RevokeFamily denies the current refresh token and every unexpired access
+// token issued within the family.
+func (ts *TokenService[C]) RevokeFamily(ctx context.Context, family string) error {
+	// mark the family revoked first, a concurrent Refresh then either fails
+	// or has already rotated and its tokens are revoked below
+	var state tokenFamily
+	err := ts.s.Update(ctx, ts.familyKey(family), func(get func(target any) error) (any, error) {
+		if err := get(&state); err != nil {
+			return nil, err
+		}
+
+		state.AccessTokens = unexpired(state.AccessTokens)
+		state.Revoked = true
+		return state, nil
+	})
+	if err != nil {
+		if cache.IsCacheMissErr(err) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to revoke token family: %v", err)
+	}
+
+	if err := ts.revocations.Revoke(ctx, state.CurrentRefreshId, state.RefreshExpiresAt); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %v", err)
+	}
+
+	for _, t := range state.AccessTokens {
+		if err := ts.revocations.Revoke(ctx, t.Id, t.ExpiresAt); err != nil {
+			return fmt.Errorf("failed to revoke access token: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (ts *TokenService[C]) issuePair(subject, family string, claims C) (*TokenPair, issuedToken, issuedToken, error) {
+	accessStr, accessToken, err := ts.access.IssueToken(subject, claims)
+	if err != nil {
+		return nil, issuedToken{}, issuedToken{}, fmt.Errorf("failed to issue access token: %v", err)
+	}
+
+	refreshStr, refreshToken, err := ts.refresh.IssueToken(subject, RefreshClaims[C]{Family: family, Claims: claims})
+	if err != nil {
+		return nil, issuedToken{}, issuedToken{}, fmt.Errorf("failed to issue refresh token: %v", err)
+	}
+
+	accessClaims, err := tokenRegisteredClaims(accessToken)
+	if err != nil {
+		return nil, issuedToken{}, issuedToken{}, err
+	}
+
+	refreshClaims, err := tokenRegisteredClaims(refreshToken)
+	if err != nil {
+		return nil, issuedToken{}, issuedToken{}, err
+	}
+
+	access := issuedToken{Id: accessClaims.ID, ExpiresAt: accessClaims.ExpiresAt.Time}
+	refresh := issuedToken{Id: refreshClaims.ID, ExpiresAt: refreshClaims.ExpiresAt.Time}
+
+	return &TokenPair{
+		AccessToken:      accessStr,
+		AccessExpiresAt:  access.ExpiresAt,
+		RefreshToken:     refreshStr,
+		RefreshExpiresAt: refresh.ExpiresAt,
+	}, access, refresh, nil
+}
+
+func (ts *TokenService[C]) loadFamily(ctx context.Context, family string) (*tokenFamily, error) {
+	var state tokenFamily
+	err := ts.s.Get(ctx, ts.familyKey(family), &state)
+	if err != nil {
+		if cache.IsCacheMissErr(err) {
+			return nil, ErrUnknownTokenFamily
+		}
+
+		return nil, fmt.Errorf("failed to load token family: %v", err)
+	}
+
+	return &state, nil
+}
+
+func (ts *TokenService[C]) saveFamily(ctx context.Context, family string, state tokenFamily) error {
+	ttl := time.Until(state.RefreshExpiresAt)
+	if ttl <= 0 {
+		return ts.s.Delete(ctx, ts.familyKey(family))
+	}
+
+	err := ts.s.SetWithTTL(ctx, ts.familyKey(family), state, ttl)
+	if err != nil {
+		return fmt.Errorf("failed to save token family: %v", err)
+	}
+
+	return nil
+}
+
+func unexpired(tokens []issuedToken) []issuedToken {
+	now := time.Now()
+	var valid []issuedToken
+	for _, t := range tokens {
+		if t.ExpiresAt.After(now) {
+			valid = append(valid, t)
+		}
+	}
+
+	return valid
+}
+
+func tokenRegisteredClaims(token *jwt.Token) (*jwt.RegisteredClaims, error) {
+	if token == nil {
+		return nil, ErrInvalidClaims
+	}
+
+	type registered interface {
+		registeredClaims() *jwt.RegisteredClaims
+	}
+
+	r, ok := token.Claims.(registered)
+	if !ok {
+		return nil, ErrInvalidClaims
+	}
+
+	claims := r.registeredClaims()
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, ErrInvalidClaims
+	}
+
+	return claims, nil
+}
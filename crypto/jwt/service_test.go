@@ -0,0 +1,151 @@
+package jwt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ooqls/getset/cache/store"
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/ooqls/getset/crypto/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTokenService(t *testing.T) *TokenService[map[string]string] {
+	testutils.InitKeys()
+	accessCfg := &TokenConfiguration{
+		Audience:                []string{"access"},
+		Issuer:                  "auth",
+		ValidityDurationSeconds: 60,
+	}
+	refreshCfg := &TokenConfiguration{
+		Audience:                []string{"refresh"},
+		Issuer:                  "refresh",
+		ValidityDurationSeconds: 600,
+	}
+
+	return NewTokenService[map[string]string](accessCfg, refreshCfg, keys.JWT(), store.NewMemStore(t.Name(), time.Minute))
+}
+
+func TestTokenService_Refresh(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestTokenService(t)
+
+	pair, err := ts.Issue(ctx, "123", map[string]string{"role": "admin"})
+	assert.Nilf(t, err, "should be able to issue a token pair")
+
+	_, claims, err := ts.AccessIssuer().Decrypt(pair.AccessToken)
+	assert.Nilf(t, err, "access token should be valid")
+	assert.Equal(t, "admin", claims["role"])
+
+	_, err = ts.Refresh(ctx, pair.AccessToken)
+	assert.NotNilf(t, err, "should not be able to refresh with an access token")
+
+	rotated, err := ts.Refresh(ctx, pair.RefreshToken)
+	assert.Nilf(t, err, "should be able to refresh")
+	assert.NotEqual(t, pair.RefreshToken, rotated.RefreshToken)
+
+	_, claims, err = ts.AccessIssuer().Decrypt(rotated.AccessToken)
+	assert.Nilf(t, err, "rotated access token should be valid")
+	assert.Equal(t, "admin", claims["role"])
+
+	_, err = ts.Refresh(ctx, rotated.RefreshToken)
+	assert.Nilf(t, err, "should be able to refresh the rotated token")
+}
+
+func TestTokenService_ReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestTokenService(t)
+
+	pair, err := ts.Issue(ctx, "123", nil)
+	assert.Nilf(t, err, "should be able to issue a token pair")
+
+	rotated, err := ts.Refresh(ctx, pair.RefreshToken)
+	assert.Nilf(t, err, "should be able to refresh")
+
+	_, err = ts.Refresh(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	_, err = ts.Refresh(ctx, rotated.RefreshToken)
+	assert.NotNilf(t, err, "family should be revoked after reuse")
+
+	_, _, err = ts.AccessIssuer().Decrypt(rotated.AccessToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+
+	_, _, err = ts.AccessIssuer().Decrypt(pair.AccessToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+}
+
+func TestTokenService_Revoke(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestTokenService(t)
+
+	pair, err := ts.Issue(ctx, "123", nil)
+	assert.Nilf(t, err, "should be able to issue a token pair")
+
+	assert.Nilf(t, ts.Revoke(ctx, pair.RefreshToken), "should be able to revoke")
+
+	_, err = ts.Refresh(ctx, pair.RefreshToken)
+	assert.NotNilf(t, err, "should not be able to refresh a revoked token")
+
+	token, _, err := ts.AccessIssuer().Decrypt(pair.AccessToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	assert.False(t, token.Valid)
+}
+
+// hookedStore runs a hook once around the next Update, to interleave another
+// call with it.
+type hookedStore struct {
+	store.GenericInterface
+	before, after func()
+}
+
+func (s *hookedStore) Update(ctx context.Context, key string, fn func(func(target any) error) (any, error)) error {
+	if before := s.before; before != nil {
+		s.before = nil
+		before()
+	}
+
+	err := s.GenericInterface.Update(ctx, key, fn)
+	if after := s.after; after != nil {
+		s.after = nil
+		after()
+	}
+
+	return err
+}
+
+func TestTokenService_RefreshRacingRevokeFamily(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestTokenService(t)
+	s := &hookedStore{GenericInterface: ts.s}
+	ts.s = s
+
+	family := func(pair *TokenPair) string {
+		_, claims, err := ts.refresh.Decrypt(pair.RefreshToken)
+		assert.Nil(t, err)
+		return claims.Family
+	}
+
+	pair, err := ts.Issue(ctx, "123", nil)
+	assert.Nil(t, err)
+	id := family(pair)
+	s.after = func() { assert.Nil(t, ts.RevokeFamily(ctx, id)) }
+	rotated, err := ts.Refresh(ctx, pair.RefreshToken)
+	assert.Nilf(t, err, "the refresh won the race")
+
+	state, err := ts.loadFamily(ctx, id)
+	assert.Nil(t, err)
+	assert.Truef(t, state.Revoked, "the refresh should not bring the revoked family back")
+	_, _, err = ts.AccessIssuer().Decrypt(rotated.AccessToken)
+	assert.ErrorIsf(t, err, ErrTokenRevoked, "should revoke the tokens of the rotation")
+	_, err = ts.Refresh(ctx, rotated.RefreshToken)
+	assert.NotNil(t, err)
+
+	pair, err = ts.Issue(ctx, "123", nil)
+	assert.Nil(t, err)
+	id = family(pair)
+	s.before = func() { assert.Nil(t, ts.RevokeFamily(ctx, id)) }
+	_, err = ts.Refresh(ctx, pair.RefreshToken)
+	assert.ErrorIsf(t, err, ErrTokenRevoked, "should not rotate a family revoked meanwhile")
+}
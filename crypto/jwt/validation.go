@@ -0,0 +1,117 @@
+package jwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// ValidationHook is called by Decrypt after the signature and the configured
+// claims have been verified. token.Claims holds the decoded claims, e.g. a
+// *ClaimsWrapper[C] for tokens of a jwtTokenIssuer.
+type ValidationHook func(token *jwt.Token) error
+
+// claimsValidator checks the claims that the jwt parser does not know about.
+type claimsValidator struct {
+	cfg      *TokenConfiguration
+	subjects *regexp.Regexp
+	// customKey is the payload field holding the custom claims, empty when
+	// they are at the top level.
+	customKey string
+	hook      ValidationHook
+}
+
+func newClaimsValidator(cfg *TokenConfiguration, customKey string, hook ValidationHook) *claimsValidator {
+	v := &claimsValidator{
+		cfg:       cfg,
+		customKey: customKey,
+		hook:      hook,
+	}
+
+	if cfg.AllowedSubjects != "" {
+		// anchor the expression, a partial match would allow any subject
+		// containing an allowed one
+		subjects, err := regexp.Compile(`^(?:` + cfg.AllowedSubjects + `)$`)
+		if err != nil {
+			// fail closed, no subject matches an invalid expression
+			l.Error("invalid allowed subjects expression, rejecting all tokens", zap.String("issuer", cfg.Issuer), zap.Error(err))
+			subjects = regexp.MustCompile(`$^`)
+		}
+		v.subjects = subjects
+	}
+
+	return v
+}
+
+func (v *claimsValidator) validate(token *jwt.Token, claims *jwt.RegisteredClaims) error {
+	if v.subjects != nil && !v.subjects.MatchString(claims.Subject) {
+		return fmt.Errorf("%w: %s", ErrInvalidSubject, claims.Subject)
+	}
+
+	if v.cfg.MaxAgeSeconds > 0 {
+		if claims.IssuedAt == nil {
+			return fmt.Errorf("%w: missing iat", ErrTokenTooOld)
+		}
+
+		maxAge := time.Duration(v.cfg.MaxAgeSeconds*float64(time.Second)) + v.cfg.leeway()
+		if time.Since(claims.IssuedAt.Time) > maxAge {
+			return ErrTokenTooOld
+		}
+	}
+
+	if len(v.cfg.RequiredClaims) > 0 {
+		custom, err := v.customClaims(token)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range v.cfg.RequiredClaims {
+			if _, ok := custom[name]; !ok {
+				return fmt.Errorf("%w: %s", ErrMissingClaim, name)
+			}
+		}
+	}
+
+	if v.hook != nil {
+		return v.hook(token)
+	}
+
+	return nil
+}
+
+// customClaims decodes the raw payload, so the check works for any claims
+// type and does not depend on zero values.
+func (v *claimsValidator) customClaims(token *jwt.Token) (map[string]json.RawMessage, error) {
+	parts := strings.Split(token.Raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidClaims
+	}
+
+	b, err := jwt.NewParser().DecodeSegment(parts[1])
+	if err != nil {
+		return nil, ErrInvalidClaims
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(b, &payload); err != nil {
+		return nil, ErrInvalidClaims
+	}
+
+	if v.customKey == "" {
+		return payload, nil
+	}
+
+	var custom map[string]json.RawMessage
+	if raw, ok := payload[v.customKey]; ok {
+		if err := json.Unmarshal(raw, &custom); err != nil {
+			return nil, fmt.Errorf("%w: %s is not an object", ErrInvalidClaims, v.customKey)
+		}
+	}
+
+	return custom, nil
+}
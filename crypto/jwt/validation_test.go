@@ -0,0 +1,173 @@
+package jwt
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/ooqls/getset/crypto/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newValidationConfig() *TokenConfiguration {
+	return &TokenConfiguration{
+		Audience:                []string{"aud"},
+		Issuer:                  "issuer",
+		ValidityDurationSeconds: 60,
+	}
+}
+
+func TestDecrypt_RequiredClaims(t *testing.T) {
+	testutils.InitKeys()
+	cfg := newValidationConfig()
+	cfg.RequiredClaims = []string{"tenant"}
+	issuer := NewJwtTokenIssuer[map[string]string](cfg, keys.JWT())
+
+	tokenStr, _, err := issuer.IssueToken("123", map[string]string{"tenant": "acme"})
+	assert.Nil(t, err)
+	_, _, err = issuer.Decrypt(tokenStr)
+	assert.Nilf(t, err, "should accept tokens with the required claim")
+
+	tokenStr, _, err = issuer.IssueToken("123", map[string]string{"role": "admin"})
+	assert.Nil(t, err)
+	token, _, err := issuer.Decrypt(tokenStr)
+	assert.ErrorIs(t, err, ErrMissingClaim)
+	assert.False(t, token.Valid)
+}
+
+func TestDecrypt_AllowedSubjects(t *testing.T) {
+	testutils.InitKeys()
+	cfg := newValidationConfig()
+	cfg.AllowedSubjects = `^user-[0-9]+$`
+	issuer := NewJwtTokenIssuer[string](cfg, keys.JWT())
+
+	tokenStr, _, err := issuer.IssueToken("user-1", "")
+	assert.Nil(t, err)
+	_, _, err = issuer.Decrypt(tokenStr)
+	assert.Nil(t, err)
+
+	tokenStr, _, err = issuer.IssueToken("service-1", "")
+	assert.Nil(t, err)
+	_, _, err = issuer.Decrypt(tokenStr)
+	assert.ErrorIs(t, err, ErrInvalidSubject)
+}
+
+func TestDecrypt_AllowedSubjectsMatchWholeSubject(t *testing.T) {
+	testutils.InitKeys()
+	cfg := newValidationConfig()
+	cfg.AllowedSubjects = `user-1|admin`
+	issuer := NewJwtTokenIssuer[string](cfg, keys.JWT())
+
+	for _, sub := range []string{"user-1", "admin"} {
+		tokenStr, _, err := issuer.IssueToken(sub, "")
+		assert.Nil(t, err)
+		_, _, err = issuer.Decrypt(tokenStr)
+		assert.Nilf(t, err, "%s should be allowed", sub)
+	}
+
+	for _, sub := range []string{"evil-user-10", "user-10", "evil-user-1", "admins"} {
+		tokenStr, _, err := issuer.IssueToken(sub, "")
+		assert.Nil(t, err)
+		_, _, err = issuer.Decrypt(tokenStr)
+		assert.ErrorIsf(t, err, ErrInvalidSubject, "%s should not be allowed", sub)
+	}
+}
+
+func TestDecrypt_NotBeforeAndLeeway(t *testing.T) {
+	testutils.InitKeys()
+	cfg := newValidationConfig()
+	cfg.NotBeforeOffsetSeconds = 30
+	issuer := NewJwtTokenIssuer[string](cfg, keys.JWT())
+
+	tokenStr, token, err := issuer.IssueToken("123", "")
+	assert.Nil(t, err)
+	nbf, err := token.Claims.GetNotBefore()
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now().Add(30*time.Second), nbf.Time, 2*time.Second)
+
+	_, _, err = issuer.Decrypt(tokenStr)
+	assert.ErrorIs(t, err, jwt.ErrTokenNotValidYet)
+
+	lenient := *cfg
+	lenient.LeewaySeconds = 60
+	_, _, err = NewJwtTokenIssuer[string](&lenient, keys.JWT()).Decrypt(tokenStr)
+	assert.Nilf(t, err, "leeway should cover the not before offset")
+}
+
+func TestDecrypt_MaxAge(t *testing.T) {
+	testutils.InitKeys()
+	cfg := newValidationConfig()
+	cfg.MaxAgeSeconds = 60
+	issuer := NewJwtTokenIssuer[string](cfg, keys.JWT())
+
+	tokenStr, _, err := issuer.IssueToken("123", "")
+	assert.Nil(t, err)
+	_, _, err = issuer.Decrypt(tokenStr)
+	assert.Nil(t, err)
+
+	old := ClaimsWrapper[string]{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    cfg.Issuer,
+		Subject:   "123",
+		Audience:  cfg.Audience,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		IssuedAt:  jwt.NewNumericDate(time.Now().Add(-2 * time.Minute)),
+	}}
+	tokenStr, _, err = keys.JWT().Sign(old)
+	assert.Nil(t, err)
+	_, _, err = issuer.Decrypt(tokenStr)
+	assert.ErrorIs(t, err, ErrTokenTooOld)
+}
+
+func TestDecrypt_ValidationHook(t *testing.T) {
+	testutils.InitKeys()
+	errBanned := errors.New("banned")
+	issuer := NewJwtTokenIssuer[map[string]string](newValidationConfig(), keys.JWT(),
+		WithValidationHook(func(token *jwt.Token) error {
+			claims := token.Claims.(*ClaimsWrapper[map[string]string])
+			if claims.CustomClaims["role"] == "banned" {
+				return errBanned
+			}
+			return nil
+		}))
+
+	tokenStr, _, err := issuer.IssueToken("123", map[string]string{"role": "admin"})
+	assert.Nil(t, err)
+	_, _, err = issuer.Decrypt(tokenStr)
+	assert.Nil(t, err)
+
+	tokenStr, _, err = issuer.IssueToken("123", map[string]string{"role": "banned"})
+	assert.Nil(t, err)
+	_, _, err = issuer.Decrypt(tokenStr)
+	assert.ErrorIs(t, err, errBanned)
+}
+
+func TestParseTokenConfigFile_Validation(t *testing.T) {
+	f, err := os.CreateTemp("", "token-*.yaml")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`
+audience: ["aud"]
+issuer: issuer
+validity_duration_seconds: 60
+leeway_seconds: 5
+not_before_offset_seconds: -5
+max_age_seconds: 3600
+required_claims: ["tenant"]
+allowed_subjects: "^user-"
+`)
+	assert.Nil(t, err)
+
+	cfg, err := ParseTokenConfigFile(f.Name())
+	assert.Nilf(t, err, "should be able to parse the config")
+	assert.Equal(t, 5.0, cfg.LeewaySeconds)
+	assert.Equal(t, -5.0, cfg.NotBeforeOffsetSeconds)
+	assert.Equal(t, 3600.0, cfg.MaxAgeSeconds)
+	assert.Equal(t, []string{"tenant"}, cfg.RequiredClaims)
+	assert.Equal(t, "^user-", cfg.AllowedSubjects)
+
+	assert.NotNil(t, (&TokenConfiguration{AllowedSubjects: "("}).Validate())
+}
@@ -0,0 +1,219 @@
+package keydb
+
+import (
+	"context"
+	"crypto"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ooqls/getset/crypto/keys"
+)
+
+// KeyPairInfo describes a stored key pair without decrypting its private
+// key.
+type KeyPairInfo struct {
+	HashedPw  string
+	PublicKey []byte
+}
+
+func (c *SQLCryptoDatabase) ListKeyPairs() ([]KeyPairInfo, error) {
+	rows, err := c.db.Query("SELECT hashed_pw, public_key FROM key_pairs ORDER BY hashed_pw")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list key pairs: %v", err)
+	}
+	defer rows.Close()
+
+	var infos []KeyPairInfo
+	for rows.Next() {
+		var info KeyPairInfo
+		if err := rows.Scan(&info.HashedPw, &info.PublicKey); err != nil {
+			return nil, fmt.Errorf("failed to scan key pair: %v", err)
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, rows.Err()
+}
+
+// RotateSystemKey re-encrypts every private key and secret under the new
+// system key in a single transaction. The database uses the new key
+// afterwards, the old one can no longer open it.
+func (c *SQLCryptoDatabase) RotateSystemKey(ctx context.Context, newSystemKey keys.X509) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := c.lockSystemKey(ctx, tx, true); err != nil {
+		return err
+	}
+
+	for _, table := range []struct{ name, id, value string }{
+		{"key_pairs", "hashed_pw", "private_key"},
+		{"secrets", "name", "value"},
+	} {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT %s, %s FROM %s", table.id, table.value, table.name))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", table.name, err)
+		}
+
+		type row struct {
+			id                 string
+			encrypted, rotated []byte
+		}
+		var rotated []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.encrypted); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan %s: %v", table.name, err)
+			}
+
+			decrypted, err := c.decrypt(r.encrypted)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to decrypt %s %s: %v", table.name, r.id, err)
+			}
+
+			r.rotated, err = envelope(&newSystemKey).Encrypt(decrypted)
+			keys.Zero(decrypted)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to encrypt %s %s: %v", table.name, r.id, err)
+			}
+
+			rotated = append(rotated, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read %s: %v", table.name, err)
+		}
+
+		// key pair ids are not unique, the old ciphertext identifies the row
+		update := c.q(fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ? AND %s = ?", table.name, table.value, table.id, table.value))
+		for _, r := range rotated {
+			if _, err := tx.ExecContext(ctx, update, r.rotated, r.id, r.encrypted); err != nil {
+				return fmt.Errorf("failed to update %s %s: %v", table.name, r.id, err)
+			}
+		}
+	}
+
+	_, pubKeyB := newSystemKey.PublicKey()
+	if _, err := tx.ExecContext(ctx, c.q("UPDATE system_meta SET public_key = ?"), pubKeyB); err != nil {
+		return fmt.Errorf("failed to update system key: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rotation: %v", err)
+	}
+
+	c.systemKey = newSystemKey
+	return nil
+}
+
+// Verify checks that the system key matches the database, that every
+// private key and secret decrypts and that PEM private keys belong to their
+// public keys. All problems found are returned joined.
+func (c *SQLCryptoDatabase) Verify(ctx context.Context) error {
+	ok, err := c.IsSystemKey(&c.systemKey)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrIncorrectSystemKey
+	}
+
+	var errs []error
+	rows, err := c.db.QueryContext(ctx, "SELECT hashed_pw, private_key, public_key FROM key_pairs")
+	if err != nil {
+		return fmt.Errorf("failed to read key pairs: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var encrypted, pub []byte
+		if err := rows.Scan(&id, &encrypted, &pub); err != nil {
+			return fmt.Errorf("failed to scan key pair: %v", err)
+		}
+
+		priv, err := c.decrypt(encrypted)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("key pair %s: failed to decrypt private key: %v", id, err))
+			continue
+		}
+
+		if err := verifyKeyPair(priv, pub); err != nil {
+			errs = append(errs, fmt.Errorf("key pair %s: %w", id, err))
+		}
+		keys.Zero(priv)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read key pairs: %v", err)
+	}
+
+	secrets, err := c.db.QueryContext(ctx, "SELECT name, value FROM secrets")
+	if err != nil {
+		return fmt.Errorf("failed to read secrets: %v", err)
+	}
+	defer secrets.Close()
+
+	for secrets.Next() {
+		var name string
+		var encrypted []byte
+		if err := secrets.Scan(&name, &encrypted); err != nil {
+			return fmt.Errorf("failed to scan secret: %v", err)
+		}
+
+		value, err := c.decrypt(encrypted)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("secret %s: failed to decrypt: %v", name, err))
+			continue
+		}
+		keys.Zero(value)
+	}
+	if err := secrets.Err(); err != nil {
+		return fmt.Errorf("failed to read secrets: %v", err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// verifyKeyPair checks that a PEM private key matches the public key. Key
+// pairs that are not PEM encoded can only be checked for decryption.
+func verifyKeyPair(priv, pub []byte) error {
+	signer, err := keys.ParsePrivateKeyPem(priv)
+	if err != nil {
+		return nil
+	}
+
+	pubKey, err := keys.ParsePublicKeyPem(pub)
+	if err != nil {
+		return fmt.Errorf("failed to parse public key: %v", err)
+	}
+
+	k, ok := signer.Public().(interface{ Equal(x crypto.PublicKey) bool })
+	if ok && !k.Equal(pubKey) {
+		return ErrKeyPairMismatch
+	}
+
+	return nil
+}
+
+// GetPublicKey returns the public key of a key pair without decrypting the
+// private key.
+func (c *SQLCryptoDatabase) GetPublicKey(hashpw string) ([]byte, error) {
+	var publicKey []byte
+	err := c.db.QueryRow(c.q("SELECT public_key FROM key_pairs WHERE hashed_pw = ?"), hashpw).Scan(&publicKey)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrKeyPairNotFound, hashpw)
+		}
+
+		return nil, fmt.Errorf("failed to get public key: %v", err)
+	}
+
+	return publicKey, nil
+}
@@ -0,0 +1,34 @@
+package keydb_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/ooqls/getset/crypto/keydb"
+	"github.com/ooqls/getset/crypto/keydb/keydbtest"
+	"github.com/ooqls/getset/crypto/keys"
+)
+
+func TestConformance_SQLite(t *testing.T) {
+	keydbtest.Run(t, func(t *testing.T) keydbtest.OpenFunc {
+		// immediate transactions make concurrent writers wait for the lock
+		// instead of failing to upgrade a read lock
+		dsn := "file:" + t.TempDir() + "/keys.db?_txlock=immediate&_busy_timeout=5000"
+
+		return func(ctx context.Context, systemKey keys.X509) (*keydb.SQLCryptoDatabase, error) {
+			db, err := sql.Open("sqlite3", dsn)
+			if err != nil {
+				return nil, err
+			}
+
+			cdb, err := keydb.Open(ctx, db, systemKey)
+			if err != nil {
+				db.Close()
+				return nil, err
+			}
+
+			return cdb, nil
+		}
+	})
+}
@@ -1,53 +1,165 @@
 package keydb
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/ooqls/getset/crypto/crypto"
 	"github.com/ooqls/getset/crypto/keys"
+	"github.com/ooqls/getset/log"
+	"go.uber.org/zap"
 )
 
+var l *zap.Logger = log.NewLogger("keydb")
+
 type CryptoDatabase interface {
 	GetKeyPair(hashpw string) ([]byte, []byte, error)
 	InsertKeyPair(hashedpw string, privateKey, publicKey []byte) error
 	SetSystemKey(systemKey keys.Key) error
 	GetSystemKey() keys.Key
 	IsSystemKey(key keys.Key) (bool, error)
+	PutSecret(name string, value []byte) error
+	GetSecret(name string) ([]byte, error)
+	DeleteSecret(name string) error
+	AddKey(ctx context.Context, k NewKey) (*KeyRecord, error)
+	Find(ctx context.Context, queries ...Query) ([]KeyRecord, error)
+	ListByType(ctx context.Context, t KeyType) ([]KeyRecord, error)
+	Revoke(ctx context.Context, keyId string) error
+	GetPrivateKey(ctx context.Context, keyId string) ([]byte, error)
 }
 
 type SQLCryptoDatabase struct {
 	db        *sql.DB
+	dialect   *Dialect
 	systemKey keys.X509
+	// borrowed databases belong to a shared pool and are left open by Close
+	borrowed bool
 }
 
-func New(db *sql.DB, systemKey keys.X509) *SQLCryptoDatabase {
+func New(db *sql.DB, systemKey keys.X509, opts ...databaseOption) *SQLCryptoDatabase {
+	o := databaseOptions{dialect: SQLite}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	return &SQLCryptoDatabase{
 		db:        db,
+		dialect:   o.dialect,
 		systemKey: systemKey,
 	}
 }
 
-func LoadExisting(path string, key keys.X509) (*SQLCryptoDatabase, error) {
+// Open creates the tables if they do not exist yet and stores the public key
+// of the system key on first use, or checks it against the stored one
+// otherwise. Replicas sharing a Postgres database may open it concurrently.
+func Open(ctx context.Context, db *sql.DB, systemKey keys.X509, opts ...databaseOption) (*SQLCryptoDatabase, error) {
+	cdb := New(db, systemKey, opts...)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if cdb.dialect.initLock != "" {
+		if _, err := tx.ExecContext(ctx, cdb.dialect.initLock); err != nil {
+			return nil, fmt.Errorf("failed to lock database: %v", err)
+		}
+	}
+
+	if err := cdb.createTables(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	_, pubKeyB := systemKey.PublicKey()
+	var existingPublicKey []byte
+	err = tx.QueryRowContext(ctx, "SELECT public_key FROM system_meta").Scan(&existingPublicKey)
+	switch {
+	case err == sql.ErrNoRows:
+		if _, err := tx.ExecContext(ctx, cdb.q("INSERT INTO system_meta (public_key) VALUES (?)"), pubKeyB); err != nil {
+			return nil, fmt.Errorf("failed to set system key: %v", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to get cert signature: %v", err)
+	case !bytes.Equal(existingPublicKey, pubKeyB):
+		return nil, ErrIncorrectSystemKey
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit: %v", err)
+	}
+
+	if err := cdb.detectKeyTypes(ctx); err != nil {
+		return nil, err
+	}
+
+	return cdb, nil
+}
+
+// Create creates the tables of a new key database at path and stores the
+// public key of the system key. It fails if the database was already
+// initialized.
+func Create(path string, systemKey keys.X509) (*SQLCryptoDatabase, error) {
 	db, err := sql.Open("sqlite3", path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %v", err)
 	}
 
-	cdb := &SQLCryptoDatabase{
-		db:        db,
-		systemKey: key,
+	cdb := New(db, systemKey)
+	if err := cdb.CreateTable(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create tables: %v", err)
+	}
+
+	if _, err := cdb.IsSystemKey(&systemKey); err != ErrDBNotInitialized {
+		db.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrDBAlreadyInitialized
+	}
+
+	if err := cdb.SetSystemKey(&systemKey); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to set system key: %v", err)
 	}
 
+	return cdb, nil
+}
+
+func LoadExisting(path string, key keys.X509) (*SQLCryptoDatabase, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+
+	cdb := New(db, key)
+
 	isSystemK, err := cdb.IsSystemKey(&key)
 	if err != nil {
+		db.Close()
 		return nil, fmt.Errorf("the given key is not the correct system key: %v", err)
 	}
 
 	if !isSystemK {
+		db.Close()
 		return nil, ErrIncorrectSystemKey
 	}
 
+	// databases created before secrets were supported lack the table
+	if err := cdb.CreateTable(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to create tables: %v", err)
+	}
+
+	if err := cdb.detectKeyTypes(context.Background()); err != nil {
+		return nil, err
+	}
+
 	return cdb, nil
 }
 
@@ -59,7 +171,7 @@ func (c *SQLCryptoDatabase) SetSystemKey(systemKey keys.Key) error {
 		return fmt.Errorf("failed to get existing cert signature: %v", row.Err())
 	}
 
-	_, err := c.db.Exec("INSERT INTO system_meta (public_key) VALUES (?)", pubKeyB)
+	_, err := c.db.Exec(c.q("INSERT INTO system_meta (public_key) VALUES (?)"), pubKeyB)
 	return err
 }
 
@@ -67,47 +179,77 @@ func (c *SQLCryptoDatabase) GetSystemKey() keys.Key {
 	return &c.systemKey
 }
 
-func (c *SQLCryptoDatabase) createTable(ctx context.Context) error {
-	tx, err := c.db.Begin()
+// CreateTable creates the key database tables if they do not exist yet.
+func (c *SQLCryptoDatabase) CreateTable(ctx context.Context) error {
+	tx, err := c.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %v", err)
 	}
+	defer tx.Rollback()
+
+	if err := c.createTables(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
 
-	_, err = tx.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS key_pairs (hashed_pw varchar(128), private_key BLOB, public_key BLOB)")
+func (c *SQLCryptoDatabase) createTables(ctx context.Context, tx *sql.Tx) error {
+	blob := c.dialect.blob
+	_, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS key_pairs (hashed_pw varchar(128), private_key %s, public_key %s)", blob, blob))
 	if err != nil {
 		return fmt.Errorf("failed to create key_pairs table: %v", err)
 	}
 
-	_, err = tx.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS system_meta (public_key BLOB)")
+	if err := c.migrateKeyPairs(ctx, tx); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS system_meta (public_key %s)", blob))
 	if err != nil {
 		return fmt.Errorf("failed to create system_meta table: %v", err)
 	}
 
-	return tx.Commit()
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS secrets (name varchar(255) PRIMARY KEY, value %s)", blob))
+	if err != nil {
+		return fmt.Errorf("failed to create secrets table: %v", err)
+	}
+
+	return nil
 }
 
+// GetKeyPair returns the oldest key pair stored under the hash that is
+// neither revoked nor expired.
 func (c *SQLCryptoDatabase) GetKeyPair(hashpw string) ([]byte, []byte, error) {
-	var hashedPw, encPrivateKey, publicKey []byte
-	err := c.db.QueryRow("SELECT hashed_pw, private_key, public_key FROM key_pairs WHERE hashed_pw == ?", hashpw).Scan(&hashedPw, &encPrivateKey, &publicKey)
+	var keyId string
+	var encPrivateKey, publicKey []byte
+	err := c.db.QueryRow(c.q("SELECT key_id, private_key, public_key FROM key_pairs WHERE hashed_pw = ? AND revoked_at = 0 AND (expires_at = 0 OR expires_at > ?) ORDER BY created_at, key_id"),
+		hashpw, time.Now().Unix()).Scan(&keyId, &encPrivateKey, &publicKey)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, fmt.Errorf("failed to get key pair: %w", ErrKeyPairNotFound)
+		}
+
 		return nil, nil, fmt.Errorf("failed to get key pair: %v", err)
 	}
 
-	decPrivateKey, err := c.systemKey.Decrypt(encPrivateKey)
+	decPrivateKey, err := c.decrypt(encPrivateKey)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to decrypt private key: %v", err)
 	}
 
+	c.recordUse(context.Background(), "key_id = ?", keyId)
 	return decPrivateKey, publicKey, err
 }
 
+// InsertKeyPair stores a key pair with a generated id and detected type,
+// see AddKey to set metadata.
 func (c *SQLCryptoDatabase) InsertKeyPair(hashedpw string, privateKey, publicKey []byte) error {
-	encPrivKey, err := c.systemKey.Encrypt(privateKey)
-	if err != nil {
-		return fmt.Errorf("failed to encrypt private key: %v", err)
-	}
-
-	_, err = c.db.Exec("INSERT INTO key_pairs (hashed_pw, private_key, public_key) VALUES (?, ?, ?)", hashedpw, encPrivKey, publicKey)
+	_, err := c.AddKey(context.Background(), NewKey{
+		HashedPw:   hashedpw,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+	})
 	return err
 }
 
@@ -123,13 +265,77 @@ func (c *SQLCryptoDatabase) IsSystemKey(key keys.Key) (bool, error) {
 	}
 
 	_, pubKeyB := key.PublicKey()
-	if string(existingPublicKey) != string(pubKeyB) {
-		return false, nil
+	return bytes.Equal(existingPublicKey, pubKeyB), nil
+}
+
+// lockSystemKey locks the system key row for the rest of the transaction,
+// exclusively for rotations and shared for writes of encrypted values. It
+// fails if another replica rotated the system key since this one loaded it,
+// so no value is written under a retired key.
+func (c *SQLCryptoDatabase) lockSystemKey(ctx context.Context, tx *sql.Tx, exclusive bool) error {
+	lock := c.dialect.shareLock
+	if exclusive {
+		lock = c.dialect.updateLock
 	}
 
-	return true, nil
+	var existingPublicKey []byte
+	err := tx.QueryRowContext(ctx, "SELECT public_key FROM system_meta"+lock).Scan(&existingPublicKey)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrDBNotInitialized
+		}
+
+		return fmt.Errorf("failed to lock system key: %v", err)
+	}
+
+	_, pubKeyB := c.systemKey.PublicKey()
+	if !bytes.Equal(existingPublicKey, pubKeyB) {
+		return ErrIncorrectSystemKey
+	}
+
+	return nil
+}
+
+// q rebinds the ? placeholders of query for the dialect.
+func (c *SQLCryptoDatabase) q(query string) string {
+	return c.dialect.rebind(query)
 }
 
 func (c *SQLCryptoDatabase) SystemKey() keys.Key {
 	return &c.systemKey
 }
+
+func (c *SQLCryptoDatabase) Close() error {
+	if c.borrowed {
+		return nil
+	}
+
+	return c.db.Close()
+}
+
+// envelope encrypts with a fresh data key wrapped by the system key, so the
+// size of private keys and secrets is not limited by the RSA key size.
+func envelope(systemKey *keys.X509) *crypto.EnvelopeAlgorithm {
+	return crypto.NewEnvelopeAlgorithm(crypto.NewKeyEncryptionKeys(
+		crypto.NewRSAKeyEncryptionKey("system", 1, systemKey),
+	))
+}
+
+func (c *SQLCryptoDatabase) encrypt(data []byte) ([]byte, error) {
+	return envelope(&c.systemKey).Encrypt(data)
+}
+
+// decrypt also reads values encrypted directly with the system key, as done
+// before envelope encryption was used.
+func (c *SQLCryptoDatabase) decrypt(data []byte) ([]byte, error) {
+	return decryptWith(&c.systemKey, data)
+}
+
+func decryptWith(systemKey *keys.X509, data []byte) ([]byte, error) {
+	decrypted, err := envelope(systemKey).Decrypt(data)
+	if errors.Is(err, crypto.ErrNotEnvelope) {
+		return systemKey.Decrypt(data)
+	}
+
+	return decrypted, err
+}
@@ -1,10 +1,14 @@
 package keydb
 
 import (
+	"context"
+	"database/sql"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ooqls/getset/crypto/keys"
+	"github.com/ooqls/getset/registry"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -51,3 +55,231 @@ func TestCryptoDatabase_InsertKeyPair(t *testing.T) {
 	assert.Nilf(t, err, "should not fail to get key pair")
 	assert.Equalf(t, []byte("privateKey"), privateKey, "should be able to get private key")
 }
+
+func TestCryptoDatabase_Secrets(t *testing.T) {
+	initDb(t)
+	db := GetCryptoDB()
+
+	value := make([]byte, 4096)
+	for i := range value {
+		value[i] = byte(i)
+	}
+
+	assert.Nilf(t, db.PutSecret("large", value), "should be able to store secrets larger than the system key")
+	stored, err := db.GetSecret("large")
+	assert.Nil(t, err)
+	assert.Equal(t, value, stored)
+
+	assert.Nil(t, db.PutSecret("postgres", []byte("first")))
+	assert.Nilf(t, db.PutSecret("postgres", []byte("second")), "should be able to overwrite a secret")
+
+	secret, err := registry.ResolveSecretRef(context.Background(), "keydb:postgres")
+	assert.Nilf(t, err, "should resolve keydb secret refs once initialized")
+	assert.Equal(t, "second", secret.Reveal())
+
+	assert.Nil(t, db.DeleteSecret("postgres"))
+	_, err = db.GetSecret("postgres")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+}
+
+func newSystemKey(t *testing.T) keys.X509 {
+	ca, err := keys.CreateX509CA()
+	assert.Nilf(t, err, "should not fail to create CA")
+
+	systemK, err := keys.CreateX509(*ca)
+	assert.Nilf(t, err, "should not fail to create x509")
+
+	return *systemK
+}
+
+func TestCryptoDatabase_Admin(t *testing.T) {
+	path := t.TempDir() + "/keys.db"
+	systemKey := newSystemKey(t)
+
+	db, err := Create(path, systemKey)
+	assert.Nilf(t, err, "should not fail to create db")
+
+	_, err = Create(path, systemKey)
+	assert.ErrorIsf(t, err, ErrDBAlreadyInitialized, "should not initialize a db twice")
+
+	rsaPriv, rsaPub, err := keys.NewRsaKeyPemBytes()
+	assert.Nil(t, err)
+	edPriv, edPub, err := keys.NewEd25519KeyPemBytes()
+	assert.Nil(t, err)
+
+	assert.Nilf(t, db.InsertKeyPair("rsa", rsaPriv, rsaPub), "should be able to store PEM private keys")
+	assert.Nil(t, db.InsertKeyPair("ed25519", edPriv, edPub))
+	assert.Nil(t, db.PutSecret("postgres", []byte("secret")))
+
+	// rows written before envelope encryption stay readable
+	legacy, err := systemKey.Encrypt([]byte("legacy"))
+	assert.Nil(t, err)
+	_, err = db.db.Exec("INSERT INTO key_pairs (hashed_pw, private_key, public_key) VALUES (?, ?, ?)", "legacy", legacy, []byte("pub"))
+	assert.Nil(t, err)
+
+	infos, err := db.ListKeyPairs()
+	assert.Nil(t, err)
+	assert.Equal(t, []KeyPairInfo{
+		{HashedPw: "ed25519", PublicKey: edPub},
+		{HashedPw: "legacy", PublicKey: []byte("pub")},
+		{HashedPw: "rsa", PublicKey: rsaPub},
+	}, infos)
+
+	pub, err := db.GetPublicKey("rsa")
+	assert.Nil(t, err)
+	assert.Equal(t, rsaPub, pub)
+	_, err = db.GetPublicKey("missing")
+	assert.ErrorIs(t, err, ErrKeyPairNotFound)
+
+	assert.Nilf(t, db.Verify(context.Background()), "should verify a consistent db")
+
+	newKey := newSystemKey(t)
+	assert.Nilf(t, db.RotateSystemKey(context.Background(), newKey), "should be able to rotate the system key")
+	assert.Nil(t, db.Close())
+
+	_, err = LoadExisting(path, systemKey)
+	assert.ErrorIsf(t, err, ErrIncorrectSystemKey, "the old system key should no longer open the db")
+
+	db, err = LoadExisting(path, newKey)
+	assert.Nilf(t, err, "the new system key should open the db")
+	defer db.Close()
+	assert.Nil(t, db.Verify(context.Background()))
+
+	for id, expected := range map[string][]byte{"rsa": rsaPriv, "ed25519": edPriv, "legacy": []byte("legacy")} {
+		priv, _, err := db.GetKeyPair(id)
+		assert.Nilf(t, err, "should decrypt %s under the new system key", id)
+		assert.Equal(t, expected, priv)
+	}
+
+	secret, err := db.GetSecret("postgres")
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", string(secret))
+
+	assert.Nil(t, db.InsertKeyPair("mismatch", rsaPriv, edPub))
+	assert.ErrorIsf(t, db.Verify(context.Background()), ErrKeyPairMismatch, "should detect mismatching key pairs")
+}
+
+func TestCryptoDatabase_Find(t *testing.T) {
+	db, err := Create(t.TempDir()+"/keys.db", newSystemKey(t))
+	assert.Nil(t, err)
+	defer db.Close()
+	ctx := context.Background()
+
+	rsaPriv, rsaPub, err := keys.NewRsaKeyPemBytes()
+	assert.Nil(t, err)
+	ecPriv, ecPub, err := keys.NewECKeyPemBytes("P-256")
+	assert.Nil(t, err)
+	aesKey := make([]byte, 32)
+
+	rsaKey, err := db.AddKey(ctx, NewKey{HashedPw: "pw", PrivateKey: rsaPriv, PublicKey: rsaPub, Labels: map[string]string{"env": "prod"}})
+	assert.Nil(t, err)
+	assert.Equalf(t, KeyTypeRSA, rsaKey.Type, "should detect the key type")
+	assert.NotEmptyf(t, rsaKey.Id, "should generate an id")
+
+	ecKey, err := db.AddKey(ctx, NewKey{Id: "ec-1", PrivateKey: ecPriv, PublicKey: ecPub, Labels: map[string]string{"env": "dev"}})
+	assert.Nil(t, err)
+	assert.Equal(t, KeyTypeEC, ecKey.Type)
+
+	_, err = db.AddKey(ctx, NewKey{Id: "aes-1", PrivateKey: aesKey, ExpiresAt: time.Now().Add(-time.Minute)})
+	assert.Nil(t, err)
+
+	_, err = db.AddKey(ctx, NewKey{Id: "ec-1", PrivateKey: ecPriv})
+	assert.NotNilf(t, err, "key ids should be unique")
+
+	find := func(queries ...Query) []string {
+		records, err := db.Find(ctx, queries...)
+		assert.Nil(t, err)
+
+		var ids []string
+		for _, r := range records {
+			ids = append(ids, r.Id)
+		}
+		return ids
+	}
+
+	assert.ElementsMatch(t, []string{rsaKey.Id, "ec-1", "aes-1"}, find())
+	assert.Equal(t, []string{rsaKey.Id}, find(WithPasswordHash("pw")))
+	assert.Equal(t, []string{"ec-1"}, find(WithKeyType(string(KeyTypeEC))))
+	assert.Equal(t, []string{"ec-1"}, find(WithKeyId("ec-1")))
+	assert.Equal(t, []string{rsaKey.Id}, find(WithLabel("env", "prod")))
+	assert.Empty(t, find(WithLabel("env", "prod"), WithKeyType(string(KeyTypeEC))))
+	assert.Equal(t, []string{"aes-1"}, find(WithExpired(true)))
+	assert.ElementsMatch(t, []string{rsaKey.Id, "ec-1"}, find(WithExpired(false)))
+
+	aesKeys, err := db.ListByType(ctx, KeyTypeAES)
+	assert.Nil(t, err)
+	assert.Len(t, aesKeys, 1)
+
+	_, err = db.Find(ctx, Query{key: "unknown"})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+
+	priv, err := db.GetPrivateKey(ctx, "ec-1")
+	assert.Nil(t, err)
+	assert.Equal(t, ecPriv, priv)
+	_, _, err = db.GetKeyPair("pw")
+	assert.Nil(t, err)
+
+	records, err := db.Find(ctx, WithKeyId("ec-1"))
+	assert.Nil(t, err)
+	assert.Equalf(t, int64(1), records[0].UseCount, "should count uses")
+	assert.False(t, records[0].LastUsedAt.IsZero())
+
+	_, err = db.GetPrivateKey(ctx, "aes-1")
+	assert.ErrorIs(t, err, ErrKeyExpired)
+
+	assert.Nil(t, db.Revoke(ctx, "ec-1"))
+	assert.Nilf(t, db.Revoke(ctx, "ec-1"), "revoking twice should not fail")
+	assert.ErrorIs(t, db.Revoke(ctx, "missing"), ErrKeyPairNotFound)
+	assert.Equal(t, []string{"ec-1"}, find(WithRevoked(true)))
+	assert.NotContains(t, find(WithRevoked(false)), "ec-1")
+
+	_, err = db.GetPrivateKey(ctx, "ec-1")
+	assert.ErrorIs(t, err, ErrKeyRevoked)
+
+	assert.Nil(t, db.Revoke(ctx, rsaKey.Id))
+	_, _, err = db.GetKeyPair("pw")
+	assert.ErrorIsf(t, err, ErrKeyPairNotFound, "revoked key pairs should not be returned")
+}
+
+func TestCryptoDatabase_Migration(t *testing.T) {
+	path := t.TempDir() + "/keys.db"
+	systemKey := newSystemKey(t)
+
+	// a database created before keys had metadata
+	sqlDb, err := sql.Open("sqlite3", path)
+	assert.Nil(t, err)
+	_, err = sqlDb.Exec("CREATE TABLE key_pairs (hashed_pw varchar(128), private_key BLOB, public_key BLOB)")
+	assert.Nil(t, err)
+	_, err = sqlDb.Exec("CREATE TABLE system_meta (public_key BLOB)")
+	assert.Nil(t, err)
+	_, pub := systemKey.PublicKey()
+	_, err = sqlDb.Exec("INSERT INTO system_meta (public_key) VALUES (?)", pub)
+	assert.Nil(t, err)
+	encrypted, err := systemKey.Encrypt([]byte("old"))
+	assert.Nil(t, err)
+	_, err = sqlDb.Exec("INSERT INTO key_pairs (hashed_pw, private_key, public_key) VALUES (?, ?, ?)", "old", encrypted, []byte("pub"))
+	assert.Nil(t, err)
+	aesKey, err := systemKey.Encrypt(make([]byte, 16))
+	assert.Nil(t, err)
+	_, err = sqlDb.Exec("INSERT INTO key_pairs (hashed_pw, private_key, public_key) VALUES (?, ?, ?)", "aes", aesKey, []byte{})
+	assert.Nil(t, err)
+	assert.Nil(t, sqlDb.Close())
+
+	db, err := LoadExisting(path, systemKey)
+	assert.Nilf(t, err, "should migrate an old database")
+	defer db.Close()
+
+	records, err := db.Find(context.Background(), WithPasswordHash("old"))
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+	assert.NotEmptyf(t, records[0].Id, "old keys should get an id")
+	assert.False(t, records[0].CreatedAt.IsZero())
+
+	priv, err := db.GetPrivateKey(context.Background(), records[0].Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "old", string(priv))
+
+	aesKeys, err := db.ListByType(context.Background(), KeyTypeAES)
+	assert.Nil(t, err)
+	assert.Lenf(t, aesKeys, 1, "should detect the type of old keys")
+}
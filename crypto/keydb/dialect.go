@@ -0,0 +1,65 @@
+package keydb
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect holds the SQL that differs between the databases a key database
+// can be stored in. Queries are written with ? placeholders and rebound to
+// the dialect's bind type.
+type Dialect struct {
+	name     string
+	bindType int
+	blob     string
+	// columns lists the column names of the key_pairs table
+	columns string
+	// randomId generates ids for keys stored before ids existed
+	randomId string
+	// shareLock and updateLock are appended to selects of the system key row
+	shareLock  string
+	updateLock string
+	// initLock serializes table creation and initialization of replicas
+	// sharing a database
+	initLock string
+}
+
+var (
+	SQLite = &Dialect{
+		name:     "sqlite",
+		bindType: sqlx.QUESTION,
+		blob:     "BLOB",
+		columns:  "SELECT name FROM pragma_table_info('key_pairs')",
+		randomId: "lower(hex(randomblob(16)))",
+	}
+	Postgres = &Dialect{
+		name:       "postgres",
+		bindType:   sqlx.DOLLAR,
+		blob:       "BYTEA",
+		columns:    "SELECT column_name FROM information_schema.columns WHERE table_name = 'key_pairs' AND table_schema = current_schema()",
+		randomId:   "md5(random()::text || clock_timestamp()::text)",
+		shareLock:  " FOR SHARE",
+		updateLock: " FOR UPDATE",
+		initLock:   "SELECT pg_advisory_xact_lock(hashtext('keydb'))",
+	}
+)
+
+func (d *Dialect) String() string {
+	return d.name
+}
+
+func (d *Dialect) rebind(query string) string {
+	return sqlx.Rebind(d.bindType, query)
+}
+
+type databaseOptions struct {
+	dialect *Dialect
+}
+
+type databaseOption func(*databaseOptions)
+
+// WithDialect sets the SQL dialect of the database, SQLite by default.
+func WithDialect(d *Dialect) databaseOption {
+	return func(o *databaseOptions) {
+		o.dialect = d
+	}
+}
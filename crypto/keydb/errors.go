@@ -1,8 +1,19 @@
 package keydb
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/ooqls/getset/registry"
+)
 
 var (
-	ErrDBNotInitialized   error = fmt.Errorf("database not initialized")
-	ErrIncorrectSystemKey error = fmt.Errorf("the given key is not the correct system key")
+	ErrDBNotInitialized     error = fmt.Errorf("database not initialized")
+	ErrIncorrectSystemKey   error = fmt.Errorf("the given key is not the correct system key")
+	ErrDBAlreadyInitialized error = fmt.Errorf("database already initialized")
+	ErrKeyPairNotFound      error = fmt.Errorf("key pair not found")
+	ErrKeyRevoked           error = fmt.Errorf("key is revoked")
+	ErrKeyExpired           error = fmt.Errorf("key is expired")
+	ErrInvalidQuery         error = fmt.Errorf("invalid query")
+	ErrKeyPairMismatch      error = fmt.Errorf("private key does not match public key")
+	ErrSecretNotFound       error = registry.ErrSecretNotFound
 )
@@ -0,0 +1,234 @@
+// Package keydbtest holds the conformance suite every key database dialect
+// must pass.
+package keydbtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ooqls/getset/crypto/keydb"
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/stretchr/testify/assert"
+)
+
+// OpenFunc opens the key database prepared by a NewDatabaseFunc. Every call
+// opens another replica of the same database.
+type OpenFunc func(ctx context.Context, systemKey keys.X509) (*keydb.SQLCryptoDatabase, error)
+
+// NewDatabaseFunc prepares an empty database and returns how to open it.
+type NewDatabaseFunc func(t *testing.T) OpenFunc
+
+// Run runs the conformance suite against databases created by newDatabase.
+func Run(t *testing.T, newDatabase NewDatabaseFunc) {
+	tests := map[string]func(t *testing.T, open OpenFunc){
+		"KeyPairs":          testKeyPairs,
+		"Secrets":           testSecrets,
+		"Find":              testFind,
+		"RotateSystemKey":   testRotateSystemKey,
+		"StaleReplica":      testStaleReplica,
+		"ConcurrentInserts": testConcurrentInserts,
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test(t, newDatabase(t))
+		})
+	}
+}
+
+func newSystemKey(t *testing.T) keys.X509 {
+	ca, err := keys.CreateX509CA()
+	assert.Nilf(t, err, "should not fail to create CA")
+
+	systemKey, err := keys.CreateX509(*ca)
+	assert.Nilf(t, err, "should not fail to create x509")
+
+	return *systemKey
+}
+
+func mustOpen(t *testing.T, open OpenFunc, systemKey keys.X509) *keydb.SQLCryptoDatabase {
+	db, err := open(context.Background(), systemKey)
+	if !assert.Nilf(t, err, "should not fail to open db") {
+		t.FailNow()
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func testKeyPairs(t *testing.T, open OpenFunc) {
+	systemKey := newSystemKey(t)
+	db := mustOpen(t, open, systemKey)
+
+	ok, err := db.IsSystemKey(&systemKey)
+	assert.Nil(t, err)
+	assert.Truef(t, ok, "should store the system key on first open")
+
+	_, err = open(context.Background(), newSystemKey(t))
+	assert.ErrorIsf(t, err, keydb.ErrIncorrectSystemKey, "should not open with another system key")
+
+	rsaPriv, rsaPub, err := keys.NewRsaKeyPemBytes()
+	assert.Nil(t, err)
+	assert.Nil(t, db.InsertKeyPair("rsa", rsaPriv, rsaPub))
+
+	priv, pub, err := db.GetKeyPair("rsa")
+	assert.Nil(t, err)
+	assert.Equal(t, rsaPriv, priv)
+	assert.Equal(t, rsaPub, pub)
+
+	pub, err = db.GetPublicKey("rsa")
+	assert.Nil(t, err)
+	assert.Equal(t, rsaPub, pub)
+
+	_, _, err = db.GetKeyPair("missing")
+	assert.ErrorIs(t, err, keydb.ErrKeyPairNotFound)
+
+	infos, err := db.ListKeyPairs()
+	assert.Nil(t, err)
+	assert.Equal(t, []keydb.KeyPairInfo{{HashedPw: "rsa", PublicKey: rsaPub}}, infos)
+
+	assert.Nil(t, db.Verify(context.Background()))
+}
+
+func testSecrets(t *testing.T, open OpenFunc) {
+	db := mustOpen(t, open, newSystemKey(t))
+
+	assert.Nil(t, db.PutSecret("postgres", []byte("first")))
+	assert.Nilf(t, db.PutSecret("postgres", []byte("second")), "should be able to overwrite a secret")
+
+	value, err := db.GetSecret("postgres")
+	assert.Nil(t, err)
+	assert.Equal(t, "second", string(value))
+
+	assert.Nil(t, db.DeleteSecret("postgres"))
+	_, err = db.GetSecret("postgres")
+	assert.ErrorIs(t, err, keydb.ErrSecretNotFound)
+}
+
+func testFind(t *testing.T, open OpenFunc) {
+	db := mustOpen(t, open, newSystemKey(t))
+	ctx := context.Background()
+
+	ecPriv, ecPub, err := keys.NewECKeyPemBytes("P-256")
+	assert.Nil(t, err)
+
+	_, err = db.AddKey(ctx, keydb.NewKey{Id: "ec-1", HashedPw: "pw", PrivateKey: ecPriv, PublicKey: ecPub, Labels: map[string]string{"env": "prod"}})
+	assert.Nil(t, err)
+	_, err = db.AddKey(ctx, keydb.NewKey{Id: "aes-1", PrivateKey: make([]byte, 32), ExpiresAt: time.Now().Add(-time.Minute)})
+	assert.Nil(t, err)
+	_, err = db.AddKey(ctx, keydb.NewKey{Id: "ec-1", PrivateKey: ecPriv})
+	assert.NotNilf(t, err, "key ids should be unique")
+
+	find := func(queries ...keydb.Query) []string {
+		records, err := db.Find(ctx, queries...)
+		assert.Nil(t, err)
+
+		var ids []string
+		for _, r := range records {
+			ids = append(ids, r.Id)
+		}
+		return ids
+	}
+
+	assert.ElementsMatch(t, []string{"ec-1", "aes-1"}, find())
+	assert.Equal(t, []string{"ec-1"}, find(keydb.WithPasswordHash("pw")))
+	assert.Equal(t, []string{"ec-1"}, find(keydb.WithKeyType(string(keydb.KeyTypeEC))))
+	assert.Equal(t, []string{"ec-1"}, find(keydb.WithLabel("env", "prod")))
+	assert.Equal(t, []string{"aes-1"}, find(keydb.WithExpired(true)))
+
+	priv, err := db.GetPrivateKey(ctx, "ec-1")
+	assert.Nil(t, err)
+	assert.Equal(t, ecPriv, priv)
+
+	records, err := db.Find(ctx, keydb.WithKeyId("ec-1"))
+	assert.Nil(t, err)
+	assert.Equalf(t, int64(1), records[0].UseCount, "should count uses")
+
+	assert.Nil(t, db.Revoke(ctx, "ec-1"))
+	assert.ErrorIs(t, db.Revoke(ctx, "missing"), keydb.ErrKeyPairNotFound)
+	assert.Equal(t, []string{"ec-1"}, find(keydb.WithRevoked(true)))
+
+	_, err = db.GetPrivateKey(ctx, "ec-1")
+	assert.ErrorIs(t, err, keydb.ErrKeyRevoked)
+	_, err = db.GetPrivateKey(ctx, "aes-1")
+	assert.ErrorIs(t, err, keydb.ErrKeyExpired)
+}
+
+func testRotateSystemKey(t *testing.T, open OpenFunc) {
+	systemKey := newSystemKey(t)
+	db := mustOpen(t, open, systemKey)
+	ctx := context.Background()
+
+	edPriv, edPub, err := keys.NewEd25519KeyPemBytes()
+	assert.Nil(t, err)
+	assert.Nil(t, db.InsertKeyPair("ed25519", edPriv, edPub))
+	assert.Nil(t, db.PutSecret("postgres", []byte("secret")))
+
+	newKey := newSystemKey(t)
+	assert.Nilf(t, db.RotateSystemKey(ctx, newKey), "should be able to rotate the system key")
+
+	_, err = open(ctx, systemKey)
+	assert.ErrorIsf(t, err, keydb.ErrIncorrectSystemKey, "the old system key should no longer open the db")
+
+	rotated := mustOpen(t, open, newKey)
+	assert.Nil(t, rotated.Verify(ctx))
+
+	priv, _, err := rotated.GetKeyPair("ed25519")
+	assert.Nil(t, err)
+	assert.Equal(t, edPriv, priv)
+
+	secret, err := rotated.GetSecret("postgres")
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", string(secret))
+}
+
+func testStaleReplica(t *testing.T, open OpenFunc) {
+	systemKey := newSystemKey(t)
+	a := mustOpen(t, open, systemKey)
+	b := mustOpen(t, open, systemKey)
+	ctx := context.Background()
+
+	assert.Nil(t, a.RotateSystemKey(ctx, newSystemKey(t)))
+
+	_, err := b.AddKey(ctx, keydb.NewKey{PrivateKey: make([]byte, 32)})
+	assert.ErrorIsf(t, err, keydb.ErrIncorrectSystemKey, "should not store keys under a rotated system key")
+	assert.ErrorIsf(t, b.PutSecret("postgres", []byte("secret")), keydb.ErrIncorrectSystemKey,
+		"should not store secrets under a rotated system key")
+	assert.ErrorIs(t, b.RotateSystemKey(ctx, newSystemKey(t)), keydb.ErrIncorrectSystemKey)
+}
+
+func testConcurrentInserts(t *testing.T, open OpenFunc) {
+	systemKey := newSystemKey(t)
+	replicas := []*keydb.SQLCryptoDatabase{mustOpen(t, open, systemKey), mustOpen(t, open, systemKey)}
+	ctx := context.Background()
+
+	const perReplica = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, len(replicas)*perReplica)
+	for r, db := range replicas {
+		for i := 0; i < perReplica; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := db.AddKey(ctx, keydb.NewKey{
+					HashedPw:   fmt.Sprintf("replica-%d", r),
+					PrivateKey: make([]byte, 32),
+				})
+				errs <- err
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.Nilf(t, err, "concurrent inserts should not fail")
+	}
+
+	records, err := replicas[0].Find(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, records, len(replicas)*perReplica)
+}
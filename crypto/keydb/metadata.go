@@ -0,0 +1,365 @@
+package keydb
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ooqls/getset/crypto/keys"
+	"go.uber.org/zap"
+)
+
+type KeyType string
+
+const (
+	KeyTypeRSA     KeyType = "rsa"
+	KeyTypeEC      KeyType = "ec"
+	KeyTypeEd25519 KeyType = "ed25519"
+	KeyTypeAES     KeyType = "aes"
+)
+
+// DetectKeyType returns the type of a PEM private key, or AES for raw 16,
+// 24 or 32 byte keys. It returns an empty type if the key is not recognized.
+func DetectKeyType(privateKey []byte) KeyType {
+	signer, err := keys.ParsePrivateKeyPem(privateKey)
+	if err != nil {
+		switch len(privateKey) {
+		case 16, 24, 32:
+			return KeyTypeAES
+		}
+
+		return ""
+	}
+
+	switch signer.(type) {
+	case *rsa.PrivateKey:
+		return KeyTypeRSA
+	case *ecdsa.PrivateKey:
+		return KeyTypeEC
+	case ed25519.PrivateKey:
+		return KeyTypeEd25519
+	default:
+		return ""
+	}
+}
+
+// NewKey is a key to store with AddKey. Id and CreatedAt are generated and
+// Type is detected from the private key when empty.
+type NewKey struct {
+	Id         string
+	HashedPw   string
+	Type       KeyType
+	PrivateKey []byte
+	PublicKey  []byte
+	Labels     map[string]string
+	ExpiresAt  time.Time
+}
+
+// KeyRecord is the metadata of a stored key. Zero times are unset.
+type KeyRecord struct {
+	Id         string
+	HashedPw   string
+	Type       KeyType
+	PublicKey  []byte
+	Labels     map[string]string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	RevokedAt  time.Time
+	UseCount   int64
+	LastUsedAt time.Time
+}
+
+func (k *KeyRecord) Revoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+func (k *KeyRecord) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !k.ExpiresAt.After(now)
+}
+
+// keyPairColumns are added to key_pairs tables created before keys had
+// metadata.
+var keyPairColumns = []struct{ name, def string }{
+	{"key_id", "varchar(64)"},
+	{"key_type", "varchar(16) NOT NULL DEFAULT ''"},
+	{"labels", "TEXT NOT NULL DEFAULT '{}'"},
+	{"created_at", "BIGINT NOT NULL DEFAULT 0"},
+	{"expires_at", "BIGINT NOT NULL DEFAULT 0"},
+	{"revoked_at", "BIGINT NOT NULL DEFAULT 0"},
+	{"use_count", "BIGINT NOT NULL DEFAULT 0"},
+	{"last_used_at", "BIGINT NOT NULL DEFAULT 0"},
+}
+
+func (c *SQLCryptoDatabase) migrateKeyPairs(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, c.dialect.columns)
+	if err != nil {
+		return fmt.Errorf("failed to read key_pairs columns: %v", err)
+	}
+
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan key_pairs column: %v", err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for _, col := range keyPairColumns {
+		if existing[col.name] {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE key_pairs ADD COLUMN %s %s", col.name, col.def)); err != nil {
+			return fmt.Errorf("failed to add key_pairs column %s: %v", col.name, err)
+		}
+	}
+
+	// keys stored before ids existed get a random one
+	_, err = tx.ExecContext(ctx, c.q("UPDATE key_pairs SET key_id = "+c.dialect.randomId+", created_at = ? WHERE key_id IS NULL"), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to assign key ids: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS key_pairs_key_id ON key_pairs (key_id)")
+	if err != nil {
+		return fmt.Errorf("failed to create key_pairs index: %v", err)
+	}
+
+	return nil
+}
+
+// detectKeyTypes sets the type of keys stored before types were recorded.
+// Keys whose type can not be detected are left untyped.
+func (c *SQLCryptoDatabase) detectKeyTypes(ctx context.Context) error {
+	rows, err := c.db.QueryContext(ctx, "SELECT key_id, private_key FROM key_pairs WHERE key_type = ''")
+	if err != nil {
+		return fmt.Errorf("failed to read untyped keys: %v", err)
+	}
+
+	detected := map[string]KeyType{}
+	for rows.Next() {
+		var id string
+		var encrypted []byte
+		if err := rows.Scan(&id, &encrypted); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan key: %v", err)
+		}
+
+		priv, err := c.decrypt(encrypted)
+		if err != nil {
+			continue
+		}
+
+		if t := DetectKeyType(priv); t != "" {
+			detected[id] = t
+		}
+		keys.Zero(priv)
+	}
+	rows.Close()
+
+	for id, t := range detected {
+		if _, err := c.db.ExecContext(ctx, c.q("UPDATE key_pairs SET key_type = ? WHERE key_id = ?"), string(t), id); err != nil {
+			return fmt.Errorf("failed to set key type: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// AddKey encrypts and stores the key with its metadata. The insert holds a
+// shared lock on the system key so it can not race a rotation.
+func (c *SQLCryptoDatabase) AddKey(ctx context.Context, k NewKey) (*KeyRecord, error) {
+	record := KeyRecord{
+		Id:        k.Id,
+		HashedPw:  k.HashedPw,
+		Type:      k.Type,
+		PublicKey: k.PublicKey,
+		Labels:    k.Labels,
+		CreatedAt: time.Unix(time.Now().Unix(), 0),
+		ExpiresAt: k.ExpiresAt,
+	}
+	if record.Id == "" {
+		record.Id = uuid.NewString()
+	}
+	if record.Type == "" {
+		record.Type = DetectKeyType(k.PrivateKey)
+	}
+	if record.Labels == nil {
+		record.Labels = map[string]string{}
+	}
+
+	labels, err := json.Marshal(record.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode labels: %v", err)
+	}
+
+	encPrivKey, err := c.encrypt(k.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt private key: %v", err)
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := c.lockSystemKey(ctx, tx, false); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, c.q("INSERT INTO key_pairs (key_id, hashed_pw, key_type, private_key, public_key, labels, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"),
+		record.Id, record.HashedPw, string(record.Type), encPrivKey, record.PublicKey, string(labels), record.CreatedAt.Unix(), unixOrZero(record.ExpiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert key: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to insert key: %v", err)
+	}
+
+	return &record, nil
+}
+
+// Find returns the metadata of every key matching all queries, oldest
+// first. Private keys are not decrypted.
+func (c *SQLCryptoDatabase) Find(ctx context.Context, queries ...Query) ([]KeyRecord, error) {
+	clause, args, err := where(queries, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.QueryContext(ctx, c.q("SELECT key_id, hashed_pw, key_type, public_key, labels, created_at, expires_at, revoked_at, use_count, last_used_at FROM key_pairs"+clause+" ORDER BY created_at, key_id"), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find keys: %v", err)
+	}
+	defer rows.Close()
+
+	var records []KeyRecord
+	for rows.Next() {
+		var r KeyRecord
+		var keyType, labels string
+		var createdAt, expiresAt, revokedAt, lastUsedAt int64
+		err := rows.Scan(&r.Id, &r.HashedPw, &keyType, &r.PublicKey, &labels, &createdAt, &expiresAt, &revokedAt, &r.UseCount, &lastUsedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan key: %v", err)
+		}
+
+		r.Type = KeyType(keyType)
+		r.CreatedAt = timeOrZero(createdAt)
+		r.ExpiresAt = timeOrZero(expiresAt)
+		r.RevokedAt = timeOrZero(revokedAt)
+		r.LastUsedAt = timeOrZero(lastUsedAt)
+		if err := json.Unmarshal([]byte(labels), &r.Labels); err != nil {
+			return nil, fmt.Errorf("failed to decode labels of key %s: %v", r.Id, err)
+		}
+
+		if matchLabels(r.Labels, queries) {
+			records = append(records, r)
+		}
+	}
+
+	return records, rows.Err()
+}
+
+func matchLabels(labels map[string]string, queries []Query) bool {
+	for _, q := range queries {
+		if q.key != Query_Label {
+			continue
+		}
+
+		if v, ok := labels[q.label]; !ok || v != q.val {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *SQLCryptoDatabase) ListByType(ctx context.Context, t KeyType) ([]KeyRecord, error) {
+	return c.Find(ctx, WithKeyType(string(t)))
+}
+
+// Revoke marks the key as revoked. Revoked keys stay listed but their
+// private key can no longer be retrieved.
+func (c *SQLCryptoDatabase) Revoke(ctx context.Context, keyId string) error {
+	res, err := c.db.ExecContext(ctx, c.q("UPDATE key_pairs SET revoked_at = ? WHERE key_id = ? AND revoked_at = 0"), time.Now().Unix(), keyId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke key: %v", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		records, err := c.Find(ctx, WithKeyId(keyId))
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return fmt.Errorf("%w: %s", ErrKeyPairNotFound, keyId)
+		}
+	}
+
+	return nil
+}
+
+// GetPrivateKey decrypts the private key of a key that is neither revoked
+// nor expired and counts the use.
+func (c *SQLCryptoDatabase) GetPrivateKey(ctx context.Context, keyId string) ([]byte, error) {
+	var encPrivateKey []byte
+	var expiresAt, revokedAt int64
+	err := c.db.QueryRowContext(ctx, c.q("SELECT private_key, expires_at, revoked_at FROM key_pairs WHERE key_id = ?"), keyId).Scan(&encPrivateKey, &expiresAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrKeyPairNotFound, keyId)
+		}
+
+		return nil, fmt.Errorf("failed to get private key: %v", err)
+	}
+
+	if revokedAt != 0 {
+		return nil, fmt.Errorf("%w: %s", ErrKeyRevoked, keyId)
+	}
+	if expiresAt != 0 && expiresAt <= time.Now().Unix() {
+		return nil, fmt.Errorf("%w: %s", ErrKeyExpired, keyId)
+	}
+
+	decrypted, err := c.decrypt(encPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %v", err)
+	}
+
+	c.recordUse(ctx, "key_id = ?", keyId)
+	return decrypted, nil
+}
+
+// recordUse increments the usage counter, a failure does not fail the read.
+func (c *SQLCryptoDatabase) recordUse(ctx context.Context, cond string, arg any) {
+	_, err := c.db.ExecContext(ctx, c.q("UPDATE key_pairs SET use_count = use_count + 1, last_used_at = ? WHERE "+cond), time.Now().Unix(), arg)
+	if err != nil {
+		l.Warn("failed to record key use", zap.Error(err))
+	}
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+func timeOrZero(unix int64) time.Time {
+	if unix == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(unix, 0)
+}
@@ -0,0 +1,37 @@
+package keydb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/ooqls/getset/crypto/keys"
+	gosqlx "github.com/ooqls/getset/db/sqlx"
+	"github.com/ooqls/getset/registry"
+)
+
+// NewPostgres opens a key database stored in Postgres, see Open. The pool is
+// shared with the caller and is not closed by Close.
+func NewPostgres(ctx context.Context, db *sqlx.DB, systemKey keys.X509) (*SQLCryptoDatabase, error) {
+	cdb, err := Open(ctx, db.DB, systemKey, WithDialect(Postgres))
+	if err != nil {
+		return nil, err
+	}
+
+	cdb.borrowed = true
+	return cdb, nil
+}
+
+// InitPostgres initializes the key database in the Postgres database
+// configured in the registry, using the shared db/sqlx pool.
+func InitPostgres(systemKey keys.X509) error {
+	cryptoDb, err := NewPostgres(context.Background(), gosqlx.GetSQLX(), systemKey)
+	if err != nil {
+		return fmt.Errorf("failed to open postgres key database: %v", err)
+	}
+
+	cdb = cryptoDb
+	registry.RegisterSecretProvider(SecretScheme, NewSecretProvider(cryptoDb))
+
+	return nil
+}
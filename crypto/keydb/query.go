@@ -1,13 +1,25 @@
 package keydb
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 const (
 	Query_password = "password"
 	Query_KeyType  = "key_type"
+	Query_KeyId    = "key_id"
+	Query_Label    = "label"
+	Query_Revoked  = "revoked"
+	Query_Expired  = "expired"
 )
 
+// Query filters the keys returned by Find. Multiple queries must all match.
 type Query struct {
-	key string
-	val string
+	key   string
+	val   string
+	label string
 }
 
 func WithPasswordHash(hash string) Query {
@@ -19,7 +31,83 @@ func WithPasswordHash(hash string) Query {
 
 func WithKeyType(key string) Query {
 	return Query{
-		key: "key_type",
+		key: Query_KeyType,
 		val: key,
 	}
 }
+
+func WithKeyId(id string) Query {
+	return Query{
+		key: Query_KeyId,
+		val: id,
+	}
+}
+
+// WithLabel matches keys whose label key is set to value.
+func WithLabel(key, value string) Query {
+	return Query{
+		key:   Query_Label,
+		label: key,
+		val:   value,
+	}
+}
+
+// WithRevoked matches only revoked keys if revoked is true and only keys
+// that are not revoked otherwise.
+func WithRevoked(revoked bool) Query {
+	return Query{
+		key: Query_Revoked,
+		val: fmt.Sprint(revoked),
+	}
+}
+
+// WithExpired matches only expired keys if expired is true and only keys
+// that have not expired otherwise.
+func WithExpired(expired bool) Query {
+	return Query{
+		key: Query_Expired,
+		val: fmt.Sprint(expired),
+	}
+}
+
+// where translates the queries into a WHERE clause. Labels are stored as
+// JSON and are matched by the caller after scanning.
+func where(queries []Query, now time.Time) (string, []any, error) {
+	var conds []string
+	var args []any
+	for _, q := range queries {
+		switch q.key {
+		case Query_password:
+			conds = append(conds, "hashed_pw = ?")
+			args = append(args, q.val)
+		case Query_KeyType:
+			conds = append(conds, "key_type = ?")
+			args = append(args, q.val)
+		case Query_KeyId:
+			conds = append(conds, "key_id = ?")
+			args = append(args, q.val)
+		case Query_Revoked:
+			if q.val == "true" {
+				conds = append(conds, "revoked_at != 0")
+			} else {
+				conds = append(conds, "revoked_at = 0")
+			}
+		case Query_Expired:
+			if q.val == "true" {
+				conds = append(conds, "(expires_at != 0 AND expires_at <= ?)")
+			} else {
+				conds = append(conds, "(expires_at = 0 OR expires_at > ?)")
+			}
+			args = append(args, now.Unix())
+		case Query_Label:
+		default:
+			return "", nil, fmt.Errorf("%w: %s", ErrInvalidQuery, q.key)
+		}
+	}
+
+	if len(conds) == 0 {
+		return "", nil, nil
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args, nil
+}
@@ -0,0 +1,83 @@
+package keydb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ooqls/getset/crypto/keys"
+)
+
+// SecretScheme is the secret_ref scheme of secrets stored in the key
+// database, e.g. "keydb:postgres".
+const SecretScheme = "keydb"
+
+// PutSecret stores the value under name encrypted with the system key,
+// replacing any existing value.
+func (c *SQLCryptoDatabase) PutSecret(name string, value []byte) error {
+	encrypted, err := c.encrypt(value)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secret: %v", err)
+	}
+
+	ctx := context.Background()
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := c.lockSystemKey(ctx, tx, false); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, c.q("INSERT INTO secrets (name, value) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET value = excluded.value"), name, encrypted)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (c *SQLCryptoDatabase) GetSecret(name string) ([]byte, error) {
+	var encrypted []byte
+	err := c.db.QueryRow(c.q("SELECT value FROM secrets WHERE name = ?"), name).Scan(&encrypted)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+		}
+
+		return nil, fmt.Errorf("failed to get secret: %v", err)
+	}
+
+	decrypted, err := c.decrypt(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret: %v", err)
+	}
+
+	return decrypted, nil
+}
+
+func (c *SQLCryptoDatabase) DeleteSecret(name string) error {
+	_, err := c.db.Exec(c.q("DELETE FROM secrets WHERE name = ?"), name)
+	return err
+}
+
+// SecretProvider resolves secret refs against the secrets of a key
+// database. It satisfies registry.SecretProvider.
+type SecretProvider struct {
+	db CryptoDatabase
+}
+
+func NewSecretProvider(db CryptoDatabase) *SecretProvider {
+	return &SecretProvider{db: db}
+}
+
+func (p *SecretProvider) Resolve(ctx context.Context, ref string) (*keys.Secret, error) {
+	b, err := p.db.GetSecret(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys.NewSecret(b), nil
+}
@@ -9,6 +9,7 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 
 	"github.com/ooqls/getset/crypto/keys"
+	"github.com/ooqls/getset/registry"
 )
 
 var cdb CryptoDatabase = nil
@@ -27,7 +28,7 @@ func Init(sqllitePath string, systemKey keys.X509) error {
 	}
 
 	cryptoDb := New(db, systemKey)
-	err = cryptoDb.createTable(context.Background())
+	err = cryptoDb.CreateTable(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to create table: %v", err)
 	}
@@ -38,6 +39,7 @@ func Init(sqllitePath string, systemKey keys.X509) error {
 	}
 
 	cdb = cryptoDb
+	registry.RegisterSecretProvider(SecretScheme, NewSecretProvider(cryptoDb))
 
 	return nil
 }
@@ -0,0 +1,67 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSR_SignCSR(t *testing.T) {
+	ca, err := CreateX509CA(WithCommonName("test CA"))
+	assert.Nil(t, err, "should be able to create CA")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	csrPem, err := CreateCSR(key, WithCommonName("orders"), WithDNSNames([]string{"orders.svc.local"}), WithIPAddresses([]net.IP{net.ParseIP("10.1.2.3")}))
+	assert.Nilf(t, err, "should be able to create a CSR for an existing key")
+
+	csr, err := ParseCSR(csrPem)
+	assert.Nilf(t, err, "should be able to parse the CSR")
+	assert.Equal(t, "orders", csr.Subject.CommonName)
+	assert.Equal(t, []string{"orders.svc.local"}, csr.DNSNames)
+	assert.Equal(t, &key.PublicKey, csr.PublicKey)
+
+	crt, err := SignCSR(*ca, csr)
+	assert.Nil(t, err, "should be able to sign the CSR")
+	assert.Equal(t, "orders", crt.Subject.CommonName)
+	assert.Equal(t, []string{"orders.svc.local"}, crt.DNSNames)
+	assert.Equal(t, &key.PublicKey, crt.PublicKey, "the certificate should be for the requesting key")
+	assert.Equal(t, x509.KeyUsageDigitalSignature, crt.KeyUsage)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(&ca.crt)
+	_, err = crt.Verify(x509.VerifyOptions{Roots: pool, DNSName: "orders.svc.local"})
+	assert.Nilf(t, err, "the certificate should chain to the CA")
+
+	notAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+	crt, err = SignCSR(*ca, csr,
+		WithDNSNames([]string{"api.svc.local"}),
+		WithNotAfter(notAfter),
+		WithKeyUsage(x509.KeyUsageDigitalSignature|x509.KeyUsageKeyAgreement))
+	assert.Nil(t, err)
+	assert.Equalf(t, []string{"api.svc.local"}, crt.DNSNames, "options should override the requested names")
+	assert.Equal(t, notAfter.UTC(), crt.NotAfter.UTC())
+	assert.Equal(t, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyAgreement, crt.KeyUsage)
+
+	csr.Signature[0] ^= 0xff
+	_, err = SignCSR(*ca, csr)
+	assert.ErrorIsf(t, err, ErrInvalidCSR, "should not sign tampered CSRs")
+}
+
+func TestCSR_ParseCSR(t *testing.T) {
+	_, err := ParseCSR([]byte("not a csr"))
+	assert.ErrorIs(t, err, ErrInvalidCSR)
+
+	ca, err := CreateX509CA()
+	assert.Nil(t, err)
+	_, crtPem := ca.Pem()
+	_, err = ParseCSR(crtPem)
+	assert.ErrorIsf(t, err, ErrInvalidCSR, "should not parse certificates")
+}
@@ -0,0 +1,54 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// Curve returns the named elliptic curve, P-256, P-384 or P-521.
+func Curve(name string) (elliptic.Curve, error) {
+	switch name {
+	case "P-256", "":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", name)
+	}
+}
+
+func NewECKey(curve string) (*ecdsa.PrivateKey, error) {
+	c, err := Curve(curve)
+	if err != nil {
+		return nil, err
+	}
+
+	return ecdsa.GenerateKey(c, rand.Reader)
+}
+
+func NewECKeyPemBytes(curve string) ([]byte, []byte, error) {
+	key, err := NewECKey(curve)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal ec private key: %v", err)
+	}
+
+	pubBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal ec public key: %v", err)
+	}
+
+	privPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privBytes})
+	pubPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+	return privPem, pubPem, nil
+}
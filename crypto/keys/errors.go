@@ -0,0 +1,15 @@
+package keys
+
+import (
+	"errors"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	ErrUnknownKeyId         = errors.New("unknown key id")
+	ErrInvalidSigningMethod = errors.New("invalid signing method")
+	ErrInvalidCSR           = errors.New("invalid certificate signing request")
+	ErrUnsupportedKeyType   = errors.New("unsupported key type")
+	ErrIncorrectPassword    = pkcs12.ErrIncorrectPassword
+)
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/urfave/cli"
+)
+
+func writeKeyPair(out, keyPairName string, priv, pub []byte) error {
+	privPath := path.Join(out, fmt.Sprintf("%s.pem", keyPairName))
+	pubPath := path.Join(out, fmt.Sprintf("%s_pub.pem", keyPairName))
+	err := os.WriteFile(privPath, priv, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(pubPath, pub, 0644)
+}
+
+func gen_ec(ctx *cli.Context) error {
+	priv, pub, err := keys.NewECKeyPemBytes(ctx.String("curve"))
+	if err != nil {
+		return err
+	}
+
+	return writeKeyPair(ctx.String("out"), ctx.String("name"), priv, pub)
+}
+
+func gen_ed25519(ctx *cli.Context) error {
+	priv, pub, err := keys.NewEd25519KeyPemBytes()
+	if err != nil {
+		return err
+	}
+
+	return writeKeyPair(ctx.String("out"), ctx.String("name"), priv, pub)
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/ooqls/getset/crypto/keydb"
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/urfave/cli"
+)
+
+var keydbFlag cli.StringFlag = cli.StringFlag{
+	Name:  "db",
+	Usage: "path to the key database",
+	Value: "keys.db",
+}
+
+var systemKeyFlag cli.StringFlag = cli.StringFlag{
+	Name:  "system-key",
+	Usage: "path to the PEM private key of the system x509 key, may also contain the cert",
+}
+
+var systemCertFlag cli.StringFlag = cli.StringFlag{
+	Name:  "system-cert",
+	Usage: "path to the PEM cert of the system x509 key",
+}
+
+var keyIdFlag cli.StringFlag = cli.StringFlag{
+	Name:  "id",
+	Usage: "the id (hashed password) the key pair is stored under",
+}
+
+// loadSystemKey parses the system key from a private key file and an
+// optional cert file, as written by the x509 commands.
+func loadSystemKey(keyPath, certPath string) (*keys.X509, error) {
+	if keyPath == "" {
+		return nil, fmt.Errorf("a system key is required")
+	}
+
+	pemB, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if certPath != "" {
+		certB, err := os.ReadFile(certPath)
+		if err != nil {
+			return nil, err
+		}
+
+		pemB = append(pemB, byte('\n'))
+		pemB = append(pemB, certB...)
+	}
+
+	return keys.ParseX509Bytes(pemB)
+}
+
+func openKeydb(ctx *cli.Context) (*keydb.SQLCryptoDatabase, error) {
+	systemKey, err := loadSystemKey(ctx.String("system-key"), ctx.String("system-cert"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load system key: %v", err)
+	}
+
+	return keydb.LoadExisting(ctx.String("db"), *systemKey)
+}
+
+func keydbInit(ctx *cli.Context) error {
+	if info, err := os.Stat(ctx.String("db")); err == nil && info.Size() > 0 {
+		return fmt.Errorf("%w: %s", keydb.ErrDBAlreadyInitialized, ctx.String("db"))
+	}
+
+	var systemKey *keys.X509
+	var err error
+	if ctx.String("system-key") != "" {
+		systemKey, err = loadSystemKey(ctx.String("system-key"), ctx.String("system-cert"))
+	} else {
+		systemKey, err = genSystemKey(ctx.String("out"), ctx.String("name"))
+	}
+	if err != nil {
+		return err
+	}
+
+	db, err := keydb.Create(ctx.String("db"), *systemKey)
+	if err != nil {
+		return err
+	}
+
+	return db.Close()
+}
+
+func genSystemKey(out, name string) (*keys.X509, error) {
+	ca, err := keys.CreateX509CA(keys.WithCommonName("keydb system CA"))
+	if err != nil {
+		return nil, err
+	}
+
+	systemKey, err := keys.CreateX509(*ca, keys.WithCommonName(name))
+	if err != nil {
+		return nil, err
+	}
+
+	priv, pub := systemKey.Pem()
+	if err := writeKeyPair(out, name, priv, pub); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("wrote system key to %s\n", path.Join(out, name+".pem"))
+	return systemKey, nil
+}
+
+func keydbAdd(ctx *cli.Context) error {
+	id := ctx.String("id")
+	if id == "" {
+		return fmt.Errorf("an id is required")
+	}
+
+	var priv, pub []byte
+	var err error
+	switch t := ctx.String("type"); t {
+	case "":
+		if priv, err = os.ReadFile(ctx.String("private-key")); err != nil {
+			return err
+		}
+		if pub, err = os.ReadFile(ctx.String("public-key")); err != nil {
+			return err
+		}
+	case "rsa":
+		priv, pub, err = keys.NewRsaKeyPemBytes()
+	case "ec":
+		priv, pub, err = keys.NewECKeyPemBytes(ctx.String("curve"))
+	case "ed25519":
+		priv, pub, err = keys.NewEd25519KeyPemBytes()
+	default:
+		return fmt.Errorf("unsupported key type %s", t)
+	}
+	if err != nil {
+		return err
+	}
+	defer keys.Zero(priv)
+
+	db, err := openKeydb(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.InsertKeyPair(id, priv, pub)
+}
+
+// fingerprint is the SHA-256 of the DER public key, or of the raw value if
+// it is not PEM encoded.
+func fingerprint(pub []byte) string {
+	b := pub
+	if block, _ := pem.Decode(pub); block != nil {
+		b = block.Bytes
+	}
+
+	return fmt.Sprintf("SHA256:%x", sha256.Sum256(b))
+}
+
+func keydbList(ctx *cli.Context) error {
+	db, err := openKeydb(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var queries []keydb.Query
+	if t := ctx.String("type"); t != "" {
+		queries = append(queries, keydb.WithKeyType(t))
+	}
+
+	records, err := db.Find(context.Background(), queries...)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		status := "active"
+		if r.Revoked() {
+			status = "revoked"
+		} else if r.Expired(time.Now()) {
+			status = "expired"
+		}
+
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\t%d\n", r.Id, r.Type, r.HashedPw, fingerprint(r.PublicKey), status, r.UseCount)
+	}
+
+	return nil
+}
+
+func keydbRevoke(ctx *cli.Context) error {
+	db, err := openKeydb(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Revoke(context.Background(), ctx.String("key-id"))
+}
+
+func keydbExportPublic(ctx *cli.Context) error {
+	db, err := openKeydb(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	pub, err := db.GetPublicKey(ctx.String("id"))
+	if err != nil {
+		return err
+	}
+
+	if ctx.String("out") == "" {
+		_, err = os.Stdout.Write(pub)
+		return err
+	}
+
+	return os.WriteFile(ctx.String("out"), pub, 0644)
+}
+
+func keydbRotateSystemKey(ctx *cli.Context) error {
+	newSystemKey, err := loadSystemKey(ctx.String("new-system-key"), ctx.String("new-system-cert"))
+	if err != nil {
+		return fmt.Errorf("failed to load new system key: %v", err)
+	}
+
+	db, err := openKeydb(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.RotateSystemKey(context.Background(), *newSystemKey)
+}
+
+func keydbVerify(ctx *cli.Context) error {
+	db, err := openKeydb(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.Verify(context.Background()); err != nil {
+		return err
+	}
+
+	fmt.Println("ok")
+	return nil
+}
+
+var keydbCommand = cli.Command{
+	Name:  "keydb",
+	Usage: "Manage a key database encrypted by a system x509 key",
+	Subcommands: cli.Commands{
+		{
+			Name:   "init",
+			Usage:  "Creates a key database, generating a system key into --out unless --system-key is given",
+			Action: keydbInit,
+			Flags: []cli.Flag{
+				keydbFlag,
+				systemKeyFlag,
+				systemCertFlag,
+				outFlag,
+				cli.StringFlag{
+					Name:  "name",
+					Usage: "name for the generated system key pair",
+					Value: "system",
+				},
+			},
+		},
+		{
+			Name:   "add",
+			Usage:  "Adds a key pair from --private-key and --public-key, or generates one of --type",
+			Action: keydbAdd,
+			Flags: []cli.Flag{
+				keydbFlag,
+				systemKeyFlag,
+				systemCertFlag,
+				keyIdFlag,
+				cli.StringFlag{
+					Name:  "private-key",
+					Usage: "path to the private key",
+				},
+				cli.StringFlag{
+					Name:  "public-key",
+					Usage: "path to the public key",
+				},
+				cli.StringFlag{
+					Name:  "type",
+					Usage: "generate a key pair instead, rsa, ec or ed25519",
+				},
+				cli.StringFlag{
+					Name:  "curve",
+					Usage: "the curve of generated ec keys, P-256, P-384 or P-521",
+					Value: "P-256",
+				},
+			},
+		},
+		{
+			Name:   "list",
+			Usage:  "Lists the stored key pairs with their type, public key fingerprint, status and use count",
+			Action: keydbList,
+			Flags: []cli.Flag{
+				keydbFlag,
+				systemKeyFlag,
+				systemCertFlag,
+				cli.StringFlag{
+					Name:  "type",
+					Usage: "only list keys of this type, rsa, ec, ed25519 or aes",
+				},
+			},
+		},
+		{
+			Name:   "revoke",
+			Usage:  "Revokes a key so its private key can no longer be retrieved",
+			Action: keydbRevoke,
+			Flags: []cli.Flag{
+				keydbFlag,
+				systemKeyFlag,
+				systemCertFlag,
+				cli.StringFlag{
+					Name:  "key-id",
+					Usage: "the id of the key to revoke, as shown by list",
+				},
+			},
+		},
+		{
+			Name:   "export-public",
+			Usage:  "Writes the public key of a key pair to --out or stdout",
+			Action: keydbExportPublic,
+			Flags: []cli.Flag{
+				keydbFlag,
+				systemKeyFlag,
+				systemCertFlag,
+				keyIdFlag,
+				cli.StringFlag{
+					Name:  "out",
+					Usage: "the file to write the public key to",
+				},
+			},
+		},
+		{
+			Name:   "rotate-system-key",
+			Usage:  "Re-encrypts every private key and secret under a new system key",
+			Action: keydbRotateSystemKey,
+			Flags: []cli.Flag{
+				keydbFlag,
+				systemKeyFlag,
+				systemCertFlag,
+				cli.StringFlag{
+					Name:  "new-system-key",
+					Usage: "path to the PEM private key of the new system x509 key",
+				},
+				cli.StringFlag{
+					Name:  "new-system-cert",
+					Usage: "path to the PEM cert of the new system x509 key",
+				},
+			},
+		},
+		{
+			Name:   "verify",
+			Usage:  "Checks the system key and that every private key and secret decrypts",
+			Action: keydbVerify,
+			Flags: []cli.Flag{
+				keydbFlag,
+				systemKeyFlag,
+				systemCertFlag,
+			},
+		},
+	},
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/pem"
 	"fmt"
 	"os"
 	"path"
+	"time"
 
 	"github.com/ooqls/getset/crypto/keys"
 	"github.com/urfave/cli"
@@ -15,10 +17,11 @@ func genX509Cert(c *cli.Context) error {
 	commonName := c.String("common-name")
 	aliases := c.StringSlice("aliases")
 	ca := c.String("ca")
+	keyType := keys.KeyType(c.String("key-type"))
 	var err error
 	var caKeys *keys.X509
 	if ca == "" {
-		caKeys, err = keys.CreateX509CA()
+		caKeys, err = keys.CreateX509CAWithKeyType(keyType)
 	} else {
 		caKeys, err = keys.ParseX509File(ca)
 	}
@@ -26,7 +29,7 @@ func genX509Cert(c *cli.Context) error {
 		return err
 	}
 
-	keys, err := keys.CreateX509(*caKeys, keys.WithCommonName(commonName), keys.WithDNSNames(aliases))
+	keys, err := keys.CreateX509WithKeyType(*caKeys, keyType, keys.WithCommonName(commonName), keys.WithDNSNames(aliases))
 	if err != nil {
 		return err
 	}
@@ -56,7 +59,7 @@ func genX509CA(ctx *cli.Context) error {
 	out := ctx.String("out")
 	keyPairName := ctx.String("name")
 
-	ca, err := keys.CreateX509CA(
+	ca, err := keys.CreateX509CAWithKeyType(keys.KeyType(ctx.String("key-type")),
 		keys.WithCommonName(cn),
 		keys.WithDNSNames(aliases),
 	)
@@ -82,3 +85,155 @@ func genX509CA(ctx *cli.Context) error {
 	return nil
 
 }
+
+func genX509CSR(ctx *cli.Context) error {
+	privPem, err := os.ReadFile(ctx.String("key"))
+	if err != nil {
+		return err
+	}
+
+	key, err := keys.ParsePrivateKeyPem(privPem)
+	if err != nil {
+		return err
+	}
+
+	csr, err := keys.CreateCSR(key,
+		keys.WithCommonName(ctx.String("common-name")),
+		keys.WithDNSNames(ctx.StringSlice("aliases")),
+	)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path.Join(ctx.String("out"), fmt.Sprintf("%s.csr", ctx.String("name"))), csr, 0644)
+}
+
+func genX509Sign(ctx *cli.Context) error {
+	caKey, err := os.ReadFile(ctx.String("ca-key"))
+	if err != nil {
+		return err
+	}
+
+	caCert, err := os.ReadFile(ctx.String("ca-cert"))
+	if err != nil {
+		return err
+	}
+
+	ca, err := keys.ParseX509Bytes(append(append(caKey, '\n'), caCert...))
+	if err != nil {
+		return err
+	}
+
+	csrPem, err := os.ReadFile(ctx.String("csr"))
+	if err != nil {
+		return err
+	}
+
+	csr, err := keys.ParseCSR(csrPem)
+	if err != nil {
+		return err
+	}
+
+	aliases := ctx.StringSlice("aliases")
+	if len(aliases) == 0 {
+		aliases = csr.DNSNames
+	}
+
+	crt, err := keys.SignCSR(*ca, csr,
+		keys.WithDNSNames(aliases),
+		keys.WithNotAfter(time.Now().AddDate(0, 0, ctx.Int("days"))),
+	)
+	if err != nil {
+		return err
+	}
+
+	pub := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})
+	return os.WriteFile(path.Join(ctx.String("out"), fmt.Sprintf("%s_pub.pem", ctx.String("name"))), pub, 0644)
+}
+
+func genX509Export(ctx *cli.Context) error {
+	keyPem, err := os.ReadFile(ctx.String("key"))
+	if err != nil {
+		return err
+	}
+
+	certPem, err := os.ReadFile(ctx.String("cert"))
+	if err != nil {
+		return err
+	}
+
+	x, err := keys.ParseX509Bytes(append(append(keyPem, '\n'), certPem...))
+	if err != nil {
+		return err
+	}
+
+	// intermediates following the cert and those of the chain file
+	certs, err := keys.ParseCertificatesPem(certPem)
+	if err != nil {
+		return err
+	}
+	chain := certs[1:]
+	if p := ctx.String("chain"); p != "" {
+		chainPem, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		intermediates, err := keys.ParseCertificatesPem(chainPem)
+		if err != nil {
+			return err
+		}
+		chain = append(chain, intermediates...)
+	}
+
+	out, name := ctx.String("out"), ctx.String("name")
+	switch format := ctx.String("format"); format {
+	case "p12":
+		p12, err := keys.EncodePKCS12(*x, chain, ctx.String("password"))
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(path.Join(out, fmt.Sprintf("%s.p12", name)), p12, 0600)
+	case "pem-bundle":
+		return os.WriteFile(path.Join(out, fmt.Sprintf("%s_bundle.pem", name)), x.PEMBundle(chain), 0644)
+	default:
+		return fmt.Errorf("unsupported export format %q, use p12 or pem-bundle", format)
+	}
+}
+
+// genX509Import writes the key and cert of the keystore to <name>.pem and
+// <name>_pub.pem, the files export reads, and the intermediates to
+// <name>_chain.pem.
+func genX509Import(ctx *cli.Context) error {
+	p12, err := os.ReadFile(ctx.String("p12"))
+	if err != nil {
+		return err
+	}
+
+	x, chain, err := keys.DecodePKCS12(p12, ctx.String("password"))
+	if err != nil {
+		return err
+	}
+
+	out, name := ctx.String("out"), ctx.String("name")
+	priv, pub := x.Pem()
+	if err := os.WriteFile(path.Join(out, fmt.Sprintf("%s.pem", name)), priv, 0600); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path.Join(out, fmt.Sprintf("%s_pub.pem", name)), pub, 0644); err != nil {
+		return err
+	}
+
+	if len(chain) == 0 {
+		return nil
+	}
+
+	var chainPem []byte
+	for _, crt := range chain {
+		chainPem = append(chainPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})...)
+	}
+
+	return os.WriteFile(path.Join(out, fmt.Sprintf("%s_chain.pem", name)), chainPem, 0644)
+}
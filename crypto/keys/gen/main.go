@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/urfave/cli"
@@ -28,6 +29,12 @@ var keypairFlag cli.StringFlag = cli.StringFlag{
 	Value: "x509",
 }
 
+var keyTypeFlag cli.StringFlag = cli.StringFlag{
+	Name:  "key-type",
+	Usage: "the key of the cert, rsa, ecdsa-p256, ecdsa-p384 or ed25519",
+	Value: "rsa",
+}
+
 func main() {
 	app := cli.NewApp()
 
@@ -42,6 +49,29 @@ func main() {
 			},
 			Action: gen_rsa,
 		},
+		{
+			Name:  "ec",
+			Usage: "Generate ECDSA private/public key pairs for ES256/ES384/ES512 signing",
+			Flags: []cli.Flag{
+				keypairFlag,
+				outFlag,
+				cli.StringFlag{
+					Name:  "curve",
+					Usage: "the curve to use, P-256, P-384 or P-521",
+					Value: "P-256",
+				},
+			},
+			Action: gen_ec,
+		},
+		{
+			Name:  "ed25519",
+			Usage: "Generate Ed25519 private/public key pairs for EdDSA signing",
+			Flags: []cli.Flag{
+				keypairFlag,
+				outFlag,
+			},
+			Action: gen_ed25519,
+		},
 		{
 			Name: "x509",
 			Subcommands: cli.Commands{
@@ -55,12 +85,114 @@ func main() {
 						keypairFlag,
 						commonNameFlag,
 						aliasesFlag,
+						keyTypeFlag,
 						cli.StringFlag{
 							Name:  "ca",
 							Usage: "path to the CA private key",
 						},
 					},
 				},
+				{
+					Name:   "csr",
+					Usage:  "Generates a certificate signing request for an existing private key",
+					Action: genX509CSR,
+					Flags: []cli.Flag{
+						outFlag,
+						keypairFlag,
+						commonNameFlag,
+						aliasesFlag,
+						cli.StringFlag{
+							Name:     "key",
+							Usage:    "path to the PEM private key to request a cert for",
+							Required: true,
+						},
+					},
+				},
+				{
+					Name:   "sign",
+					Usage:  "Signs a certificate signing request with the given CA",
+					Action: genX509Sign,
+					Flags: []cli.Flag{
+						outFlag,
+						keypairFlag,
+						cli.StringSliceFlag{
+							Name:  "aliases",
+							Usage: "DNS names to issue instead of the requested ones",
+						},
+						cli.StringFlag{
+							Name:     "ca-key",
+							Usage:    "path to the PEM CA private key",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:     "ca-cert",
+							Usage:    "path to the PEM CA certificate",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:     "csr",
+							Usage:    "path to the certificate signing request",
+							Required: true,
+						},
+						cli.IntFlag{
+							Name:  "days",
+							Usage: "number of days the cert is valid for",
+							Value: 365,
+						},
+					},
+				},
+				{
+					Name:   "export",
+					Usage:  "Exports a cert, its key and intermediates as a PKCS#12 keystore or PEM bundle",
+					Action: genX509Export,
+					Flags: []cli.Flag{
+						outFlag,
+						keypairFlag,
+						cli.StringFlag{
+							Name:     "key",
+							Usage:    "path to the PEM private key",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:     "cert",
+							Usage:    "path to the PEM certificate, optionally followed by intermediates",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:  "chain",
+							Usage: "path to PEM intermediates to include",
+						},
+						cli.StringFlag{
+							Name:  "format",
+							Usage: "p12 or pem-bundle",
+							Value: "p12",
+						},
+						cli.StringFlag{
+							Name:   "password",
+							Usage:  "the password protecting the p12 keystore",
+							EnvVar: "KEYSTORE_PASSWORD",
+						},
+					},
+				},
+				{
+					Name:   "import",
+					Usage:  "Imports the key, cert and intermediates of a PKCS#12 keystore as PEM files",
+					Action: genX509Import,
+					Flags: []cli.Flag{
+						outFlag,
+						keypairFlag,
+						cli.StringFlag{
+							Name:     "p12",
+							Usage:    "path to the PKCS#12 keystore",
+							Required: true,
+						},
+						cli.StringFlag{
+							Name:   "password",
+							Usage:  "the password protecting the p12 keystore",
+							EnvVar: "KEYSTORE_PASSWORD",
+						},
+					},
+				},
 				{
 					Name:   "ca",
 					Usage:  "Generates an x509 CA",
@@ -70,11 +202,16 @@ func main() {
 						keypairFlag,
 						commonNameFlag,
 						aliasesFlag,
+						keyTypeFlag,
 					},
 				},
 			},
 		},
+		keydbCommand,
+	}
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	app.Run(os.Args)
 
 }
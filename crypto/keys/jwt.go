@@ -1,6 +1,9 @@
 package keys
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"fmt"
 
@@ -16,36 +19,180 @@ type SecureValue[T any] interface {
 	GetValue() T
 }
 
+// Supported JWT signing algorithms.
+const (
+	RS256 string = "RS256"
+	RS384 string = "RS384"
+	RS512 string = "RS512"
+	PS256 string = "PS256"
+	ES256 string = "ES256"
+	ES384 string = "ES384"
+	ES512 string = "ES512"
+	EdDSA string = "EdDSA"
+)
+
+// SigningAlgorithms lists every algorithm a JwtKey can sign with.
+var SigningAlgorithms = []string{RS256, RS384, RS512, PS256, ES256, ES384, ES512, EdDSA}
+
 type JwtSigningKey interface {
+	// Sign signs the claims with the key's default algorithm.
 	Sign(claims jwt.Claims) (string, *jwt.Token, error)
+	SignWithAlgorithm(alg string, claims jwt.Claims) (string, *jwt.Token, error)
+	// Algorithm is the default signing algorithm of the key.
+	Algorithm() string
 	Decrypt(token string) (*jwt.Token, error)
-	PublicKey() *rsa.PublicKey
+	PublicKey() crypto.PublicKey
+	// Keyfunc selects the verification key for a parsed token by its kid header.
+	Keyfunc(t *jwt.Token) (interface{}, error)
+	JWKS() JWKSet
 }
 
-func ParseJwtKey(privkey, pubkey []byte) (JwtSigningKey, error) {
-	rsakey, err := ParseRSA(privkey, pubkey)
+// ParseJwtKey parses a PEM encoded RSA, EC or Ed25519 key pair. The public
+// key is optional and only checked against the private key.
+func ParseJwtKey(privkey, pubkey []byte) (*JwtKey, error) {
+	priv, err := ParsePrivateKeyPem(privkey)
 	if err != nil {
 		return nil, err
 	}
 
-	return &JwtKey{
-		rsakey: *rsakey,
-	}, nil
+	if len(pubkey) > 0 {
+		pub, err := ParsePublicKeyPem(pubkey)
+		if err != nil {
+			return nil, err
+		}
+
+		eq, ok := pub.(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !eq.Equal(priv.Public()) {
+			return nil, fmt.Errorf("public key does not match private key")
+		}
+	}
+
+	return NewJWTKeyWithAlgorithm(priv, "")
 }
 
 func NewJWTKey(key RSAKey) *JwtKey {
+	k, _ := NewJWTKeyWithAlgorithm(&key.privkey, RS256)
+	return k
+}
+
+// NewJWTKeyWithAlgorithm creates a JwtKey signing with alg by default. An
+// empty alg picks the default algorithm for the key type.
+func NewJWTKeyWithAlgorithm(priv crypto.Signer, alg string) (*JwtKey, error) {
+	if alg == "" {
+		alg = defaultAlgorithm(priv.Public())
+	}
+
+	method, err := signingMethod(alg, priv.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := Thumbprint(priv.Public())
+	if err != nil {
+		return nil, err
+	}
+
 	return &JwtKey{
-		rsakey: key,
+		priv:   priv,
+		method: method,
+		kid:    kid,
+	}, nil
+}
+
+// GenerateJWTKey creates a new key of the type required by alg.
+func GenerateJWTKey(alg string) (*JwtKey, error) {
+	var priv crypto.Signer
+	var err error
+	switch alg {
+	case RS256, RS384, RS512, PS256, "":
+		priv, err = NewRSAKey()
+	case ES256:
+		priv, err = NewECKey("P-256")
+	case ES384:
+		priv, err = NewECKey("P-384")
+	case ES512:
+		priv, err = NewECKey("P-521")
+	case EdDSA:
+		priv, err = NewEd25519Key()
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSigningMethod, alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %v", alg, err)
+	}
+
+	return NewJWTKeyWithAlgorithm(priv, alg)
+}
+
+func defaultAlgorithm(pub crypto.PublicKey) string {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve.Params().Name {
+		case "P-384":
+			return ES384
+		case "P-521":
+			return ES512
+		}
+		return ES256
+	case ed25519.PublicKey:
+		return EdDSA
+	default:
+		return RS256
 	}
 }
 
+// signingMethod returns the jwt signing method for alg, checking that the
+// key type can be used with it.
+func signingMethod(alg string, pub crypto.PublicKey) (jwt.SigningMethod, error) {
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSigningMethod, alg)
+	}
+
+	ok := false
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			ok = true
+		}
+	case *ecdsa.PublicKey:
+		m, isEC := method.(*jwt.SigningMethodECDSA)
+		ok = isEC && m.CurveBits == k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		_, ok = method.(*jwt.SigningMethodEd25519)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s cannot be used with a %T", ErrInvalidSigningMethod, alg, pub)
+	}
+
+	return method, nil
+}
+
 type JwtKey struct {
-	rsakey RSAKey
+	priv   crypto.Signer
+	method jwt.SigningMethod
+	kid    string
 }
 
 func (k *JwtKey) Sign(claims jwt.Claims) (string, *jwt.Token, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	tokenStr, err := token.SignedString(&k.rsakey.privkey)
+	return k.sign(k.method, claims)
+}
+
+func (k *JwtKey) SignWithAlgorithm(alg string, claims jwt.Claims) (string, *jwt.Token, error) {
+	method, err := signingMethod(alg, k.priv.Public())
+	if err != nil {
+		return "", nil, err
+	}
+
+	return k.sign(method, claims)
+}
+
+func (k *JwtKey) sign(method jwt.SigningMethod, claims jwt.Claims) (string, *jwt.Token, error) {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = k.kid
+	tokenStr, err := token.SignedString(k.priv)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to sign claim: %v", err)
 	}
@@ -54,15 +201,39 @@ func (k *JwtKey) Sign(claims jwt.Claims) (string, *jwt.Token, error) {
 }
 
 func (k *JwtKey) Decrypt(token string) (*jwt.Token, error) {
-	return jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("invalid signing method: %v", t.Method)
-		}
+	return jwt.Parse(token, k.Keyfunc)
+}
+
+func (k *JwtKey) Keyfunc(t *jwt.Token) (interface{}, error) {
+	if _, err := signingMethod(t.Method.Alg(), k.priv.Public()); err != nil {
+		return nil, err
+	}
+
+	if kid, ok := t.Header["kid"].(string); ok && kid != k.kid {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyId, kid)
+	}
+
+	return k.priv.Public(), nil
+}
+
+func (k *JwtKey) PublicKey() crypto.PublicKey {
+	return k.priv.Public()
+}
+
+func (k *JwtKey) Algorithm() string {
+	return k.method.Alg()
+}
 
-		return &k.rsakey.pubkey, nil
-	})
+func (k *JwtKey) KeyId() string {
+	return k.kid
 }
 
-func (k *JwtKey) PublicKey() *rsa.PublicKey {
-	return &k.rsakey.pubkey
+func (k *JwtKey) JWKS() JWKSet {
+	jwk, err := NewJWK(k.kid, k.method.Alg(), k.priv.Public())
+	if err != nil {
+		l.Error("failed to create jwk", zap.String("kid", k.kid), zap.Error(err))
+		return JWKSet{Keys: []JWK{}}
+	}
+
+	return JWKSet{Keys: []JWK{jwk}}
 }
@@ -1,7 +1,9 @@
 package keys
 
 import (
+	"crypto"
 	"encoding/base64"
+	"encoding/json"
 	"testing"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -30,3 +32,89 @@ func TestInit(t *testing.T) {
 
 	assert.Equalf(t, data, decodedData, "should be able to verify")
 }
+
+func TestJwtKey_Algorithms(t *testing.T) {
+	for _, alg := range SigningAlgorithms {
+		t.Run(alg, func(t *testing.T) {
+			key, err := GenerateJWTKey(alg)
+			assert.Nilf(t, err, "should be able to generate key")
+			assert.Equal(t, alg, key.Algorithm())
+
+			tokenStr, token, err := key.Sign(jwt.MapClaims{"sub": "123"})
+			assert.Nilf(t, err, "should be able to sign")
+			assert.Equal(t, alg, token.Method.Alg())
+
+			_, err = key.Decrypt(tokenStr)
+			assert.Nilf(t, err, "should be able to verify")
+
+			jwks := key.JWKS()
+			assert.Len(t, jwks.Keys, 1)
+			pub, err := jwks.Keys[0].PublicKey()
+			assert.Nilf(t, err, "should be able to decode the jwk")
+			assert.True(t, pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(key.PublicKey()))
+		})
+	}
+}
+
+func TestJwtKey_SignWithAlgorithm(t *testing.T) {
+	key, err := GenerateJWTKey(RS256)
+	assert.Nil(t, err)
+
+	_, token, err := key.SignWithAlgorithm(PS256, jwt.MapClaims{})
+	assert.Nil(t, err)
+	assert.Equal(t, PS256, token.Method.Alg())
+
+	_, _, err = key.SignWithAlgorithm(ES256, jwt.MapClaims{})
+	assert.ErrorIs(t, err, ErrInvalidSigningMethod)
+}
+
+func TestParseJwtKey(t *testing.T) {
+	for name, gen := range map[string]func() ([]byte, []byte, error){
+		"rsa":     NewRsaKeyPemBytes,
+		"ec":      func() ([]byte, []byte, error) { return NewECKeyPemBytes("P-384") },
+		"ec-p521": func() ([]byte, []byte, error) { return NewECKeyPemBytes("P-521") },
+		"ed25519": NewEd25519KeyPemBytes,
+	} {
+		t.Run(name, func(t *testing.T) {
+			priv, pub, err := gen()
+			assert.Nil(t, err)
+
+			key, err := ParseJwtKey(priv, pub)
+			assert.Nilf(t, err, "should be able to parse key pair")
+
+			tokenStr, _, err := key.Sign(jwt.MapClaims{})
+			assert.Nil(t, err)
+			_, err = key.Decrypt(tokenStr)
+			assert.Nil(t, err)
+		})
+	}
+
+	priv, _, err := NewECKeyPemBytes("P-256")
+	assert.Nil(t, err)
+	_, otherPub, err := NewECKeyPemBytes("P-256")
+	assert.Nil(t, err)
+	_, err = ParseJwtKey(priv, otherPub)
+	assert.NotNilf(t, err, "should reject mismatched key pairs")
+}
+
+func TestGenerateJWTKey_ES512(t *testing.T) {
+	key, err := GenerateJWTKey(ES512)
+	assert.Nil(t, err)
+	assert.Equal(t, ES512, key.Algorithm())
+
+	tokenStr, token, err := key.Sign(jwt.MapClaims{})
+	assert.Nil(t, err)
+	assert.Equal(t, ES512, token.Method.Alg())
+
+	b, err := json.Marshal(key.JWKS())
+	assert.Nil(t, err)
+	set, err := ParseJWKSet(b)
+	assert.Nil(t, err)
+	if assert.Len(t, set.Keys, 1) {
+		assert.Equal(t, "P-521", set.Keys[0].Crv)
+		pub, err := set.Keys[0].PublicKey()
+		assert.Nil(t, err)
+		_, err = jwt.Parse(tokenStr, func(*jwt.Token) (interface{}, error) { return pub, nil })
+		assert.Nilf(t, err, "should verify with the published key")
+	}
+}
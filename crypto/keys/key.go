@@ -1,10 +1,83 @@
 package keys
 
-import "crypto/rsa"
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+)
 
 type Key interface {
+	// Encrypt and Decrypt return ErrUnsupportedKeyType for signing-only keys
+	// such as ECDSA and Ed25519 keys.
 	Encrypt(data []byte) ([]byte, error)
 	Decrypt(data []byte) ([]byte, error)
-	PublicKey() (rsa.PublicKey, []byte)
-	PrivateKey() (rsa.PrivateKey, []byte)
+	PublicKey() (crypto.PublicKey, []byte)
+	PrivateKey() (crypto.Signer, []byte)
+}
+
+// KeyType selects the algorithm of generated private keys.
+type KeyType string
+
+const (
+	KeyTypeRSA       KeyType = "rsa"
+	KeyTypeECDSAP256 KeyType = "ecdsa-p256"
+	KeyTypeECDSAP384 KeyType = "ecdsa-p384"
+	KeyTypeEd25519   KeyType = "ed25519"
+)
+
+// NewPrivateKey generates a key of the type, RSA keys are 2048 bits.
+func NewPrivateKey(t KeyType) (crypto.Signer, error) {
+	switch t {
+	case KeyTypeRSA, "":
+		return NewRSAKey()
+	case KeyTypeECDSAP256:
+		return NewECKey("P-256")
+	case KeyTypeECDSAP384:
+		return NewECKey("P-384")
+	case KeyTypeEd25519:
+		return NewEd25519Key()
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, string(t))
+	}
+}
+
+// marshalPrivateKey returns the PEM type and DER bytes of the key, PKCS1 for
+// RSA, SEC1 for ECDSA and PKCS8 for other keys, the formats
+// ParsePrivateKeyPem reads.
+func marshalPrivateKey(key crypto.Signer) (string, []byte, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(k), nil
+	case *ecdsa.PrivateKey:
+		b, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to marshal ec private key: %v", err)
+		}
+		return "EC PRIVATE KEY", b, nil
+	case ed25519.PrivateKey:
+		b, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to marshal ed25519 private key: %v", err)
+		}
+		return "PRIVATE KEY", b, nil
+	default:
+		return "", nil, fmt.Errorf("%w: %T", ErrUnsupportedKeyType, key)
+	}
+}
+
+// marshalPublicKey returns PKCS1 bytes for RSA and PKIX bytes for other keys.
+func marshalPublicKey(pub crypto.PublicKey) ([]byte, error) {
+	if k, ok := pub.(*rsa.PublicKey); ok {
+		return x509.MarshalPKCS1PublicKey(k), nil
+	}
+
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %v", err)
+	}
+
+	return b, nil
 }
@@ -0,0 +1,196 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+type keyState string
+
+const (
+	KeyStateActive   keyState = "active"
+	KeyStateRetiring keyState = "retiring"
+)
+
+type ringKey struct {
+	key       *JwtKey
+	state     keyState
+	retiredAt time.Time
+}
+
+// KeyRing is a JwtSigningKey that holds one active key used for signing and
+// any number of retiring keys that are still accepted for verification until
+// their retention period is over. Tokens carry the kid of the signing key so
+// the verifier can pick the right one.
+type KeyRing struct {
+	m         sync.RWMutex
+	keys      []*ringKey
+	retention time.Duration
+}
+
+// NewKeyRing creates a key ring signing with the given key. Retired keys are
+// kept for retention, which should be at least the longest token validity.
+func NewKeyRing(active *JwtKey, retention time.Duration) *KeyRing {
+	return &KeyRing{
+		keys: []*ringKey{
+			{key: active, state: KeyStateActive},
+		},
+		retention: retention,
+	}
+}
+
+func (r *KeyRing) active() *JwtKey {
+	for _, k := range r.keys {
+		if k.state == KeyStateActive {
+			return k.key
+		}
+	}
+
+	return nil
+}
+
+// AddKey makes the given key the active signing key and retires the current one.
+func (r *KeyRing) AddKey(key *JwtKey) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	now := time.Now()
+	for _, k := range r.keys {
+		if k.state == KeyStateActive {
+			k.state = KeyStateRetiring
+			k.retiredAt = now
+		}
+	}
+
+	r.keys = append(r.keys, &ringKey{key: key, state: KeyStateActive})
+	r.prune(now)
+}
+
+// Rotate generates a new key for the active key's algorithm and makes it the
+// active signing key.
+func (r *KeyRing) Rotate() error {
+	key, err := GenerateJWTKey(r.Algorithm())
+	if err != nil {
+		return fmt.Errorf("failed to create rotated key: %v", err)
+	}
+
+	r.AddKey(key)
+	return nil
+}
+
+// RunRotation rotates the active key every interval until ctx is done.
+func (r *KeyRing) RunRotation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Rotate(); err != nil {
+				l.Error("failed to rotate jwt key", zap.Error(err))
+				continue
+			}
+			l.Info("rotated jwt key", zap.String("kid", r.KeyId()))
+		}
+	}
+}
+
+func (r *KeyRing) expired(k *ringKey, now time.Time) bool {
+	return k.state == KeyStateRetiring && now.Sub(k.retiredAt) > r.retention
+}
+
+// prune drops expired keys, it runs on rotation so verification only needs
+// the read lock and skips keys that expired since.
+func (r *KeyRing) prune(now time.Time) {
+	kept := r.keys[:0]
+	for _, k := range r.keys {
+		if r.expired(k, now) {
+			continue
+		}
+		kept = append(kept, k)
+	}
+	r.keys = kept
+}
+
+func (r *KeyRing) Sign(claims jwt.Claims) (string, *jwt.Token, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return r.active().Sign(claims)
+}
+
+func (r *KeyRing) SignWithAlgorithm(alg string, claims jwt.Claims) (string, *jwt.Token, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return r.active().SignWithAlgorithm(alg, claims)
+}
+
+func (r *KeyRing) Decrypt(token string) (*jwt.Token, error) {
+	return jwt.Parse(token, r.Keyfunc)
+}
+
+func (r *KeyRing) Keyfunc(t *jwt.Token) (interface{}, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	now := time.Now()
+	kid, ok := t.Header["kid"].(string)
+	if !ok {
+		// tokens issued before kid headers were introduced
+		return r.active().Keyfunc(t)
+	}
+
+	for _, k := range r.keys {
+		if k.key.KeyId() == kid && !r.expired(k, now) {
+			return k.key.Keyfunc(t)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownKeyId, kid)
+}
+
+func (r *KeyRing) PublicKey() crypto.PublicKey {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return r.active().PublicKey()
+}
+
+func (r *KeyRing) Algorithm() string {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return r.active().Algorithm()
+}
+
+func (r *KeyRing) KeyId() string {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return r.active().KeyId()
+}
+
+func (r *KeyRing) JWKS() JWKSet {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	now := time.Now()
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range r.keys {
+		if r.expired(k, now) {
+			continue
+		}
+		set.Keys = append(set.Keys, k.key.JWKS().Keys...)
+	}
+
+	return set
+}
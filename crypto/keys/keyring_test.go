@@ -0,0 +1,60 @@
+package keys
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyRing_Rotate(t *testing.T) {
+	rsakey, err := NewRSA()
+	assert.Nilf(t, err, "should be able to create rsa key")
+
+	ring := NewKeyRing(NewJWTKey(*rsakey), time.Minute)
+	oldKid := ring.KeyId()
+	kid, err := Thumbprint(&rsakey.pubkey)
+	assert.Nil(t, err)
+	assert.Equal(t, kid, oldKid)
+
+	oldToken, token, err := ring.Sign(jwt.MapClaims{"sub": "123"})
+	assert.Nilf(t, err, "should be able to sign")
+	assert.Equal(t, oldKid, token.Header["kid"])
+
+	assert.Nilf(t, ring.Rotate(), "should be able to rotate")
+	assert.NotEqual(t, oldKid, ring.KeyId())
+
+	newToken, token, err := ring.Sign(jwt.MapClaims{"sub": "123"})
+	assert.Nilf(t, err, "should be able to sign")
+	assert.Equal(t, ring.KeyId(), token.Header["kid"])
+
+	_, err = ring.Decrypt(oldToken)
+	assert.Nilf(t, err, "retiring key should still verify")
+
+	_, err = ring.Decrypt(newToken)
+	assert.Nilf(t, err, "active key should verify")
+
+	jwks := ring.JWKS()
+	assert.Len(t, jwks.Keys, 2)
+}
+
+func TestKeyRing_RetentionExpired(t *testing.T) {
+	rsakey, err := NewRSA()
+	assert.Nilf(t, err, "should be able to create rsa key")
+
+	ring := NewKeyRing(NewJWTKey(*rsakey), 0)
+	oldToken, _, err := ring.Sign(jwt.MapClaims{"sub": "123"})
+	assert.Nilf(t, err, "should be able to sign")
+
+	assert.Nilf(t, ring.Rotate(), "should be able to rotate")
+	time.Sleep(time.Millisecond)
+
+	_, err = ring.Decrypt(oldToken)
+	assert.ErrorIs(t, err, ErrUnknownKeyId)
+	assert.Len(t, ring.JWKS().Keys, 1)
+	assert.Lenf(t, ring.keys, 2, "verification should only read the ring")
+
+	assert.Nil(t, ring.Rotate())
+	assert.Lenf(t, ring.keys, 2, "rotation should prune expired keys")
+}
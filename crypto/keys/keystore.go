@@ -0,0 +1,90 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// EncodePKCS12 encodes the key and certificate with the chain of
+// intermediates into a password protected PKCS#12 keystore. It uses AES-256
+// and PBKDF2, which Java 11+ reads as a "PKCS12" KeyStore and OpenSSL 3
+// without the legacy provider. PKCS#12 is the only keystore format, JKS is
+// not written as PKCS#12 has been Java's default keystore type since Java 9,
+// keytool -importkeystore converts it for consumers that still need JKS.
+func EncodePKCS12(x X509, chain []*x509.Certificate, password string) ([]byte, error) {
+	if password == "" {
+		return nil, fmt.Errorf("a password is required to encode a pkcs12 keystore")
+	}
+
+	b, err := pkcs12.Modern.Encode(x.privKey, &x.crt, chain, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode pkcs12 keystore: %v", err)
+	}
+
+	return b, nil
+}
+
+// DecodePKCS12 decodes a keystore with one private key, returning the key
+// with its certificate and the chain of other certificates. A wrong password
+// returns ErrIncorrectPassword.
+func DecodePKCS12(b []byte, password string) (*X509, []*x509.Certificate, error) {
+	key, crt, chain, err := pkcs12.DecodeChain(b, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode pkcs12 keystore: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %T", ErrUnsupportedKeyType, key)
+	}
+
+	if pub, ok := crt.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(signer.Public()) {
+		return nil, nil, fmt.Errorf("private key does not match the certificate")
+	}
+
+	return NewX509(*crt, signer, *NewRand()), chain, nil
+}
+
+// PEMBundle returns the certificate followed by the chain of intermediates,
+// the order servers such as nginx expect in their certificate file.
+func (x *X509) PEMBundle(chain []*x509.Certificate) []byte {
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: x.crt.Raw})
+	for _, crt := range chain {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})...)
+	}
+
+	return b
+}
+
+// ParseCertificatesPem parses every CERTIFICATE block of the PEM bytes in
+// order, skipping other blocks.
+func ParseCertificatesPem(b []byte) ([]*x509.Certificate, error) {
+	var crts []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		crt, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %v", err)
+		}
+		crts = append(crts, crt)
+	}
+
+	if len(crts) == 0 {
+		return nil, fmt.Errorf("failed to find a PEM block containing a certificate")
+	}
+
+	return crts, nil
+}
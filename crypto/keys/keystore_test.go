@@ -0,0 +1,61 @@
+package keys
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeystore_PKCS12(t *testing.T) {
+	ca, err := CreateX509CA(WithCommonName("ca"))
+	assert.Nil(t, err)
+	caCrt := ca.GetCertificate()
+	chain := []*x509.Certificate{&caCrt}
+
+	for _, keyType := range []KeyType{KeyTypeRSA, KeyTypeECDSAP256, KeyTypeEd25519} {
+		x, err := CreateX509WithKeyType(*ca, keyType, WithDNSNames([]string{"localhost"}))
+		assert.Nil(t, err)
+
+		p12, err := EncodePKCS12(*x, chain, "changeit")
+		if !assert.Nilf(t, err, "should encode a %s keystore", keyType) {
+			continue
+		}
+
+		decoded, decodedChain, err := DecodePKCS12(p12, "changeit")
+		if assert.Nilf(t, err, "should decode the %s keystore", keyType) {
+			assert.Equal(t, x.GetCertificate().Raw, decoded.GetCertificate().Raw)
+			_, want := x.PrivateKey()
+			_, got := decoded.PrivateKey()
+			assert.Equal(t, want, got)
+			if assert.Len(t, decodedChain, 1) {
+				assert.Equal(t, caCrt.Raw, decodedChain[0].Raw)
+			}
+		}
+
+		_, _, err = DecodePKCS12(p12, "wrong")
+		assert.ErrorIs(t, err, ErrIncorrectPassword)
+	}
+
+	_, err = EncodePKCS12(*ca, nil, "")
+	assert.NotNilf(t, err, "should require a password")
+}
+
+func TestKeystore_PEMBundle(t *testing.T) {
+	ca, err := CreateX509CA()
+	assert.Nil(t, err)
+	x, err := CreateX509(*ca)
+	assert.Nil(t, err)
+
+	caCrt := ca.GetCertificate()
+	crts, err := ParseCertificatesPem(x.PEMBundle([]*x509.Certificate{&caCrt}))
+	assert.Nil(t, err)
+	if assert.Len(t, crts, 2) {
+		assert.Equalf(t, x.GetCertificate().Raw, crts[0].Raw, "the certificate should come first")
+		assert.Equal(t, caCrt.Raw, crts[1].Raw)
+	}
+
+	key, _ := x.Pem()
+	_, err = ParseCertificatesPem(key)
+	assert.NotNilf(t, err, "should fail without certificates")
+}
@@ -1,6 +1,8 @@
 package keys
 
 import (
+	"crypto"
+	crand "crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -12,8 +14,7 @@ import (
 var rsakey *RSAKey = nil
 
 func NewRSAKey() (*rsa.PrivateKey, error) {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	key, err := rsa.GenerateKey(r, 2048)
+	key, err := rsa.GenerateKey(crand.Reader, 2048)
 	if err != nil {
 		return nil, err
 	}
@@ -112,12 +113,12 @@ func (r *RSAKey) Decrypt(data []byte) ([]byte, error) {
 	return rsa.DecryptPKCS1v15(&r.r, &r.privkey, data)
 }
 
-func (r *RSAKey) PublicKey() (rsa.PublicKey, []byte) {
-	return r.pubkey, x509.MarshalPKCS1PublicKey(&r.pubkey)
+func (r *RSAKey) PublicKey() (crypto.PublicKey, []byte) {
+	return &r.pubkey, x509.MarshalPKCS1PublicKey(&r.pubkey)
 }
 
-func (r *RSAKey) PrivateKey() (rsa.PrivateKey, []byte) {
-	return r.privkey, x509.MarshalPKCS1PrivateKey(&r.privkey)
+func (r *RSAKey) PrivateKey() (crypto.Signer, []byte) {
+	return &r.privkey, x509.MarshalPKCS1PrivateKey(&r.privkey)
 }
 
 func (r *RSAKey) Pem() ([]byte, []byte) {
@@ -0,0 +1,164 @@
+package keys
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Redacted replaces a secret in logs, fmt and JSON/YAML output.
+const Redacted = "[REDACTED]"
+
+var _ SecureValue[[]byte] = (*Secret)(nil)
+
+// Secret holds sensitive bytes such as passwords. The value is kept in
+// memory locked against swapping where the platform allows it, is zeroed
+// on Delete, or once the secret is garbage collected, and never shows up
+// when the secret is logged, printed or marshalled. The zero value and nil
+// are empty secrets.
+type Secret struct {
+	m       sync.RWMutex
+	b       []byte
+	mapped  bool
+	locked  bool
+	cleanup runtime.Cleanup
+}
+
+type secretMemory struct {
+	b      []byte
+	mapped bool
+}
+
+// releaseSecret zeroes and frees the memory of a secret that was garbage
+// collected without Delete.
+var releaseSecret = func(m secretMemory) {
+	Zero(m.b)
+	freeSecret(m.b, m.mapped)
+}
+
+// NewSecret copies b into a new secret and zeroes b.
+func NewSecret(b []byte) *Secret {
+	s := &Secret{}
+	s.b, s.mapped, s.locked = allocSecret(len(b))
+	copy(s.b, b)
+	Zero(b)
+
+	if len(s.b) > 0 {
+		s.cleanup = runtime.AddCleanup(s, func(m secretMemory) { releaseSecret(m) }, secretMemory{b: s.b, mapped: s.mapped})
+	}
+
+	return s
+}
+
+// NewSecretString creates a secret from a string. The string itself can not
+// be zeroed, prefer NewSecret when the value is available as bytes.
+func NewSecretString(str string) *Secret {
+	return NewSecret([]byte(str))
+}
+
+// GetValue returns a copy of the secret bytes. The secret's own memory is
+// released on Delete or garbage collection, the copy is not, so callers
+// should Zero it once done.
+func (s *Secret) GetValue() []byte {
+	if s == nil {
+		return nil
+	}
+
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	if s.b == nil {
+		return nil
+	}
+
+	return append([]byte{}, s.b...)
+}
+
+// Reveal returns the secret as a string for APIs that require one. The
+// returned copy is not covered by Delete.
+func (s *Secret) Reveal() string {
+	if s == nil {
+		return ""
+	}
+
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return string(s.b)
+}
+
+// Empty reports whether the secret holds no value.
+func (s *Secret) Empty() bool {
+	if s == nil {
+		return true
+	}
+
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return len(s.b) == 0
+}
+
+// Locked reports whether the value is locked in memory.
+func (s *Secret) Locked() bool {
+	if s == nil {
+		return false
+	}
+
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return s.locked
+}
+
+// Delete zeroes the value and releases its memory. The secret is empty
+// afterwards.
+func (s *Secret) Delete() {
+	if s == nil {
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.b == nil {
+		return
+	}
+
+	s.cleanup.Stop()
+	Zero(s.b)
+	freeSecret(s.b, s.mapped)
+	s.b = nil
+	s.mapped = false
+	s.locked = false
+}
+
+func (s *Secret) String() string {
+	return Redacted
+}
+
+func (s *Secret) GoString() string {
+	return Redacted
+}
+
+// Format redacts the secret for every verb, including %x and %v.
+func (s *Secret) Format(f fmt.State, verb rune) {
+	f.Write([]byte(Redacted))
+}
+
+func (s *Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + Redacted + `"`), nil
+}
+
+func (s *Secret) MarshalYAML() (interface{}, error) {
+	return Redacted, nil
+}
+
+func (s *Secret) MarshalText() ([]byte, error) {
+	return []byte(Redacted), nil
+}
+
+// Zero overwrites b with zeros.
+func Zero(b []byte) {
+	clear(b)
+}
@@ -0,0 +1,43 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package keys
+
+import (
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// allocSecret maps dedicated pages for a secret so locking and unlocking
+// them does not affect other memory sharing the page.
+func allocSecret(n int) (b []byte, mapped bool, locked bool) {
+	if n == 0 {
+		return []byte{}, false, false
+	}
+
+	pages, err := syscall.Mmap(-1, 0, n, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		l.Warn("failed to map secret memory, falling back to the heap", zap.Error(err))
+		return make([]byte, n), false, false
+	}
+
+	// locking fails without CAP_IPC_LOCK once RLIMIT_MEMLOCK is exhausted,
+	// the secret is still kept on its own pages and zeroed on Delete
+	if err := syscall.Mlock(pages); err != nil {
+		l.Debug("failed to lock secret memory", zap.Error(err))
+		return pages, true, false
+	}
+
+	return pages, true, true
+}
+
+func freeSecret(b []byte, mapped bool) {
+	if !mapped {
+		return
+	}
+
+	syscall.Munlock(b)
+	if err := syscall.Munmap(b); err != nil {
+		l.Warn("failed to unmap secret memory", zap.Error(err))
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package keys
+
+func allocSecret(n int) (b []byte, mapped bool, locked bool) {
+	return make([]byte, n), false, false
+}
+
+func freeSecret(b []byte, mapped bool) {}
@@ -0,0 +1,122 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSecret(t *testing.T) {
+	b := []byte("hunter2")
+	s := NewSecret(b)
+	assert.Equal(t, make([]byte, len(b)), b, "input should be zeroed")
+	assert.Equal(t, "hunter2", s.Reveal())
+	assert.Equal(t, []byte("hunter2"), s.GetValue())
+	assert.False(t, s.Empty())
+
+	s.Delete()
+	assert.True(t, s.Empty())
+	assert.Nil(t, s.GetValue())
+	assert.Equal(t, "", s.Reveal())
+	assert.False(t, s.Locked())
+	s.Delete()
+
+	var empty *Secret
+	assert.True(t, empty.Empty())
+	assert.Equal(t, "", empty.Reveal())
+	empty.Delete()
+
+	assert.True(t, NewSecret(nil).Empty())
+}
+
+func TestSecret_Cleanup(t *testing.T) {
+	released := make(chan secretMemory, 1)
+	release := releaseSecret
+	releaseSecret = func(m secretMemory) {
+		release(m)
+		released <- m
+	}
+	defer func() { releaseSecret = release }()
+
+	func() {
+		s := NewSecret([]byte("password"))
+		assert.Equal(t, "password", string(s.GetValue()))
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case m := <-released:
+			assert.Len(t, m.b, len("password"))
+			return
+		case <-deadline:
+			t.Fatal("should release the memory of an unreachable secret")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestSecret_ValueOutlivesCollection(t *testing.T) {
+	released := make(chan secretMemory, 1)
+	release := releaseSecret
+	releaseSecret = func(m secretMemory) {
+		release(m)
+		released <- m
+	}
+	defer func() { releaseSecret = release }()
+
+	value := func() []byte {
+		return NewSecret([]byte("password")).GetValue()
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for collected := false; !collected; {
+		runtime.GC()
+		select {
+		case <-released:
+			collected = true
+		case <-deadline:
+			t.Fatal("should release the memory of an unreachable secret")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	assert.Equal(t, "password", string(value), "a retained value should survive the secret being collected")
+	Zero(value)
+}
+
+func TestSecret_Redaction(t *testing.T) {
+	s := NewSecretString("hunter2")
+	defer s.Delete()
+
+	for _, format := range []string{"%s", "%v", "%+v", "%#v", "%x", "%q"} {
+		assert.Equalf(t, Redacted, fmt.Sprintf(format, s), "%s should be redacted", format)
+	}
+
+	j, err := json.Marshal(struct {
+		Pw *Secret `json:"pw"`
+	}{s})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"pw":"[REDACTED]"}`, string(j))
+
+	y, err := yaml.Marshal(struct {
+		Pw *Secret `yaml:"pw"`
+	}{s})
+	assert.Nil(t, err)
+	assert.Equal(t, "pw: '[REDACTED]'\n", string(y))
+
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.DebugLevel))
+	logger.Info("connecting", zap.Any("password", s), zap.Reflect("reflected", s), zap.Stringer("stringer", s))
+	assert.NotContains(t, buf.String(), "hunter2")
+	assert.Contains(t, buf.String(), Redacted)
+}
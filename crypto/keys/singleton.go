@@ -8,7 +8,7 @@ import (
 )
 
 var m sync.Mutex = sync.Mutex{}
-var jwtKey *JwtKey = nil
+var jwtKey JwtSigningKey = nil
 var rsaKey Key = nil
 var caKey *X509 = nil
 
@@ -85,14 +85,12 @@ func InitJwt(privKey []byte, pubKey []byte) error {
 	defer m.Unlock()
 
 	l.Info("parsing keys", zap.ByteString("priv", privKey), zap.ByteString("pub", pubKey))
-	rsakey, err := ParseRSA(privKey, pubKey)
+	key, err := ParseJwtKey(privKey, pubKey)
 	if err != nil {
 		return err
 	}
 
-	jwtKey = &JwtKey{
-		rsakey: *rsakey,
-	}
+	jwtKey = key
 
 	return nil
 }
@@ -104,6 +102,23 @@ func SetJwt(newJwt *JwtKey) {
 	jwtKey = newJwt
 }
 
+// SetJwtSigningKey replaces the JWT key with any signing key, e.g. a KeyRing.
+func SetJwtSigningKey(k JwtSigningKey) {
+	m.Lock()
+	defer m.Unlock()
+
+	jwtKey = k
+}
+
+// HasRSA reports whether the RSA key has been initialized, RSA panics when it
+// has not.
+func HasRSA() bool {
+	m.Lock()
+	defer m.Unlock()
+
+	return rsaKey != nil
+}
+
 func RSA() Key {
 	m.Lock()
 	defer m.Unlock()
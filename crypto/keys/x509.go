@@ -1,6 +1,11 @@
 package keys
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	crand "crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/x509"
@@ -10,6 +15,7 @@ import (
 	"math/big"
 	"math/rand"
 	"net"
+	"net/url"
 	"os"
 	"time"
 )
@@ -39,6 +45,13 @@ func WithEmailAddresses(emailAddresses []string) option {
 	}
 }
 
+// WithURIs sets the URI SANs, e.g. a SPIFFE ID.
+func WithURIs(uris []*url.URL) option {
+	return func(c *x509.Certificate) {
+		c.URIs = uris
+	}
+}
+
 func WithPermittedDNSDomainsCritical(critical bool) option {
 	return func(c *x509.Certificate) {
 		c.PermittedDNSDomainsCritical = critical
@@ -83,21 +96,67 @@ func WithExtKeyUsage(eku []x509.ExtKeyUsage) option {
 	}
 }
 
+func WithCRLDistributionPoints(urls []string) option {
+	return func(c *x509.Certificate) {
+		c.CRLDistributionPoints = urls
+	}
+}
+
+func WithOCSPServers(urls []string) option {
+	return func(c *x509.Certificate) {
+		c.OCSPServer = urls
+	}
+}
+
 func WithTemplate(template x509.Certificate) option {
 	return func(c *x509.Certificate) {
 		*c = template
 	}
 }
 
+// keyUsage is the key usage of certificates for the key, key encipherment
+// only applies to RSA keys.
+func keyUsage(pub crypto.PublicKey) x509.KeyUsage {
+	if _, ok := pub.(*rsa.PublicKey); ok {
+		return x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
+	}
+
+	return x509.KeyUsageDigitalSignature
+}
+
+// signatureAlgorithm keeps SHA256WithRSA for RSA issuers and lets x509 pick
+// the default of other keys.
+func signatureAlgorithm(issuer crypto.PublicKey) x509.SignatureAlgorithm {
+	if _, ok := issuer.(*rsa.PublicKey); ok {
+		return x509.SHA256WithRSA
+	}
+
+	return x509.UnknownSignatureAlgorithm
+}
+
+// CreateX509CACertificate creates a self-signed CA with a new RSA key, see
+// CreateX509CACertificateWithKey for other key types.
 func CreateX509CACertificate(opts ...option) (*x509.Certificate, *rsa.PrivateKey, error) {
-	privKey, err := rsa.GenerateKey(rand.New(rand.NewSource(time.Now().UnixNano())), 2048)
+	privKey, err := NewRSAKey()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to generate private key: %v", err)
 	}
 
-	pkBytes, err := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
+	cert, err := CreateX509CACertificateWithKey(privKey, opts...)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to marshal public key: %v", err)
+		return nil, nil, err
+	}
+
+	return cert, privKey, nil
+}
+
+// CreateX509CACertificateWithKey creates a self-signed CA for the RSA, ECDSA
+// or Ed25519 key.
+func CreateX509CACertificateWithKey(privKey crypto.Signer, opts ...option) (*x509.Certificate, error) {
+	pub := privKey.Public()
+	pkBytes, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %v", err)
 	}
 
 	hash := sha1.Sum(pkBytes)
@@ -106,13 +165,13 @@ func CreateX509CACertificate(opts ...option) (*x509.Certificate, *rsa.PrivateKey
 		SerialNumber:                big.NewInt(time.Now().UnixNano()),
 		NotBefore:                   time.Now(),
 		NotAfter:                    time.Now().Add(365 * 24 * time.Hour),
-		KeyUsage:                    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-		ExtKeyUsage:                 []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:                    keyUsage(pub) | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		ExtKeyUsage:                 []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
 		Subject:                     pkix.Name{CommonName: ""},
 		IsCA:                        true,
 		Issuer:                      pkix.Name{CommonName: ""},
-		PublicKey:                   &privKey.PublicKey,
-		SignatureAlgorithm:          x509.SHA256WithRSA,
+		PublicKey:                   pub,
+		SignatureAlgorithm:          signatureAlgorithm(pub),
 		BasicConstraintsValid:       true,
 		SubjectKeyId:                hash[:],
 		AuthorityKeyId:              hash[:],
@@ -125,42 +184,55 @@ func CreateX509CACertificate(opts ...option) (*x509.Certificate, *rsa.PrivateKey
 		PermittedDNSDomains:         []string{},
 		PermittedEmailAddresses:     []string{},
 		PermittedURIDomains:         []string{},
-		PublicKeyAlgorithm:          x509.RSA,
 	}
 
 	for _, o := range opts {
 		o(template)
 	}
 
-	certDER, err := x509.CreateCertificate(rand.New(rand.NewSource(time.Now().UnixNano())), template, template, &privKey.PublicKey, privKey)
+	certDER, err := x509.CreateCertificate(crand.Reader, template, template, pub, privKey)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create certificate: %v", err)
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
 	}
 
 	cert, err := x509.ParseCertificate(certDER)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse certificate: %v", err)
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
 	}
 
-	return cert, privKey, nil
+	return cert, nil
 }
 
+// CreateX509Certificate issues a certificate for a new RSA key, see
+// CreateX509CertificateWithKey for other key types.
 func CreateX509Certificate(ca X509, opts ...option) (*x509.Certificate, *rsa.PrivateKey, error) {
-	privKey, err := rsa.GenerateKey(rand.New(rand.NewSource(time.Now().UnixNano())), 2048)
+	privKey, err := NewRSAKey()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to generate private key: %v", err)
 	}
 
+	cert, err := CreateX509CertificateWithKey(ca, privKey, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, privKey, nil
+}
+
+// CreateX509CertificateWithKey issues a certificate for the RSA, ECDSA or
+// Ed25519 key, signed by ca.
+func CreateX509CertificateWithKey(ca X509, privKey crypto.Signer, opts ...option) (*x509.Certificate, error) {
+	pub := privKey.Public()
 	template := &x509.Certificate{
 		SerialNumber:                big.NewInt(time.Now().UnixNano()),
 		NotBefore:                   ca.crt.NotBefore,
 		NotAfter:                    time.Now().Add(365 * 24 * time.Hour),
-		KeyUsage:                    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		KeyUsage:                    keyUsage(pub),
 		ExtKeyUsage:                 []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		Subject:                     ca.crt.Subject,
 		Issuer:                      ca.crt.Subject,
-		PublicKey:                   &ca.crt.PublicKey,
-		SignatureAlgorithm:          x509.SHA256WithRSA,
+		PublicKey:                   pub,
+		SignatureAlgorithm:          signatureAlgorithm(ca.crt.PublicKey),
 		BasicConstraintsValid:       true,
 		SubjectKeyId:                ca.crt.SubjectKeyId,
 		AuthorityKeyId:              ca.crt.AuthorityKeyId,
@@ -173,45 +245,66 @@ func CreateX509Certificate(ca X509, opts ...option) (*x509.Certificate, *rsa.Pri
 		PermittedDNSDomains:         ca.crt.PermittedDNSDomains,
 		PermittedEmailAddresses:     ca.crt.PermittedEmailAddresses,
 		PermittedURIDomains:         ca.crt.PermittedURIDomains,
-		PublicKeyAlgorithm:          x509.RSA,
 	}
 
 	for _, o := range opts {
 		o(template)
 	}
 
-	certDER, err := x509.CreateCertificate(rand.New(rand.NewSource(time.Now().UnixNano())), template, &ca.crt, &privKey.PublicKey, &ca.privKey)
+	certDER, err := x509.CreateCertificate(crand.Reader, template, &ca.crt, pub, ca.privKey)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create certificate: %v", err)
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
 	}
 
 	cert, err := x509.ParseCertificate(certDER)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse certificate: %v", err)
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
 	}
 
-	return cert, privKey, nil
+	return cert, nil
 }
 
 func CreateX509CA(opts ...option) (*X509, error) {
-	cert, privkey, err := CreateX509CACertificate(opts...)
+	return CreateX509CAWithKeyType(KeyTypeRSA, opts...)
+}
+
+// CreateX509CAWithKeyType creates a self-signed CA with a new key of the
+// type.
+func CreateX509CAWithKeyType(t KeyType, opts ...option) (*X509, error) {
+	privKey, err := NewPrivateKey(t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %v", err)
+	}
+
+	cert, err := CreateX509CACertificateWithKey(privKey, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewX509(*cert, *privkey, *NewRand()), nil
+	return NewX509(*cert, privKey, *NewRand()), nil
 }
 
 func CreateX509(ca X509, opts ...option) (*X509, error) {
-	cert, privkey, err := CreateX509Certificate(ca, opts...)
+	return CreateX509WithKeyType(ca, KeyTypeRSA, opts...)
+}
+
+// CreateX509WithKeyType issues a certificate for a new key of the type,
+// signed by ca.
+func CreateX509WithKeyType(ca X509, t KeyType, opts ...option) (*X509, error) {
+	privKey, err := NewPrivateKey(t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %v", err)
+	}
+
+	cert, err := CreateX509CertificateWithKey(ca, privKey, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewX509(*cert, *privkey, *NewRand()), nil
+	return NewX509(*cert, privKey, *NewRand()), nil
 }
 
-func NewX509(crt x509.Certificate, privKey rsa.PrivateKey, r rand.Rand) *X509 {
+func NewX509(crt x509.Certificate, privKey crypto.Signer, r rand.Rand) *X509 {
 	return &X509{
 		crt:     crt,
 		privKey: privKey,
@@ -228,6 +321,8 @@ func ParseX509File(filename string) (*X509, error) {
 	return ParseX509Bytes(pemB)
 }
 
+// ParseX509Bytes parses a PEM private key followed by its certificate, the
+// format of Pem. The key may be a PKCS1 RSA, SEC1 EC or PKCS8 key.
 func ParseX509Bytes(pemB []byte) (*X509, error) {
 
 	privateKeyblock, rest := pem.Decode(pemB)
@@ -241,7 +336,7 @@ func ParseX509Bytes(pemB []byte) (*X509, error) {
 		return nil, fmt.Errorf("failed to parse PEM block containing the certificate")
 	}
 
-	priv, err := x509.ParsePKCS1PrivateKey(privateKeyblock.Bytes)
+	priv, err := parsePrivateKeyBlock(privateKeyblock)
 	if err != nil {
 		return nil, err
 	}
@@ -251,65 +346,92 @@ func ParseX509Bytes(pemB []byte) (*X509, error) {
 		return nil, err
 	}
 
+	if pub, ok := crt.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(priv.Public()) {
+		return nil, fmt.Errorf("private key does not match the certificate")
+	}
+
 	return &X509{
 		crt:     *crt,
-		privKey: *priv,
+		privKey: priv,
 		r:       *NewRand(),
 	}, nil
 }
 
 type X509 struct {
 	crt     x509.Certificate
-	privKey rsa.PrivateKey
+	privKey crypto.Signer
 	r       rand.Rand
 }
 
+// Encrypt returns ErrUnsupportedKeyType unless the certificate has an RSA
+// key.
 func (x *X509) Encrypt(data []byte) ([]byte, error) {
 	// Encrypt data
 	switch x.crt.PublicKey.(type) {
 	case *rsa.PublicKey:
 		return x.encryptRSA(data)
 	default:
-		return nil, fmt.Errorf("unsupported public key type")
+		return nil, fmt.Errorf("%w: %T can not encrypt", ErrUnsupportedKeyType, x.crt.PublicKey)
 	}
 }
 
+// encryptRSA reads padding from crypto/rand, which unlike x.r is safe for
+// concurrent use.
 func (x *X509) encryptRSA(data []byte) ([]byte, error) {
-	return rsa.EncryptPKCS1v15(&x.r, x.crt.PublicKey.(*rsa.PublicKey), data)
+	return rsa.EncryptPKCS1v15(crand.Reader, x.crt.PublicKey.(*rsa.PublicKey), data)
 }
 
 func (x *X509) Decrypt(data []byte) ([]byte, error) {
-	switch x.crt.PublicKey.(type) {
-	case *rsa.PublicKey:
-		return x.decryptRSA(data)
+	switch k := x.privKey.(type) {
+	case *rsa.PrivateKey:
+		return rsa.DecryptPKCS1v15(crand.Reader, k, data)
 	default:
-		return nil, fmt.Errorf("unsupported private key type")
+		return nil, fmt.Errorf("%w: %T can not decrypt", ErrUnsupportedKeyType, x.privKey)
 	}
 }
 
-func (x *X509) decryptRSA(data []byte) ([]byte, error) {
-	return rsa.DecryptPKCS1v15(&x.r, &x.privKey, data)
-}
-
 func (x *X509) GetCertificate() x509.Certificate {
 	return x.crt
 }
 
-func (x *X509) PublicKey() (rsa.PublicKey, []byte) {
-	pubKey := x.crt.PublicKey.(*rsa.PublicKey)
-	b := x509.MarshalPKCS1PublicKey(pubKey)
-	return *pubKey, b
+// KeyType returns the type of the certificate's key, empty for keys
+// NewPrivateKey can not generate.
+func (x *X509) KeyType() KeyType {
+	switch k := x.crt.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return KeyTypeRSA
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return KeyTypeECDSAP256
+		case elliptic.P384():
+			return KeyTypeECDSAP384
+		}
+	case ed25519.PublicKey:
+		return KeyTypeEd25519
+	}
+
+	return ""
+}
+
+// PublicKey returns the key with its PKCS1 bytes for RSA and PKIX bytes for
+// other keys.
+func (x *X509) PublicKey() (crypto.PublicKey, []byte) {
+	b, _ := marshalPublicKey(x.crt.PublicKey)
+	return x.crt.PublicKey, b
 }
 
-func (x *X509) PrivateKey() (rsa.PrivateKey, []byte) {
-	return x.privKey, x509.MarshalPKCS1PrivateKey(&x.privKey)
+// PrivateKey returns the key with its PKCS1, SEC1 or PKCS8 bytes, see Pem.
+func (x *X509) PrivateKey() (crypto.Signer, []byte) {
+	_, b, _ := marshalPrivateKey(x.privKey)
+	return x.privKey, b
 }
 
 // gets the pem encoded private key and certificate in that order
 func (x *X509) Pem() ([]byte, []byte) {
-	keyB := x509.MarshalPKCS1PrivateKey(&x.privKey)
+	keyType, keyB, _ := marshalPrivateKey(x.privKey)
 	keyBlock := pem.Block{
-		Type:  "RSA PRIVATE KEY",
+		Type:  keyType,
 		Bytes: keyB,
 	}
 
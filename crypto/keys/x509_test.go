@@ -1,6 +1,9 @@
 package keys
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -28,3 +31,56 @@ func TestX509_CreateX509(t *testing.T) {
 	assert.Equal(t, ca.crt.SubjectKeyId, x509.GetCertificate().SubjectKeyId, "subject key IDs should match")
 	assert.Equal(t, ca.crt.AuthorityKeyId, x509.GetCertificate().AuthorityKeyId, "authority key IDs should match")
 }
+
+func TestX509_KeyTypes(t *testing.T) {
+	for _, keyType := range []KeyType{KeyTypeRSA, KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeEd25519} {
+		ca, err := CreateX509CAWithKeyType(keyType, WithCommonName("ca"))
+		if !assert.Nilf(t, err, "should create %s CA", keyType) {
+			continue
+		}
+		assert.Equal(t, keyType, ca.KeyType())
+
+		// an ECDSA leaf of each CA, the signature follows the CA key
+		leaf, err := CreateX509WithKeyType(*ca, KeyTypeECDSAP256, WithDNSNames([]string{"localhost"}))
+		if !assert.Nilf(t, err, "should issue a certificate with a %s CA", keyType) {
+			continue
+		}
+		caCrt, leafCrt := ca.GetCertificate(), leaf.GetCertificate()
+		assert.Nil(t, leafCrt.CheckSignatureFrom(&caCrt))
+		assert.IsType(t, &ecdsa.PublicKey{}, leafCrt.PublicKey)
+		assert.Equal(t, x509.KeyUsageDigitalSignature, leafCrt.KeyUsage, "only RSA keys encipher")
+
+		key, crt := ca.Pem()
+		parsed, err := ParseX509Bytes(bytes.Join([][]byte{key, crt}, nil))
+		if assert.Nilf(t, err, "should parse the %s pem", keyType) {
+			assert.Equal(t, caCrt.Raw, parsed.GetCertificate().Raw)
+			_, b := parsed.PrivateKey()
+			_, want := ca.PrivateKey()
+			assert.Equal(t, want, b)
+		}
+
+		enc, err := ca.Encrypt([]byte("data"))
+		if keyType == KeyTypeRSA {
+			assert.Nil(t, err)
+			dec, err := ca.Decrypt(enc)
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("data"), dec)
+			continue
+		}
+		assert.ErrorIsf(t, err, ErrUnsupportedKeyType, "%s keys should not encrypt", keyType)
+		_, err = ca.Decrypt([]byte("data"))
+		assert.ErrorIs(t, err, ErrUnsupportedKeyType)
+	}
+
+	_, err := NewPrivateKey("dsa")
+	assert.ErrorIs(t, err, ErrUnsupportedKeyType)
+
+	ca, err := CreateX509CA()
+	assert.Nil(t, err)
+	other, err := CreateX509CA()
+	assert.Nil(t, err)
+	key, _ := ca.Pem()
+	_, crt := other.Pem()
+	_, err = ParseX509Bytes(append(key, crt...))
+	assert.NotNilf(t, err, "should reject a key of another certificate")
+}
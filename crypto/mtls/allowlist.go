@@ -0,0 +1,74 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// AllowList restricts peers by the SANs of their certificates. Entries match
+// a SAN exactly, "*.example.com" matches DNS names with exactly one more
+// label and "spiffe://example.org/ns/*" matches URIs below the path. An empty
+// list allows every verified peer.
+type AllowList []string
+
+func matchSAN(pattern, san string) bool {
+	if pattern == san {
+		return true
+	}
+
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		label, rest, found := strings.Cut(san, ".")
+		return found && label != "" && label != "*" && rest == suffix
+	}
+
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.Contains(prefix, "://") {
+		return strings.HasPrefix(san, prefix+"/")
+	}
+
+	return false
+}
+
+// Allows returns whether the identity is verified and, unless the list is
+// empty, has a SAN matching an entry.
+func (a AllowList) Allows(id *Identity) bool {
+	if id == nil || !id.Verified {
+		return false
+	}
+
+	if len(a) == 0 {
+		return true
+	}
+
+	for _, san := range id.SANs() {
+		for _, pattern := range a {
+			if matchSAN(pattern, san) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Check returns ErrNoPeerCertificate or ErrPeerNotAllowed if the identity
+// is not allowed.
+func (a AllowList) Check(id *Identity) error {
+	if id == nil || !id.Verified {
+		return ErrNoPeerCertificate
+	}
+
+	if !a.Allows(id) {
+		return fmt.Errorf("%w: %s", ErrPeerNotAllowed, strings.Join(id.SANs(), ", "))
+	}
+
+	return nil
+}
+
+// VerifyConnection rejects handshakes of peers the list does not allow, set
+// it as the server's tls.Config.VerifyConnection to enforce it for every
+// protocol served.
+func (a AllowList) VerifyConnection(cs tls.ConnectionState) error {
+	id, _ := FromConnectionState(&cs)
+	return a.Check(id)
+}
@@ -0,0 +1,9 @@
+package mtls
+
+import "errors"
+
+var (
+	ErrNoPeerCertificate     = errors.New("no verified peer certificate")
+	ErrPeerNotAllowed        = errors.New("peer certificate not allowed")
+	ErrUnknownClientAuthMode = errors.New("unknown client auth mode")
+)
@@ -0,0 +1,92 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Identity is the peer of a mutual TLS connection, taken from its leaf
+// certificate.
+type Identity struct {
+	Subject        pkix.Name
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	URIs           []*url.URL
+	// SPIFFEID is the first spiffe:// URI SAN, empty if there is none.
+	SPIFFEID string
+	// Verified is false for certificates the server requested but did not
+	// verify, their identity can not be trusted.
+	Verified    bool
+	Certificate *x509.Certificate
+}
+
+func NewIdentity(crt *x509.Certificate, verified bool) *Identity {
+	id := &Identity{
+		Subject:        crt.Subject,
+		DNSNames:       crt.DNSNames,
+		IPAddresses:    crt.IPAddresses,
+		EmailAddresses: crt.EmailAddresses,
+		URIs:           crt.URIs,
+		Verified:       verified,
+		Certificate:    crt,
+	}
+	for _, u := range crt.URIs {
+		if strings.EqualFold(u.Scheme, "spiffe") {
+			id.SPIFFEID = u.String()
+			break
+		}
+	}
+
+	return id
+}
+
+// FromConnectionState returns the identity of the peer, false if it sent no
+// certificate.
+func FromConnectionState(cs *tls.ConnectionState) (*Identity, bool) {
+	if cs == nil {
+		return nil, false
+	}
+
+	if len(cs.VerifiedChains) > 0 && len(cs.VerifiedChains[0]) > 0 {
+		return NewIdentity(cs.VerifiedChains[0][0], true), true
+	}
+
+	if len(cs.PeerCertificates) > 0 {
+		return NewIdentity(cs.PeerCertificates[0], false), true
+	}
+
+	return nil, false
+}
+
+// SANs returns the DNS names, IP addresses, email addresses and URIs of the
+// identity as strings.
+func (id *Identity) SANs() []string {
+	var sans []string
+	sans = append(sans, id.DNSNames...)
+	for _, ip := range id.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, id.EmailAddresses...)
+	for _, u := range id.URIs {
+		sans = append(sans, u.String())
+	}
+
+	return sans
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok && id != nil
+}
@@ -0,0 +1,135 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// identify returns the identity of the peer. With an empty allow list a
+// missing identity is not an error.
+func identify(cs *tls.ConnectionState, allow AllowList) (*Identity, error) {
+	id, ok := FromConnectionState(cs)
+	if len(allow) == 0 {
+		return id, nil
+	}
+
+	if !ok {
+		return nil, ErrNoPeerCertificate
+	}
+
+	return id, allow.Check(id)
+}
+
+func httpStatus(err error) int {
+	if errors.Is(err, ErrPeerNotAllowed) {
+		return http.StatusForbidden
+	}
+
+	return http.StatusUnauthorized
+}
+
+// GinIdentity stores the identity of the client certificate in the request
+// context. With a non-empty allow list requests of other peers are
+// rejected.
+func GinIdentity(allow AllowList) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := identify(c.Request.TLS, allow)
+		if err != nil {
+			c.AbortWithStatusJSON(httpStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		if id != nil {
+			c.Request = c.Request.WithContext(WithIdentity(c.Request.Context(), id))
+		}
+		c.Next()
+	}
+}
+
+// HTTPIdentity is the net/http counterpart of GinIdentity.
+func HTTPIdentity(allow AllowList, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := identify(r.TLS, allow)
+		if err != nil {
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+
+		if id != nil {
+			r = r.WithContext(WithIdentity(r.Context(), id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GrpcConnectionState returns the TLS state of the call's connection, nil
+// if it does not use TLS credentials.
+func GrpcConnectionState(ctx context.Context) *tls.ConnectionState {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+
+	return &info.State
+}
+
+func grpcIdentity(ctx context.Context, allow AllowList) (context.Context, error) {
+	id, err := identify(GrpcConnectionState(ctx), allow)
+	if err != nil {
+		if errors.Is(err, ErrPeerNotAllowed) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	if id != nil {
+		ctx = WithIdentity(ctx, id)
+	}
+	return ctx, nil
+}
+
+// UnaryServerInterceptor is the gRPC counterpart of GinIdentity.
+func UnaryServerInterceptor(allow AllowList) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := grpcIdentity(ctx, allow)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
+
+func StreamServerInterceptor(allow AllowList) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := grpcIdentity(ss.Context(), allow)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &identityStream{ServerStream: ss, ctx: ctx})
+	}
+}
@@ -0,0 +1,43 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// ClientAuthMode selects whether servers ask clients for certificates.
+type ClientAuthMode string
+
+const (
+	ClientAuthNone ClientAuthMode = ""
+	// ClientAuthRequest asks for a certificate but neither requires nor
+	// verifies it.
+	ClientAuthRequest ClientAuthMode = "request"
+	// ClientAuthRequire requires a certificate signed by the client CAs.
+	ClientAuthRequire ClientAuthMode = "require"
+	// ClientAuthVerifyIfGiven verifies certificates clients send but allows
+	// clients without one.
+	ClientAuthVerifyIfGiven ClientAuthMode = "verify-if-given"
+)
+
+// TLSClientAuth returns the tls.ClientAuthType of the mode.
+func (m ClientAuthMode) TLSClientAuth() (tls.ClientAuthType, error) {
+	switch m {
+	case ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthRequest:
+		return tls.RequestClientCert, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("%w: %s", ErrUnknownClientAuthMode, string(m))
+	}
+}
+
+// Verifies returns whether the mode verifies client certificates against
+// the client CAs.
+func (m ClientAuthMode) Verifies() bool {
+	return m == ClientAuthRequire || m == ClientAuthVerifyIfGiven
+}
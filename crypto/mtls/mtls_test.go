@@ -0,0 +1,181 @@
+package mtls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newClientCert issues a client certificate with the SANs from the CA.
+func newClientCert(t *testing.T, ca *keys.X509, dnsNames []string, uris ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	var us []*url.URL
+	for _, u := range uris {
+		parsed, err := url.Parse(u)
+		assert.Nil(t, err)
+		us = append(us, parsed)
+	}
+
+	csrPem, err := keys.CreateCSR(key, keys.WithCommonName("client"), keys.WithDNSNames(dnsNames), keys.WithURIs(us))
+	assert.Nil(t, err)
+	csr, err := keys.ParseCSR(csrPem)
+	assert.Nil(t, err)
+	crt, err := keys.SignCSR(*ca, csr, keys.WithExtKeyUsage([]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}))
+	assert.Nil(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{crt.Raw}, PrivateKey: key, Leaf: crt}
+}
+
+// newServerConfig returns a server config verifying client certificates of
+// the CA if given, and a client config trusting the server.
+func newServerConfig(t *testing.T, ca *keys.X509) (*tls.Config, *x509.CertPool) {
+	srvKey, err := keys.CreateX509(*ca, keys.WithDNSNames([]string{"localhost"}), keys.WithIPAddresses([]net.IP{net.ParseIP("127.0.0.1")}))
+	assert.Nil(t, err)
+	keyPem, crtPem := srvKey.Pem()
+	srvCert, err := tls.X509KeyPair(crtPem, keyPem)
+	assert.Nil(t, err)
+
+	caCrt := ca.GetCertificate()
+	pool := x509.NewCertPool()
+	pool.AddCert(&caCrt)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{srvCert},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    pool,
+	}, pool
+}
+
+func TestAllowList(t *testing.T) {
+	ca, err := keys.CreateX509CA()
+	assert.Nil(t, err)
+
+	cert := newClientCert(t, ca, []string{"orders.svc.local"}, "spiffe://example.org/ns/prod/sa/orders")
+	id := NewIdentity(cert.Leaf, true)
+	assert.Equal(t, "spiffe://example.org/ns/prod/sa/orders", id.SPIFFEID)
+	assert.Equal(t, []string{"orders.svc.local", "spiffe://example.org/ns/prod/sa/orders"}, id.SANs())
+
+	for pattern, allowed := range map[string]bool{
+		"orders.svc.local":                       true,
+		"*.svc.local":                            true,
+		"*.local":                                false,
+		"spiffe://example.org/ns/prod/sa/orders": true,
+		"spiffe://example.org/ns/prod/*":         true,
+		"spiffe://example.org/ns/dev/*":          false,
+		"users.svc.local":                        false,
+	} {
+		assert.Equalf(t, allowed, AllowList{pattern}.Allows(id), "pattern %s", pattern)
+	}
+
+	assert.True(t, AllowList{}.Allows(id), "an empty list should allow every verified peer")
+	assert.ErrorIs(t, AllowList{}.Check(NewIdentity(cert.Leaf, false)), ErrNoPeerCertificate, "should not trust unverified peers")
+	assert.ErrorIs(t, AllowList{"users.svc.local"}.Check(id), ErrPeerNotAllowed)
+}
+
+func TestHTTPIdentity(t *testing.T) {
+	ca, err := keys.CreateX509CA()
+	assert.Nil(t, err)
+	other, err := keys.CreateX509CA()
+	assert.Nil(t, err)
+
+	srv := httptest.NewUnstartedServer(HTTPIdentity(AllowList{"spiffe://example.org/*"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := IdentityFromContext(r.Context())
+		assert.True(t, ok)
+		w.Write([]byte(id.SPIFFEID))
+	})))
+	var pool *x509.CertPool
+	srv.TLS, pool = newServerConfig(t, ca)
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(certs ...tls.Certificate) (int, string) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs}}}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			return 0, err.Error()
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	code, body := get(newClientCert(t, ca, nil, "spiffe://example.org/orders"))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "spiffe://example.org/orders", body)
+
+	code, _ = get(newClientCert(t, ca, []string{"orders.svc.local"}))
+	assert.Equalf(t, http.StatusForbidden, code, "should reject peers not on the allow list")
+
+	code, _ = get()
+	assert.Equalf(t, http.StatusUnauthorized, code, "should reject peers without certificate")
+
+	code, _ = get(newClientCert(t, other, nil, "spiffe://example.org/orders"))
+	assert.NotEqualf(t, http.StatusOK, code, "should reject certificates of other CAs")
+}
+
+func TestGrpcIdentity(t *testing.T) {
+	ca, err := keys.CreateX509CA()
+	assert.Nil(t, err)
+
+	srvCfg, pool := newServerConfig(t, ca)
+	var seen *Identity
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(srvCfg)),
+		grpc.ChainUnaryInterceptor(UnaryServerInterceptor(AllowList{"*.svc.local"}),
+			func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				seen, _ = IdentityFromContext(ctx)
+				return handler(ctx, req)
+			}))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	check := func(certs ...tls.Certificate) error {
+		conn, err := grpc.NewClient("passthrough:///localhost",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+			grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool, Certificates: certs})))
+		assert.Nil(t, err)
+		defer conn.Close()
+
+		_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		return err
+	}
+
+	assert.Nil(t, check(newClientCert(t, ca, []string{"orders.svc.local"})))
+	if assert.NotNil(t, seen) {
+		assert.Equal(t, []string{"orders.svc.local"}, seen.DNSNames)
+	}
+
+	assert.Equal(t, codes.PermissionDenied, status.Code(check(newClientCert(t, ca, []string{"orders.example.com"}))))
+	assert.Equal(t, codes.Unauthenticated, status.Code(check()))
+}
+
+func TestClientAuthMode(t *testing.T) {
+	auth, err := ClientAuthVerifyIfGiven.TLSClientAuth()
+	assert.Nil(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, auth)
+
+	_, err = ClientAuthMode("always").TLSClientAuth()
+	assert.ErrorIs(t, err, ErrUnknownClientAuthMode)
+}
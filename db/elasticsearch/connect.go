@@ -11,6 +11,7 @@ import (
 
 	"github.com/elastic/elastic-transport-go/v8/elastictransport"
 	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/ooqls/getset/crypto/keys"
 	"github.com/ooqls/getset/log"
 	"github.com/ooqls/getset/registry"
 	"go.uber.org/zap"
@@ -25,7 +26,7 @@ type ElasticsearchOptions struct {
 	Host      string
 	Port      int
 	User      string
-	Pw        string
+	Pw        *keys.Secret
 	DB        string
 	TlsConfig *tls.Config
 }
@@ -45,7 +46,7 @@ func Init(opts ElasticsearchOptions) error {
 			fmt.Sprintf("%s://%s:%d", opts.Protocol, opts.Host, opts.Port),
 		},
 		Username:          opts.User,
-		Password:          opts.Pw,
+		Password:          opts.Pw.Reveal(),
 		EnableDebugLogger: true,
 		Transport: &http.Transport{
 			TLSClientConfig: opts.TlsConfig,
@@ -0,0 +1,40 @@
+package integrationtest
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/ooqls/getset/crypto/keydb"
+	"github.com/ooqls/getset/crypto/keydb/keydbtest"
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/ooqls/getset/db/containers"
+	"github.com/ooqls/getset/db/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	postgresContainer := containers.StartPostgres(context.Background())
+	defer func() {
+		if err := postgresContainer.Terminate(context.Background()); err != nil {
+			log.Fatalf("failed to terminate postgres container: %v", err)
+		}
+	}()
+
+	os.Exit(m.Run())
+}
+
+func TestConformance_Postgres(t *testing.T) {
+	assert.Nilf(t, sqlx.InitDefault(), "should not fail to connect to postgres")
+	db := sqlx.GetSQLX()
+
+	keydbtest.Run(t, func(t *testing.T) keydbtest.OpenFunc {
+		_, err := db.Exec("DROP TABLE IF EXISTS key_pairs, system_meta, secrets")
+		assert.Nilf(t, err, "should not fail to drop key database tables")
+
+		return func(ctx context.Context, systemKey keys.X509) (*keydb.SQLCryptoDatabase, error) {
+			return keydb.NewPostgres(ctx, db, systemKey)
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"fmt"
 
+	"github.com/ooqls/getset/crypto/keys"
 	"github.com/ooqls/getset/registry"
 	"go.uber.org/zap"
 )
@@ -13,12 +14,12 @@ type Options struct {
 	Port int
 	User string
 	DB   string
-	Pw   string
+	Pw   *keys.Secret
 	Tls  *tls.Config
 }
 
 func (opt *Options) ConnectionString() string {
-	url := fmt.Sprintf("postgres://%s:%s@%s:%d/%s", opt.User, opt.Pw, opt.Host, opt.Port, opt.DB)
+	url := fmt.Sprintf("postgres://%s:%s@%s:%d/%s", opt.User, opt.Pw.Reveal(), opt.Host, opt.Port, opt.DB)
 	return url
 }
 
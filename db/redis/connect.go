@@ -49,10 +49,11 @@ func initRedis(db *registry.Database) error {
 	if err != nil {
 		return fmt.Errorf("failed to resolve redis password: %v", err)
 	}
+	defer pw.Delete()
 
 	pool = redis.NewClient(&redis.Options{
 		Addr:      fmt.Sprintf("%s:%d", db.Host, db.Port),
-		Password:  pw,
+		Password:  pw.Reveal(),
 		Username:  db.Auth.Username,
 		DB:        redisDb,
 		TLSConfig: tlsCfg,
@@ -17,6 +17,10 @@ var (
 	l   = log.NewLogger("sqlite")
 )
 
+// MemoryPath opens a private in-memory database that is gone once the
+// process exits.
+const MemoryPath = ":memory:"
+
 // Init opens the SQLite file at path, runs all schema statements,
 // and registers the connection under name for later retrieval with Get.
 func Init(name, path string, schema []string) error {
@@ -29,6 +33,12 @@ func Init(name, path string, schema []string) error {
 		return fmt.Errorf("failed to open sqlite db %q (%s): %v", name, path, err)
 	}
 
+	if path == MemoryPath {
+		// an in-memory database lives as long as its connection, keep a
+		// single one so every query sees the same database
+		db.SetMaxOpenConns(1)
+	}
+
 	if err := db.Ping(); err != nil {
 		return fmt.Errorf("failed to ping sqlite db %q: %v", name, err)
 	}
@@ -44,8 +44,9 @@ func GetSQLX() *sqlx.DB {
 
 func connectSqlx(opt postgres.Options) (*sqlx.DB, error) {
 	conStr := fmt.Sprintf("host=%s password=%s port=%d user=%s dbname=%s sslmode=disable",
-		opt.Host, opt.Pw, opt.Port, opt.User, opt.DB)
-	l.Info("connection string", zap.String("con", conStr))
+		opt.Host, opt.Pw.Reveal(), opt.Port, opt.User, opt.DB)
+	l.Info("connecting to postgres", zap.String("host", opt.Host), zap.Int("port", opt.Port),
+		zap.String("user", opt.User), zap.String("db", opt.DB), zap.Stringer("password", opt.Pw))
 	dbCon, err := sqlx.Open("postgres", conStr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open sql: %v", err)
@@ -63,8 +63,9 @@ func initValkey(db *registry.Database) error {
 		if err != nil {
 			return fmt.Errorf("failed to resolve valkey password: %v", err)
 		}
+		defer pw.Delete()
 		cliOpts.Username = db.Auth.Username
-		cliOpts.Password = pw
+		cliOpts.Password = pw.Reveal()
 	}
 
 	var err error
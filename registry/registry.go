@@ -1,12 +1,14 @@
 package registry
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"net/http"
 	"os"
 
+	"github.com/ooqls/getset/crypto/ca"
 	"github.com/ooqls/getset/crypto/crypto"
 	"github.com/ooqls/getset/crypto/keys"
 )
@@ -17,6 +19,10 @@ type TLSConfig struct {
 	KeyPath               string `yaml:"key_path"`
 	CaPath                string `yaml:"ca_path"`
 	InsecureSkipTLSVerify bool   `yaml:"insecure_skip_tls_verify"`
+	// RevocationCheck is "crl" or "ocsp" to check the server certificate
+	// for revocation, see ca.RevocationMode.
+	RevocationCheck    string `yaml:"revocation_check,omitempty"`
+	RevocationSoftFail bool   `yaml:"revocation_soft_fail,omitempty"`
 }
 
 func (cfg *TLSConfig) TLSConfig() (*tls.Config, error) {
@@ -26,7 +32,7 @@ func (cfg *TLSConfig) TLSConfig() (*tls.Config, error) {
 	defaultConfig := &tls.Config{}
 	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
 		if transport.TLSClientConfig != nil {
-			defaultConfig = transport.TLSClientConfig
+			defaultConfig = transport.TLSClientConfig.Clone()
 		}
 	}
 	if cfg.CertPath != "" && cfg.KeyPath != "" {
@@ -55,6 +61,14 @@ func (cfg *TLSConfig) TLSConfig() (*tls.Config, error) {
 
 	defaultConfig.InsecureSkipVerify = cfg.InsecureSkipTLSVerify
 
+	mode, err := ca.ParseRevocationMode(cfg.RevocationCheck)
+	if err != nil {
+		return nil, err
+	}
+	if mode != ca.RevocationCheckNone {
+		defaultConfig.VerifyConnection = ca.NewRevocationChecker(mode, ca.WithSoftFail(cfg.RevocationSoftFail)).VerifyConnection
+	}
+
 	return defaultConfig, nil
 }
 
@@ -62,22 +76,42 @@ type Auth struct {
 	Enabled      bool   `yaml:"enabled"`
 	Username     string `yaml:"username"`
 	PasswordFile string `yaml:"password_file"`
+	// SecretRef resolves the password through a SecretProvider, e.g.
+	// "env:PG_PASSWORD". It takes precedence over PasswordFile.
+	SecretRef string `yaml:"secret_ref,omitempty"`
 }
 
-func (a *Auth) ResolvePassword(algo crypto.Algorithm) (string, error) {
-	if a.PasswordFile == "" {
-		return "", nil
-	}
-	b, err := os.ReadFile(a.PasswordFile)
-	if err != nil {
-		return "", fmt.Errorf("failed to read password file %s: %v", a.PasswordFile, err)
+// ResolvePassword reads the secret ref or password file and decrypts it. The
+// returned secret is empty if neither is set and should be deleted once the
+// password is no longer needed.
+func (a *Auth) ResolvePassword(algo crypto.Algorithm) (*keys.Secret, error) {
+	var b []byte
+	switch {
+	case a.SecretRef != "":
+		secret, err := ResolveSecretRef(context.Background(), a.SecretRef)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve secret ref %s: %v", a.SecretRef, err)
+		}
+		defer secret.Delete()
+
+		b = secret.GetValue()
+	case a.PasswordFile != "":
+		var err error
+		b, err = os.ReadFile(a.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password file %s: %v", a.PasswordFile, err)
+		}
+	default:
+		return keys.NewSecret(nil), nil
 	}
+	defer keys.Zero(b)
+
 	decrypted, err := algo.Decrypt(b)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt password: %v", err)
+		return nil, fmt.Errorf("failed to decrypt password: %v", err)
 	}
 
-	return string(decrypted), nil
+	return keys.NewSecret(decrypted), nil
 }
 
 // NewAuthWithPassword writes the given password to a temp file and returns
@@ -113,31 +147,19 @@ type Server struct {
 	Encryption *Encryption            `yaml:"encryption,omitempty"`
 }
 
-func (a *Server) ResolvePassword() (string, error) {
-	if a.Auth.PasswordFile == "" {
-		return "", nil
-	}
-
-	b, err := os.ReadFile(a.Auth.PasswordFile)
-	if err != nil {
-		return "", fmt.Errorf("failed to read password file %s: %v", a.Auth.PasswordFile, err)
+// ResolvePassword resolves the password and decrypts it with the configured
+// encryption, if any.
+func (a *Server) ResolvePassword() (*keys.Secret, error) {
+	if (a.Auth.SecretRef == "" && a.Auth.PasswordFile == "") || a.Encryption == nil {
+		return a.Auth.ResolvePassword(crypto.NewNoopAlgorithm())
 	}
 
-	if a.Encryption == nil {
-		return string(b), nil
-	}
-	
 	algo, err := a.Encryption.Algorithm()
 	if err != nil {
-		return "", fmt.Errorf("failed to get encryption algorithm: %v", err)
+		return nil, fmt.Errorf("failed to get encryption algorithm: %v", err)
 	}
 
-	decrypted, err := algo.Decrypt(b)
-	if err != nil {
-		return "", fmt.Errorf("failed to decrypt password: %v", err)
-	}
-
-	return string(decrypted), nil
+	return a.Auth.ResolvePassword(algo)
 }
 
 type Encryption struct {
@@ -152,6 +174,35 @@ type Encryption struct {
 	X509 *struct {
 		CertPath string `yaml:"cert_path"`
 	} `yaml:"x509,omitempty"`
+	ChaCha20Poly1305 *struct {
+		Salt    string `yaml:"salt"`
+		KeyPath string `yaml:"key_path"`
+	} `yaml:"chacha20_poly1305,omitempty"`
+	XChaCha20Poly1305 *struct {
+		Salt    string `yaml:"salt"`
+		KeyPath string `yaml:"key_path"`
+	} `yaml:"xchacha20_poly1305,omitempty"`
+}
+
+// deriveKey derives a symmetric key from the passphrase in keyPath.
+func deriveKey(name, saltStr, keyPath string) ([]byte, [crypto.SALT_SIZE]byte, error) {
+	var salt [crypto.SALT_SIZE]byte
+	if len(saltStr) != crypto.SALT_SIZE {
+		return nil, salt, fmt.Errorf("%s salt must be %d bytes", name, crypto.SALT_SIZE)
+	}
+	copy(salt[:], saltStr)
+
+	b, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, salt, fmt.Errorf("failed to read %s key file %s: %v", name, keyPath, err)
+	}
+
+	key, err := crypto.DeriveAESGCMKey(string(b), salt)
+	if err != nil {
+		return nil, salt, fmt.Errorf("failed to derive %s key: %v", name, err)
+	}
+
+	return key, salt, nil
 }
 
 func (e *Encryption) Algorithm() (crypto.Algorithm, error) {
@@ -180,6 +231,22 @@ func (e *Encryption) Algorithm() (crypto.Algorithm, error) {
 		}
 		return crypto.NewX509Algorithm(x509), nil
 
+	case e.ChaCha20Poly1305 != nil:
+		key, salt, err := deriveKey("ChaCha20-Poly1305", e.ChaCha20Poly1305.Salt, e.ChaCha20Poly1305.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+
+		return crypto.NewChaCha20Poly1305AlgorithmWithKey(key, salt), nil
+
+	case e.XChaCha20Poly1305 != nil:
+		key, salt, err := deriveKey("XChaCha20-Poly1305", e.XChaCha20Poly1305.Salt, e.XChaCha20Poly1305.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+
+		return crypto.NewXChaCha20Poly1305AlgorithmWithKey(key, salt), nil
+
 	default:
 		return crypto.NewNoopAlgorithm(), nil
 	}
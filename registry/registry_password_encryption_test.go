@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"fmt"
 	"os"
 	"testing"
 
@@ -8,6 +9,7 @@ import (
 	"github.com/ooqls/getset/crypto/keys"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func writeTempFile(t *testing.T, content []byte) string {
@@ -85,7 +87,7 @@ func TestServerResolvePasswordRSA(t *testing.T) {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tc.expectedResult, result)
+				assert.Equal(t, tc.expectedResult, result.Reveal())
 			}
 		})
 	}
@@ -183,7 +185,7 @@ func TestServerResolvePasswordX509(t *testing.T) {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tc.expectedResult, result)
+				assert.Equal(t, tc.expectedResult, result.Reveal())
 			}
 		})
 	}
@@ -287,8 +289,64 @@ func TestServerResolvePasswordAESGCM(t *testing.T) {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tc.expectedResult, result)
+				assert.Equal(t, tc.expectedResult, result.Reveal())
 			}
 		})
 	}
 }
+
+func TestServerResolvePasswordChaCha20Poly1305(t *testing.T) {
+	salt := [crypto.SALT_SIZE]byte{}
+	copy(salt[:], []byte("testsalt12345678"))
+
+	passphrase := "chacha-key-passphrase"
+	derivedKey, err := crypto.DeriveAESGCMKey(passphrase, salt)
+	require.NoError(t, err)
+	keyFile := writeTempFile(t, []byte(passphrase))
+
+	tests := []struct {
+		description string
+		algorithm   string
+		encrypt     func(key []byte, salt [crypto.SALT_SIZE]byte, data []byte) ([]byte, error)
+	}{
+		{
+			description: "ChaCha20-Poly1305 encrypted password file decrypts correctly",
+			algorithm:   "chacha20_poly1305",
+			encrypt:     crypto.ChaCha20Poly1305EncryptWithKey,
+		},
+		{
+			description: "XChaCha20-Poly1305 encrypted password file decrypts correctly",
+			algorithm:   "xchacha20_poly1305",
+			encrypt:     crypto.XChaCha20Poly1305EncryptWithKey,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			encrypted, err := tc.encrypt(derivedKey, salt, []byte("chacha-secret"))
+			require.NoError(t, err)
+
+			var s Server
+			err = yaml.Unmarshal([]byte(fmt.Sprintf(`
+auth:
+  enabled: true
+  password_file: %s
+encryption:
+  %s:
+    salt: testsalt12345678
+    key_path: %s
+`, writeTempFile(t, encrypted), tc.algorithm, keyFile)), &s)
+			require.NoError(t, err)
+
+			result, err := s.ResolvePassword()
+			assert.NoError(t, err)
+			assert.Equal(t, "chacha-secret", result.Reveal())
+		})
+	}
+
+	var s Server
+	err = yaml.Unmarshal([]byte("encryption:\n  chacha20_poly1305:\n    salt: short\n"), &s)
+	require.NoError(t, err)
+	_, err = s.Encryption.Algorithm()
+	assert.Errorf(t, err, "salts of the wrong size should be rejected")
+}
@@ -102,7 +102,7 @@ func TestServerResolvePassword(t *testing.T) {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tc.expectedResult, result)
+				assert.Equal(t, tc.expectedResult, result.Reveal())
 			}
 		})
 	}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/ooqls/getset/crypto/ca"
 	"github.com/ooqls/getset/crypto/keys"
 	"github.com/stretchr/testify/assert"
 )
@@ -102,6 +103,16 @@ func TestTLSConfig(t *testing.T) {
 	cfg, err := reg.Redis.TLS.TLSConfig()
 	assert.Nilf(t, err, "should not fail to get tls config")
 	assert.NotNil(t, cfg)
+	assert.Nil(t, cfg.VerifyConnection)
+
+	reg.Redis.TLS.RevocationCheck = "ocsp"
+	cfg, err = reg.Redis.TLS.TLSConfig()
+	assert.Nil(t, err)
+	assert.NotNilf(t, cfg.VerifyConnection, "should check revocation")
+
+	reg.Redis.TLS.RevocationCheck = "always"
+	_, err = reg.Redis.TLS.TLSConfig()
+	assert.ErrorIs(t, err, ca.ErrUnknownRevocationMode)
 }
 
 func TestTlsConnect(t *testing.T) {
@@ -0,0 +1,192 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ooqls/getset/crypto/keys"
+)
+
+var (
+	ErrSecretNotFound        = errors.New("secret not found")
+	ErrUnknownSecretProvider = errors.New("unknown secret provider")
+	ErrInvalidSecretRef      = errors.New("invalid secret reference")
+)
+
+// SecretProvider resolves the reference part of a secret_ref, everything
+// after "<scheme>:", to the secret value.
+type SecretProvider interface {
+	Resolve(ctx context.Context, ref string) (*keys.Secret, error)
+}
+
+var providersM sync.RWMutex
+var providers = map[string]SecretProvider{
+	"file":  &FileSecretProvider{},
+	"env":   &EnvSecretProvider{},
+	"vault": NewVaultSecretProvider(),
+}
+
+// RegisterSecretProvider makes the provider available to secret_refs with
+// the given scheme, replacing any provider registered before.
+func RegisterSecretProvider(scheme string, p SecretProvider) {
+	providersM.Lock()
+	defer providersM.Unlock()
+
+	providers[scheme] = p
+}
+
+// ResolveSecretRef resolves a reference of the form "<scheme>:<ref>", e.g.
+// "env:PG_PASSWORD", "file:/run/secrets/pg", "keydb:postgres" or
+// "vault:secret/postgres#password".
+func ResolveSecretRef(ctx context.Context, secretRef string) (*keys.Secret, error) {
+	scheme, ref, ok := strings.Cut(secretRef, ":")
+	if !ok || ref == "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSecretRef, secretRef)
+	}
+
+	providersM.RLock()
+	p, ok := providers[scheme]
+	providersM.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSecretProvider, scheme)
+	}
+
+	return p.Resolve(ctx, ref)
+}
+
+// FileSecretProvider reads the secret from the file at ref.
+type FileSecretProvider struct{}
+
+func (p *FileSecretProvider) Resolve(ctx context.Context, ref string) (*keys.Secret, error) {
+	b, err := os.ReadFile(ref)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: file %s", ErrSecretNotFound, ref)
+		}
+
+		return nil, fmt.Errorf("failed to read secret file %s: %v", ref, err)
+	}
+
+	return keys.NewSecret(b), nil
+}
+
+// EnvSecretProvider reads the secret from the environment variable ref.
+type EnvSecretProvider struct{}
+
+func (p *EnvSecretProvider) Resolve(ctx context.Context, ref string) (*keys.Secret, error) {
+	v, ok := os.LookupEnv(ref)
+	if !ok {
+		return nil, fmt.Errorf("%w: environment variable %s", ErrSecretNotFound, ref)
+	}
+
+	return keys.NewSecretString(v), nil
+}
+
+// VaultSecretProvider reads secrets from a HashiCorp Vault compatible KV
+// secrets engine. A ref has the form "<mount>/<path>#<key>", the key
+// defaults to "password".
+type VaultSecretProvider struct {
+	// Address and Token default to VAULT_ADDR and VAULT_TOKEN when empty.
+	Address   string
+	Token     string
+	Namespace string
+	// KVVersion is the version of the KV engine, 1 or 2. Defaults to 2.
+	KVVersion int
+	Client    *http.Client
+}
+
+func NewVaultSecretProvider() *VaultSecretProvider {
+	return &VaultSecretProvider{
+		KVVersion: 2,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *VaultSecretProvider) Resolve(ctx context.Context, ref string) (*keys.Secret, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok {
+		key = "password"
+	}
+
+	mount, path, ok := strings.Cut(strings.Trim(path, "/"), "/")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("%w: vault ref %q must be <mount>/<path>", ErrInvalidSecretRef, ref)
+	}
+
+	address := p.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, fmt.Errorf("vault address not configured, set VAULT_ADDR")
+	}
+
+	token := p.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/%s", strings.TrimRight(address, "/"), mount, path)
+	if p.KVVersion != 1 {
+		url = fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(address, "/"), mount, path)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault request: %v", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret %s: %v", ref, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: vault path %s/%s", ErrSecretNotFound, mount, path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("vault returned %d for %s: %s", resp.StatusCode, ref, body)
+	}
+
+	var kv struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&kv); err != nil {
+		return nil, fmt.Errorf("failed to decode vault response: %v", err)
+	}
+
+	data := kv.Data
+	if p.KVVersion != 1 {
+		// KV v2 nests the secret next to its metadata
+		data = nil
+		if err := json.Unmarshal(kv.Data["data"], &data); err != nil {
+			return nil, fmt.Errorf("failed to decode vault response: %v", err)
+		}
+	}
+
+	var value string
+	if err := json.Unmarshal(data[key], &value); err != nil {
+		return nil, fmt.Errorf("%w: key %s in vault path %s/%s", ErrSecretNotFound, key, mount, path)
+	}
+
+	return keys.NewSecretString(value), nil
+}
@@ -0,0 +1,165 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ooqls/getset/crypto/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func newVaultStub(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/postgres":
+			w.Write([]byte(`{"data":{"data":{"password":"kv2-secret","user":"admin"},"metadata":{"version":1}}}`))
+		case "/v1/kv/postgres":
+			w.Write([]byte(`{"data":{"password":"kv1-secret"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	srv := newVaultStub(t, "test-token")
+	ctx := context.Background()
+
+	p := NewVaultSecretProvider()
+	p.Address = srv.URL
+	p.Token = "test-token"
+
+	secret, err := p.Resolve(ctx, "secret/postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "kv2-secret", secret.Reveal())
+
+	secret, err = p.Resolve(ctx, "secret/postgres#user")
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", secret.Reveal())
+
+	_, err = p.Resolve(ctx, "secret/postgres#missing")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	_, err = p.Resolve(ctx, "secret/other")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	_, err = p.Resolve(ctx, "secret")
+	assert.ErrorIs(t, err, ErrInvalidSecretRef)
+
+	p.KVVersion = 1
+	secret, err = p.Resolve(ctx, "kv/postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, "kv1-secret", secret.Reveal())
+
+	p.Token = "wrong"
+	_, err = p.Resolve(ctx, "kv/postgres")
+	assert.Error(t, err)
+}
+
+func TestResolveSecretRef(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("REGISTRY_TEST_PASSWORD", "env-secret")
+
+	secret, err := ResolveSecretRef(ctx, "env:REGISTRY_TEST_PASSWORD")
+	assert.NoError(t, err)
+	assert.Equal(t, "env-secret", secret.Reveal())
+
+	_, err = ResolveSecretRef(ctx, "env:REGISTRY_TEST_MISSING")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	secret, err = ResolveSecretRef(ctx, "file:"+writeTempPasswordFile(t, "file-secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, "file-secret", secret.Reveal())
+
+	_, err = ResolveSecretRef(ctx, "file:/does/not/exist")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	_, err = ResolveSecretRef(ctx, "unknown:ref")
+	assert.ErrorIs(t, err, ErrUnknownSecretProvider)
+
+	_, err = ResolveSecretRef(ctx, "no-scheme")
+	assert.ErrorIs(t, err, ErrInvalidSecretRef)
+}
+
+type staticSecretProvider map[string]string
+
+func (p staticSecretProvider) Resolve(ctx context.Context, ref string) (*keys.Secret, error) {
+	v, ok := p[ref]
+	if !ok {
+		return nil, ErrSecretNotFound
+	}
+
+	return keys.NewSecretString(v), nil
+}
+
+func TestServerResolvePasswordSecretRef(t *testing.T) {
+	RegisterSecretProvider("static", staticSecretProvider{"postgres": "static-secret"})
+	t.Setenv("REGISTRY_TEST_PASSWORD", "env-secret")
+
+	srv := newVaultStub(t, "test-token")
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "test-token")
+
+	tests := []struct {
+		description    string
+		auth           string
+		expectedResult string
+		expectError    bool
+	}{
+		{
+			description:    "env secret ref",
+			auth:           "secret_ref: env:REGISTRY_TEST_PASSWORD",
+			expectedResult: "env-secret",
+		},
+		{
+			description:    "vault secret ref",
+			auth:           "secret_ref: vault:secret/postgres#password",
+			expectedResult: "kv2-secret",
+		},
+		{
+			description:    "registered provider",
+			auth:           "secret_ref: static:postgres",
+			expectedResult: "static-secret",
+		},
+		{
+			description:    "secret ref takes precedence over the password file",
+			auth:           "secret_ref: static:postgres\n  password_file: " + writeTempPasswordFile(t, "file-secret"),
+			expectedResult: "static-secret",
+		},
+		{
+			description: "missing secret returns error",
+			auth:        "secret_ref: static:missing",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			var s Server
+			require.NoError(t, yaml.Unmarshal([]byte("auth:\n  enabled: true\n  "+tc.auth+"\n"), &s))
+
+			result, err := s.ResolvePassword()
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedResult, result.Reveal())
+			}
+		})
+	}
+}